@@ -2,14 +2,22 @@ package main
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"openturntable/artwork"
 	"openturntable/database"
+	"openturntable/library"
+	"openturntable/lyrics"
 	"openturntable/playback"
+	"openturntable/playlists"
+	"openturntable/podcasts"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -17,13 +25,36 @@ import (
 type App struct {
 	ctx             context.Context
 	player          *playback.Player
+	artwork         *artwork.Cache
 	db              *database.DB
+	library         *library.Library
+	podcasts        *podcasts.Manager
 	queueVarsBackup map[string]interface{}
+
+	// Lyrics of the current song. GetLyrics and GetPosition are called
+	// from different goroutines, so these are guarded by lyricsMu
+	lyricsMu   sync.Mutex
+	lyrics     *lyrics.Lyrics
+	lyricsPath string
+	lyricsLine int
+
+	// Set once "playbackComplete" has been emitted for the current track, so
+	// polls past its end don't emit it (and record a play) again. Cleared
+	// when a track starts playing
+	completeMu sync.Mutex
+	completed  bool
 }
 
 func NewApp() *App {
+	// Artwork is served by the asset server, which is set up before startup
+	art, err := artwork.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	return &App{
-		player: playback.NewPlayer(),
+		player:  playback.NewPlayer(),
+		artwork: art,
 	}
 }
 
@@ -37,6 +68,29 @@ func (a *App) startup(ctx context.Context) {
 	}
 
 	a.db = db
+	a.library = library.New(a.db, a.artwork)
+
+	if err := a.library.MigrateArtwork(); err != nil {
+		log.Println(err)
+	}
+
+	// Watch library folders, catching up on anything that changed while closed
+	err = a.library.Watch(ctx, 2*time.Second, func(summary library.ScanSummary) {
+		runtime.EventsEmit(a.ctx, "libraryChanged", summary)
+	})
+	if err != nil {
+		log.Println(err)
+	}
+
+	// Set up podcasts and refresh feeds hourly
+	podcastManager, err := podcasts.NewManager(a.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	a.podcasts = podcastManager
+	a.podcasts.StartScheduler(ctx, time.Hour, func() {
+		runtime.EventsEmit(a.ctx, "podcastsRefreshed")
+	})
 
 	// Get all songs
 	songs, err := a.db.GetSongs()
@@ -64,7 +118,7 @@ func (a *App) startup(ctx context.Context) {
 }
 
 // Called after front-end resources have been loaded
-func (a App) domReady(ctx context.Context) {
+func (a *App) domReady(ctx context.Context) {
 	// Add your action here
 }
 
@@ -102,11 +156,31 @@ func (a *App) SelectAndPlayFile() error {
 	if err != nil {
 		return err
 	}
-	return a.player.Play(filePath, 1.0)
+	return a.play(filePath, 1.0)
 }
 
 func (a *App) PlayFile(filePath string, speed float64) error {
-	return a.player.Play(filePath, speed)
+	return a.play(filePath, speed)
+}
+
+// Starts playing a file or URL as a new track
+func (a *App) play(source string, speed float64) error {
+	if err := a.player.Play(source, speed); err != nil {
+		return err
+	}
+
+	a.setCompleted(false)
+	return nil
+}
+
+// Sets whether the current track has finished, reporting whether it changed
+func (a *App) setCompleted(completed bool) bool {
+	a.completeMu.Lock()
+	defer a.completeMu.Unlock()
+
+	changed := a.completed != completed
+	a.completed = completed
+	return changed
 }
 
 // Binding to call  pause function in player
@@ -141,10 +215,25 @@ func (a *App) GetPosition() (float64, error) {
 		return 0, err
 	}
 
-	if position >= duration {
+	// Streams have no duration, so they never complete on their own
+	if !a.player.IsStream() && position >= duration && a.setCompleted(true) {
 		runtime.EventsEmit(a.ctx, "playbackComplete")
 	}
 
+	// Let the frontend know when the current lyric line changes
+	a.lyricsMu.Lock()
+	line, changed := -1, false
+	if a.lyrics != nil && a.lyricsPath == a.player.GetFilePath() {
+		line = a.lyrics.LineAt(position)
+		changed = line != a.lyricsLine
+		a.lyricsLine = line
+	}
+	a.lyricsMu.Unlock()
+
+	if changed {
+		runtime.EventsEmit(a.ctx, "lyricsLineChanged", line)
+	}
+
 	return position, err
 }
 
@@ -163,6 +252,32 @@ func (a *App) GetMetadata() map[string]string {
 	return a.player.GetMetadata()
 }
 
+// Loads the lyrics of the current song (from a sidecar .lrc file or its tags).
+// While they're loaded, GetPosition emits "lyricsLineChanged" with the current line index
+func (a *App) GetLyrics() (*lyrics.Lyrics, error) {
+	filePath := a.player.GetFilePath()
+	if filePath == "" || a.player.IsStream() {
+		return nil, errors.New("no local song playing")
+	}
+
+	a.lyricsMu.Lock()
+	defer a.lyricsMu.Unlock()
+
+	if a.lyrics == nil || a.lyricsPath != filePath {
+		l, err := lyrics.Load(filePath)
+		if err != nil {
+			a.lyrics = nil
+			return nil, err
+		}
+
+		a.lyrics = l
+		a.lyricsPath = filePath
+		a.lyricsLine = -1
+	}
+
+	return a.lyrics, nil
+}
+
 // Binding to call StopPlayback in player
 func (a *App) StopPlayback() {
 	a.player.StopPlayback()
@@ -187,6 +302,36 @@ func (a *App) GetSongsWithDetails() ([]database.SongWithDetails, error) {
 	return a.db.GetSongsWithDetails()
 }
 
+// Binding to call QuerySongs in db
+func (a *App) QuerySongs(query database.SongQuery) (*database.SongPage, error) {
+	return a.db.QuerySongs(query)
+}
+
+// Binding to call GetAlbums in db
+func (a *App) GetAlbums(query database.BrowseQuery) (*database.AlbumPage, error) {
+	return a.db.GetAlbums(query)
+}
+
+// Binding to call GetAlbum in db
+func (a *App) GetAlbum(album_id int64) (*database.AlbumWithTracks, error) {
+	return a.db.GetAlbum(album_id)
+}
+
+// Binding to call GetArtists in db
+func (a *App) GetArtists(query database.BrowseQuery) (*database.ArtistPage, error) {
+	return a.db.GetArtists(query)
+}
+
+// Binding to call GetArtist in db
+func (a *App) GetArtist(artist_id int64) (*database.ArtistWithAlbums, error) {
+	return a.db.GetArtist(artist_id)
+}
+
+// Binding to call SearchLibrary in db
+func (a *App) SearchLibrary(query string, limit int, offset int) ([]database.SongWithDetails, error) {
+	return a.db.SearchLibrary(query, limit, offset)
+}
+
 // Binding to call CreatePlaylist in db
 func (a *App) CreatePlaylist(playlist database.Playlist) (int64, error) {
 	return a.db.CreatePlaylist(playlist)
@@ -202,167 +347,456 @@ func (a *App) GetPlaylistWithSongs(playlist_id int64) (*database.PlaylistWithSon
 	return a.db.GetPlaylistWithSongs(playlist_id)
 }
 
-// Inserts all songs in directory (recursive) from user provided directory
-func (a *App) ImportSongsFromDirectory() (string, error) {
-	// Have user choose directory
-	dirPath, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+// Binding to call UpdatePlaylist in db
+func (a *App) UpdatePlaylist(playlist database.Playlist) error {
+	return a.db.UpdatePlaylist(playlist)
+}
+
+// Binding to call RenamePlaylist in db
+func (a *App) RenamePlaylist(playlist_id int64, name string) error {
+	return a.db.RenamePlaylist(playlist_id, name)
+}
+
+// Binding to call SetPlaylistPicture in db
+func (a *App) SetPlaylistPicture(playlist_id int64, picture string) error {
+	return a.db.SetPlaylistPicture(playlist_id, picture)
+}
+
+// Binding to call DeletePlaylist in db
+func (a *App) DeletePlaylist(playlist_id int64) error {
+	return a.db.DeletePlaylist(playlist_id)
+}
+
+// Binding to call DuplicatePlaylist in db
+func (a *App) DuplicatePlaylist(playlist_id int64) (int64, error) {
+	return a.db.DuplicatePlaylist(playlist_id)
+}
+
+// Binding to call CreatePlaylistEntry in db
+func (a *App) CreatePlaylistEntry(entry database.PlaylistEntry) (int64, error) {
+	return a.db.CreatePlaylistEntry(entry)
+}
+
+// Binding to call AddSongToPlaylist in db
+func (a *App) AddSongToPlaylist(playlist_id int64, song_id int64) (int64, error) {
+	return a.db.AddSongToPlaylist(playlist_id, song_id)
+}
+
+// Binding to call RemovePlaylistEntry in db
+func (a *App) RemovePlaylistEntry(entry_id int64) error {
+	return a.db.RemovePlaylistEntry(entry_id)
+}
+
+// Binding to call MovePlaylistEntry in db
+func (a *App) MovePlaylistEntry(entry_id int64, new_index int) error {
+	return a.db.MovePlaylistEntry(entry_id, new_index)
+}
+
+// Result of importing a playlist file
+type PlaylistImportResult struct {
+	PlaylistID int64
+	Imported   int
+	Unresolved []string
+}
+
+// Has the user pick an M3U/M3U8, PLS or XSPF file and imports it as a new playlist
+func (a *App) ImportPlaylistFile() (*PlaylistImportResult, error) {
+	filePath, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
 		Filters: []runtime.FileFilter{
 			{
-				DisplayName: "Audio Files (*.mp3, *.wav, *.flac, *.ogg)",
-				Pattern:     "*.mp3;*.wav;*.flac;*.ogg",
+				DisplayName: "Playlists (*.m3u, *.m3u8, *.pls, *.xspf)",
+				Pattern:     "*.m3u;*.m3u8;*.pls;*.xspf",
 			},
 		},
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	runtime.EventsEmit(a.ctx, "toggleImporting")
+	// Dialog was cancelled
+	if filePath == "" {
+		return nil, nil
+	}
+
+	return a.ImportPlaylistFromPath(filePath)
+}
+
+// Imports a playlist file as a new playlist named after the file. Entries are
+// matched to songs by path, unknown files are imported into the library, and
+// anything that can't be found is reported back in Unresolved
+func (a *App) ImportPlaylistFromPath(filePath string) (*PlaylistImportResult, error) {
+	format := playlists.DetectFormat("", filePath)
+	if format == "" {
+		return nil, fmt.Errorf("unsupported playlist file: %s", filePath)
+	}
 
-	allowed := map[string]bool{
-		".mp3":  true,
-		".flac": true,
-		".wav":  true,
-		".ogg":  true,
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
 
-	err = filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
+	entries, err := playlists.Parse(format, f)
+	if err != nil {
+		return nil, err
+	}
+
+	// Songs are found (or imported) first, so the playlist is only created
+	// once there's nothing left to fail
+	result := &PlaylistImportResult{}
+	var songIDs []int64
+	for _, entry := range entries {
+		songID, err := a.resolvePlaylistEntry(filePath, entry)
 		if err != nil {
-			fmt.Printf("Error accessing %s: %v\n", path, err)
-			return nil
+			log.Printf("could not resolve playlist entry %s: %v\n", entry.Location, err)
+			result.Unresolved = append(result.Unresolved, entry.Location)
+			continue
 		}
+		songIDs = append(songIDs, songID)
+	}
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
-		}
+	name := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+	result.PlaylistID, err = a.db.CreatePlaylistWithSongs(database.Playlist{Name: name}, songIDs)
+	if err != nil {
+		return nil, err
+	}
+	result.Imported = len(songIDs)
 
-		runtime.EventsEmit(a.ctx, "currentImportFileWorking", path)
+	return result, nil
+}
 
-		// Check extension
-		ext := strings.ToLower(filepath.Ext(path))
-		if allowed[ext] {
-			a.CreateSongFromFilePath(path)
-		}
+// Finds the song a playlist entry refers to, importing the file if it isn't in the library yet
+func (a *App) resolvePlaylistEntry(playlistPath string, entry playlists.Entry) (int64, error) {
+	songPath, ok := playlists.ResolvePath(playlistPath, entry.Location)
+	if !ok {
+		return 0, errors.New("not a local file")
+	}
 
-		return nil
-	})
+	if song, err := a.db.GetSongByPath(songPath); err == nil {
+		return song.ID, nil
+	}
 
+	info, err := os.Stat(songPath)
 	if err != nil {
-		fmt.Printf("Error walking directory: %v\n", err)
-		return "", nil
+		return 0, err
+	}
+	if info.IsDir() || !library.IsSupported(songPath) {
+		return 0, errors.New("not a supported audio file")
 	}
 
-	runtime.EventsEmit(a.ctx, "toggleImporting")
+	songID, err := a.CreateSongFromFilePath(songPath)
+	if err != nil {
+		return 0, err
+	}
+	if songID <= 0 {
+		return 0, errors.New("failed to import song")
+	}
 
-	return dirPath, nil
+	return songID, nil
 }
 
-// Inserts a new song into the database from file provided
-func (a *App) CreateSongFromFilePath(filePath string) (int64, error) {
-	// Check if file exists in the DB, and delete the old record if so
-	existingSong, err := a.db.GetSongByPath(filePath)
+// Has the user pick where to save a playlist and exports it there. The format
+// follows the chosen extension (.m3u/.m3u8, .pls or .xspf)
+func (a *App) ExportPlaylistFile(playlist_id int64, relative bool) (string, error) {
+	playlist, err := a.db.GetPlaylistById(playlist_id)
 	if err != nil {
-		log.Println("error finding existing song: ", err)
-	} else {
-		err = a.db.DeleteSong(existingSong.ID)
-		if err != nil {
-			log.Println("failed to delete old song record: ", err)
-		}
+		return "", err
 	}
 
-	// Open file for reading
-	f, err := os.Open(filePath)
+	filePath, err := runtime.SaveFileDialog(a.ctx, runtime.SaveDialogOptions{
+		DefaultFilename: playlist.Name + ".m3u8",
+		Filters: []runtime.FileFilter{
+			{
+				DisplayName: "Playlists (*.m3u, *.m3u8, *.pls, *.xspf)",
+				Pattern:     "*.m3u;*.m3u8;*.pls;*.xspf",
+			},
+		},
+	})
 	if err != nil {
-		return -1, err
+		return "", err
 	}
 
-	// Read metadata
-	metadata := playback.ReadMetadata(f)
+	// Dialog was cancelled
+	if filePath == "" {
+		return "", nil
+	}
 
-	// Initialize variables
-	var artist database.Artist
-	var album database.Album
-	var song database.Song
+	return filePath, a.ExportPlaylistToPath(playlist_id, filePath, relative)
+}
 
-	// Check for artist
-	if artistName, ok := metadata["artist"]; ok && artistName != "" {
-		// Check if artist already exists
-		artist, err = a.db.GetArtistByName(artistName)
-		if err != nil {
-			// Try creating artist upon error (assuming artist is not found)
-			log.Println("error finding existing artist:", err)
+// Writes a playlist to a file, with song paths either absolute or relative to the file
+func (a *App) ExportPlaylistToPath(playlist_id int64, filePath string, relative bool) error {
+	playlist, err := a.db.GetPlaylistWithSongs(playlist_id)
+	if err != nil {
+		return err
+	}
 
-			artist = database.Artist{
-				Name: metadata["artist"],
-				PFP:  "",
-			}
+	format := playlists.DetectFormat("", filePath)
+	if format == "" {
+		return fmt.Errorf("unsupported playlist file: %s", filePath)
+	}
 
-			createArtist, err := a.db.CreateArtist(artist)
-			if err != nil {
-				log.Println("error creating artist: ", err)
-			}
+	var entries []playlists.Entry
+	for _, e := range playlist.Entries {
+		location := playlists.FormatPath(filePath, e.Song.Path, relative)
+		if format == "xspf" {
+			location = playlists.FileURI(location)
+		}
 
-			artist.ID = createArtist
+		// Songs without a stored duration are written as unknown
+		duration := int64(-1)
+		if e.Song.Duration > 0 {
+			duration = int64(math.Round(e.Song.Duration))
 		}
+
+		entries = append(entries, playlists.Entry{
+			Location: location,
+			Title:    e.Song.Title,
+			Artist:   e.Song.ArtistName.String,
+			Duration: duration,
+		})
 	}
 
-	// Check for album
-	if albumName, ok := metadata["album"]; ok && albumName != "" {
-		album, err = a.db.GetAlbumByNameAndArtistId(albumName, artist.ID)
-		if err != nil {
-			log.Println("error finding existing album:", err)
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-			// Try creating album upon error (assuming album is not found)
-			album = database.Album{
-				Name:      metadata["album"],
-				Art:       metadata["albumArt"],
-				Artist_ID: artist.ID,
-			}
+	if err := playlists.Write(format, f, playlist.Playlist.Name, entries); err != nil {
+		return err
+	}
 
-			createAlbum, err := a.db.CreateAlbum(album)
-			if err != nil {
-				log.Println("error creating album: ", err)
-			}
+	return f.Close()
+}
 
-			album.ID = createAlbum
-		}
+// Binding to call CreateSmartPlaylist in db
+func (a *App) CreateSmartPlaylist(playlist database.SmartPlaylist) (int64, error) {
+	return a.db.CreateSmartPlaylist(playlist)
+}
+
+// Binding to call GetSmartPlaylists in db
+func (a *App) GetSmartPlaylists() ([]database.SmartPlaylist, error) {
+	return a.db.GetSmartPlaylists()
+}
+
+// Binding to call UpdateSmartPlaylist in db
+func (a *App) UpdateSmartPlaylist(playlist database.SmartPlaylist) error {
+	return a.db.UpdateSmartPlaylist(playlist)
+}
+
+// Binding to call DeleteSmartPlaylist in db
+func (a *App) DeleteSmartPlaylist(playlist_id int64) error {
+	return a.db.DeleteSmartPlaylist(playlist_id)
+}
+
+// Binding to call GetSmartPlaylistWithSongs in db
+func (a *App) GetSmartPlaylistWithSongs(playlist_id int64) (*database.PlaylistWithSongs, error) {
+	return a.db.GetSmartPlaylistWithSongs(playlist_id)
+}
+
+// Binding to call IncrementPlayCount in db, for when a song has been played
+func (a *App) RecordSongPlay(song_id int64) error {
+	return a.db.IncrementPlayCount(song_id)
+}
+
+// Binding to call CreateRadioStation in db
+func (a *App) CreateRadioStation(station database.RadioStation) (int64, error) {
+	return a.db.CreateRadioStation(station)
+}
+
+// Binding to call GetRadioStations in db
+func (a *App) GetRadioStations() ([]database.RadioStation, error) {
+	return a.db.GetRadioStations()
+}
+
+// Binding to call UpdateRadioStation in db
+func (a *App) UpdateRadioStation(station database.RadioStation) error {
+	return a.db.UpdateRadioStation(station)
+}
+
+// Binding to call DeleteRadioStation in db
+func (a *App) DeleteRadioStation(id int64) error {
+	return a.db.DeleteRadioStation(id)
+}
+
+// Saves a station from a pasted link. Playlist links (.pls/.m3u) are resolved,
+// with the first entry used as the stream URL and the rest kept as fallbacks
+func (a *App) ImportRadioStation(name string, url string) (int64, error) {
+	urls, err := playback.ResolveStreamURLs(url)
+	if err != nil {
+		return -1, err
 	}
 
-	// Create song
-	song = database.Song{
-		Path:      filePath,
-		Title:     metadata["title"],
-		Artist_ID: sql.NullInt64{Int64: 0, Valid: false},
-		Album_ID:  sql.NullInt64{Int64: 0, Valid: false},
-		Composer:  sql.NullString{String: metadata["composer"], Valid: metadata["composer"] != ""},
-		Comment:   sql.NullString{String: metadata["comment"], Valid: metadata["comment"] != ""},
-		Genre:     sql.NullString{String: metadata["genre"], Valid: metadata["genre"] != ""},
-		Year:      sql.NullString{String: metadata["year"], Valid: metadata["year"] != ""},
+	station := database.RadioStation{
+		Name:         name,
+		URL:          urls[0],
+		FallbackURLs: urls[1:],
 	}
 
-	// Set artist ID if valid
-	if artist.ID != 0 {
-		song.Artist_ID = sql.NullInt64{
-			Int64: artist.ID,
-			Valid: true,
-		}
+	return a.db.CreateRadioStation(station)
+}
+
+// Looks up a saved radio station and starts streaming it
+func (a *App) PlayRadioStation(id int64) error {
+	station, err := a.db.GetRadioStationById(id)
+	if err != nil {
+		return err
 	}
 
-	// Set album ID if valid
-	if album.ID != 0 {
-		song.Album_ID = sql.NullInt64{
-			Int64: album.ID,
-			Valid: true,
-		}
+	urls := append([]string{station.URL}, station.FallbackURLs...)
+	if err := a.player.PlayStream(urls, 1.0); err != nil {
+		return err
 	}
 
-	createSong, err := a.db.CreateSong(song)
-	if err != nil {
-		log.Println("error creating song: ", err)
+	a.setCompleted(false)
+	return nil
+}
+
+// Inserts all songs in directory (recursive) from user provided directory.
+// Emits "importProgress" while running and returns a report of what was
+// imported, including any per-file errors
+func (a *App) ImportSongsFromDirectory() (library.ImportReport, error) {
+	// Have user choose directory
+	dirPath, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Filters: []runtime.FileFilter{
+			{
+				DisplayName: "Audio Files (*.mp3, *.wav, *.flac, *.ogg)",
+				Pattern:     "*.mp3;*.wav;*.flac;*.ogg",
+			},
+		},
+	})
+	if err != nil || dirPath == "" {
+		return library.ImportReport{}, err
+	}
+
+	runtime.EventsEmit(a.ctx, "toggleImporting")
+	defer runtime.EventsEmit(a.ctx, "toggleImporting")
+
+	return a.library.Import(dirPath, func(progress library.ImportProgress) {
+		runtime.EventsEmit(a.ctx, "importProgress", progress)
+		runtime.EventsEmit(a.ctx, "currentImportFileWorking", progress.Current)
+	})
+}
+
+// Stops the running directory import. Files already imported are kept
+func (a *App) CancelImport() bool {
+	return a.library.CancelImport()
+}
+
+// Gets the rules deciding which files imports, rescans and the library
+// watcher leave out
+func (a *App) GetImportRules() (library.ImportRules, error) {
+	return a.library.GetImportRules()
+}
+
+// Replaces the import rules. Invalid patterns are rejected
+func (a *App) SetImportRules(rules library.ImportRules) error {
+	return a.library.SetImportRules(rules)
+}
+
+// Gets which folder images imports use as album covers, and whether
+// embedded covers come first
+func (a *App) GetArtworkSettings() (library.ArtworkSettings, error) {
+	return a.library.GetArtworkSettings()
+}
+
+// Replaces the artwork settings
+func (a *App) SetArtworkSettings(settings library.ArtworkSettings) error {
+	return a.library.SetArtworkSettings(settings)
+}
+
+// Has the user pick an image file. Returns "" if cancelled
+func (a *App) chooseImage(title string) (string, error) {
+	return runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: title,
+		Filters: []runtime.FileFilter{
+			{
+				DisplayName: "Images (*.jpg, *.jpeg, *.png, *.gif)",
+				Pattern:     "*.jpg;*.jpeg;*.png;*.gif",
+			},
+		},
+	})
+}
+
+// Has the user pick an image and sets it as an album's cover, optionally
+// embedding it in the album's files too
+func (a *App) ChooseAlbumArt(albumID int64, writeToFiles bool) (library.TagWriteReport, error) {
+	imagePath, err := a.chooseImage("Choose album art")
+	if err != nil || imagePath == "" {
+		return library.TagWriteReport{}, err
 	}
 
-	return createSong, nil
+	return a.SetAlbumArt(albumID, imagePath, writeToFiles)
+}
+
+// Sets an album's cover from an image file, optionally embedding it in the
+// album's files too
+func (a *App) SetAlbumArt(albumID int64, imagePath string, writeToFiles bool) (library.TagWriteReport, error) {
+	return a.library.SetAlbumArt(albumID, imagePath, writeToFiles)
+}
+
+// Removes an album's cover, optionally from the album's files too
+func (a *App) ClearAlbumArt(albumID int64, writeToFiles bool) (library.TagWriteReport, error) {
+	return a.library.ClearAlbumArt(albumID, writeToFiles)
+}
+
+// Has the user pick an image and sets it as an artist's picture
+func (a *App) ChooseArtistPicture(artistID int64) error {
+	imagePath, err := a.chooseImage("Choose artist picture")
+	if err != nil || imagePath == "" {
+		return err
+	}
+
+	return a.SetArtistPicture(artistID, imagePath)
+}
+
+// Sets an artist's picture from an image file
+func (a *App) SetArtistPicture(artistID int64, imagePath string) error {
+	return a.library.SetArtistPicture(artistID, imagePath)
+}
+
+// Removes an artist's picture
+func (a *App) ClearArtistPicture(artistID int64) error {
+	return a.library.ClearArtistPicture(artistID)
+}
+
+// Gets a song's tags for editing
+func (a *App) GetSongTags(id int64) (library.SongTags, error) {
+	return a.library.GetSongTags(id)
+}
+
+// Changes a song's tags in the library, optionally writing them into the
+// song's file too
+func (a *App) UpdateSong(id int64, tags library.SongTags, writeToFile bool) error {
+	return a.library.UpdateSong(id, tags, writeToFile)
+}
+
+// Inserts a new song into the database from file provided. A song already
+// stored under the same path is updated in place, keeping its ID
+func (a *App) CreateSongFromFilePath(filePath string) (int64, error) {
+	return a.library.ImportFile(filePath)
+}
+
+// Has the user choose a folder and rescans it
+func (a *App) RescanDirectory(verifyHashes bool) (library.ScanSummary, error) {
+	dirPath, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{})
+	if err != nil || dirPath == "" {
+		return library.ScanSummary{}, err
+	}
+
+	return a.RescanFolder(dirPath, verifyHashes)
+}
+
+// Syncs the library with a folder on disk: adds new files, updates changed
+// ones in place and marks vanished ones missing
+func (a *App) RescanFolder(dirPath string, verifyHashes bool) (library.ScanSummary, error) {
+	runtime.EventsEmit(a.ctx, "toggleImporting")
+	defer runtime.EventsEmit(a.ctx, "toggleImporting")
+
+	return a.library.Rescan(dirPath, library.ScanOptions{VerifyHashes: verifyHashes}, func(path string) {
+		runtime.EventsEmit(a.ctx, "currentImportFileWorking", path)
+	})
 }
 
 // Inserts a new song into the database with file selection
@@ -391,3 +825,163 @@ func (a *App) ChooseAndCreateSong() (int64, error) {
 
 	return song, nil
 }
+
+/// ===================
+///  PODCAST BINDINGS
+/// ===================
+
+// Subscribes to a podcast feed and returns the show ID
+func (a *App) SubscribePodcast(feedURL string) (int64, error) {
+	return a.podcasts.Subscribe(feedURL)
+}
+
+// Unsubscribes from a podcast, removing its episodes and downloads
+func (a *App) UnsubscribePodcast(showID int64) error {
+	return a.podcasts.Unsubscribe(showID)
+}
+
+// Binding to call GetPodcastShows in db
+func (a *App) GetPodcastShows() ([]database.PodcastShow, error) {
+	return a.db.GetPodcastShows()
+}
+
+// Binding to call GetPodcastEpisodes in db
+func (a *App) GetPodcastEpisodes(showID int64) ([]database.PodcastEpisode, error) {
+	return a.db.GetPodcastEpisodes(showID)
+}
+
+// Re-fetches every subscribed podcast feed
+func (a *App) RefreshPodcasts() error {
+	return a.podcasts.RefreshAll()
+}
+
+// Downloads a podcast episode to the managed folder
+func (a *App) DownloadPodcastEpisode(episodeID int64) (string, error) {
+	return a.podcasts.Download(episodeID)
+}
+
+// Deletes a downloaded podcast episode
+func (a *App) DeletePodcastEpisodeDownload(episodeID int64) error {
+	return a.podcasts.DeleteDownload(episodeID)
+}
+
+// Plays a podcast episode from its download if there is one, otherwise from
+// its URL, resuming where it was left off
+func (a *App) PlayPodcastEpisode(episodeID int64) error {
+	episode, err := a.db.GetPodcastEpisodeById(episodeID)
+	if err != nil {
+		return err
+	}
+
+	source := episode.AudioURL
+	if episode.DownloadPath != "" {
+		if _, err := os.Stat(episode.DownloadPath); err == nil {
+			source = episode.DownloadPath
+		}
+	}
+
+	if err := a.play(source, 1.0); err != nil {
+		return err
+	}
+
+	// Remote episodes only play as streams when the server can't seek them
+	if episode.Position > 0 && !a.player.IsStream() {
+		return a.player.Seek(episode.Position)
+	}
+	return nil
+}
+
+// Binding to call SetPodcastEpisodePosition in db
+func (a *App) SetPodcastEpisodePosition(episodeID int64, position float64) error {
+	return a.db.SetPodcastEpisodePosition(episodeID, position)
+}
+
+// Binding to call SetPodcastEpisodePlayed in db
+func (a *App) SetPodcastEpisodePlayed(episodeID int64, played bool) error {
+	return a.db.SetPodcastEpisodePlayed(episodeID, played)
+}
+
+/// ===================
+///  LIBRARY BINDINGS
+/// ===================
+
+// Has the user choose a folder to add to the library. Returns 0 if cancelled
+func (a *App) ChooseLibraryFolder() (int64, error) {
+	dirPath, err := runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{})
+	if err != nil || dirPath == "" {
+		return 0, err
+	}
+
+	return a.AddLibraryFolder(dirPath)
+}
+
+// Adds a folder to the library. It's scanned in the background and then
+// watched for changes, emitting "libraryChanged" whenever songs change
+func (a *App) AddLibraryFolder(dirPath string) (int64, error) {
+	return a.library.AddFolder(dirPath)
+}
+
+// Moves the library to a new location by rewriting every path starting with
+// oldPrefix (e.g. /mnt/music -> /media/nas/music). With dryRun nothing is
+// changed and the report shows how many songs would be found there.
+// separator is "/", "\\" or "" to match newPrefix
+func (a *App) RelocateLibrary(oldPrefix string, newPrefix string, dryRun bool, separator string) (library.RelocateReport, error) {
+	return a.library.Relocate(oldPrefix, newPrefix, library.RelocateOptions{DryRun: dryRun, Separator: separator})
+}
+
+// Gets all watched library folders
+func (a *App) GetLibraryFolders() ([]database.LibraryFolder, error) {
+	return a.db.GetLibraryFolders()
+}
+
+// Stops watching a library folder, keeping its songs
+func (a *App) RemoveLibraryFolder(id int64) error {
+	return a.library.RemoveFolder(id)
+}
+
+// Finds groups of songs that are copies of the same track. method is
+// "tags" (title, artist and duration), "hash" (identical files) or
+// "fingerprint" (same audio, needs FingerprintLibrary to have run)
+func (a *App) FindDuplicates(method string) ([]library.DuplicateGroup, error) {
+	return a.library.FindDuplicates(method)
+}
+
+// Keeps one song out of a group of duplicates, moving the others' playlist
+// entries and play counts onto it before removing them from the library
+func (a *App) MergeDuplicates(keepID int64, removeIDs []int64) error {
+	return a.library.MergeDuplicates(keepID, removeIDs)
+}
+
+// Starts computing acoustic fingerprints for every song that doesn't have
+// one, in the background. Emits "fingerprintProgress" while running, then
+// "fingerprintFinished" with the final progress, or "fingerprintFailed"
+func (a *App) FingerprintLibrary() error {
+	if a.library.Fingerprinting() {
+		return errors.New("fingerprinting is already running")
+	}
+
+	go func() {
+		progress, err := a.library.FingerprintLibrary(func(progress library.FingerprintProgress) {
+			runtime.EventsEmit(a.ctx, "fingerprintProgress", progress)
+		})
+		if err != nil {
+			log.Println("failed to fingerprint library: ", err)
+			runtime.EventsEmit(a.ctx, "fingerprintFailed", err.Error())
+			return
+		}
+		runtime.EventsEmit(a.ctx, "fingerprintFinished", progress)
+	}()
+
+	return nil
+}
+
+// Stops the running fingerprinting job. Fingerprints already computed are kept
+func (a *App) CancelFingerprinting() bool {
+	return a.library.CancelFingerprinting()
+}
+
+// Scores how alike two songs sound, from 0 (unrelated) to 1 (the same
+// recording)
+func (a *App) CompareSongs(aID int64, bID int64) (float64, error) {
+	return a.library.CompareSongs(aID, bID)
+}
@@ -0,0 +1,132 @@
+package artwork
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Thumbnail widths (and heights, covers being square) generated on request
+var Sizes = []int{64, 256, 1024}
+
+// Content-addressed store of artwork images. Each image is kept once under
+// the SHA-256 of its bytes, with thumbnails made from it when first asked for
+type Cache struct {
+	dir string
+}
+
+// Opens the artwork cache in the app's config directory
+func New() (*Cache, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("could not get config directory: %w", err)
+	}
+
+	return NewAt(filepath.Join(configDir, "OpenTurntable", "Artwork"))
+}
+
+// Opens an artwork cache stored in dir
+func NewAt(dir string) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create artwork directory: %w", err)
+	}
+
+	return &Cache{dir: dir}, nil
+}
+
+// Adds an image to the cache, returning the hash it's stored under. Storing
+// the same image again is cheap and returns the same hash
+func (c *Cache) Store(data []byte) (string, error) {
+	if !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		return "", errors.New("artwork is not an image")
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	path := c.originalPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return hash, nil
+	}
+
+	if err := writeFileAtomic(path, data); err != nil {
+		return "", fmt.Errorf("failed to store artwork: %w", err)
+	}
+
+	return hash, nil
+}
+
+// Adds an image given as a data: URI (how artwork used to be stored)
+func (c *Cache) StoreDataURI(uri string) (string, error) {
+	header, payload, ok := strings.Cut(strings.TrimPrefix(uri, "data:"), ",")
+	if !ok || !strings.HasSuffix(header, ";base64") {
+		return "", errors.New("artwork is not a base64 data URI")
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode artwork: %w", err)
+	}
+
+	return c.Store(data)
+}
+
+// Reports whether an image with this hash is in the cache
+func (c *Cache) Has(hash string) bool {
+	if !validHash(hash) {
+		return false
+	}
+
+	_, err := os.Stat(c.originalPath(hash))
+	return err == nil
+}
+
+// Gets the path of the original image
+func (c *Cache) originalPath(hash string) string {
+	return filepath.Join(c.dir, hash[:2], hash)
+}
+
+// Gets the path of a thumbnail
+func (c *Cache) thumbnailPath(hash string, size int) string {
+	return filepath.Join(c.dir, hash[:2], fmt.Sprintf("%s-%d.jpg", hash, size))
+}
+
+// Reports whether s looks like a hash from Store, so it's safe to use in paths
+func validHash(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.ToLower(s) == s
+}
+
+// Writes a file through a temporary file and a rename, so readers never see
+// it half written
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
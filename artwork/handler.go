@@ -0,0 +1,32 @@
+package artwork
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// URL path artwork is served under, as /art/<hash>?size=<px>
+const URLPrefix = "/art/"
+
+// Serves cached artwork to the frontend. size is optional and picks the
+// smallest thumbnail at least that big
+func (c *Cache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	hash, ok := strings.CutPrefix(r.URL.Path, URLPrefix)
+	if !ok || !validHash(hash) {
+		http.NotFound(w, r)
+		return
+	}
+
+	size, _ := strconv.Atoi(r.URL.Query().Get("size"))
+
+	path, err := c.Thumbnail(hash, size)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Content never changes for a given hash
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	http.ServeFile(w, r, path)
+}
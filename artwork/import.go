@@ -0,0 +1,97 @@
+package artwork
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"os"
+)
+
+// Limits on images picked by the user
+const (
+	// Largest image file accepted
+	MaxFileSize = 50 << 20
+	// Smallest width and height accepted
+	MinImageSize = 32
+	// Images bigger than this (on their longest side) are scaled down
+	MaxImageSize = 1500
+	// Most pixels an image can have and still be decoded. Decoding (and
+	// resizing) needs several bytes per pixel whatever the file's size
+	MaxPixels = 40_000_000
+)
+
+// Adds an image file picked by the user to the cache, returning its hash.
+// The file must be a JPEG, PNG or GIF of a sensible size; images larger
+// than MaxImageSize are scaled down first
+func (c *Cache) StoreFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+	if info.IsDir() {
+		return "", errors.New("not an image file")
+	}
+	if info.Size() > MaxFileSize {
+		return "", fmt.Errorf("image is too large (over %d MB)", MaxFileSize>>20)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", errors.New("not a JPEG, PNG or GIF image")
+	}
+	if config.Width < MinImageSize || config.Height < MinImageSize {
+		return "", fmt.Errorf("image is too small (at least %dx%d needed)", MinImageSize, MinImageSize)
+	}
+	if tooManyPixels(config) {
+		return "", fmt.Errorf("image is too large (over %d megapixels)", MaxPixels/1_000_000)
+	}
+
+	if config.Width > MaxImageSize || config.Height > MaxImageSize {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return "", fmt.Errorf("failed to decode image: %w", err)
+		}
+
+		// PNGs stay PNGs to keep any transparency
+		var buf bytes.Buffer
+		if format == "png" {
+			err = png.Encode(&buf, resize(img, MaxImageSize))
+		} else {
+			err = jpeg.Encode(&buf, resize(img, MaxImageSize), &jpeg.Options{Quality: thumbnailQuality})
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to encode image: %w", err)
+		}
+		data = buf.Bytes()
+	}
+
+	return c.Store(data)
+}
+
+// Gets an image's bytes and MIME type
+func (c *Cache) Read(hash string) ([]byte, string, error) {
+	if !c.Has(hash) {
+		return nil, "", fmt.Errorf("artwork %s not found", hash)
+	}
+
+	data, err := os.ReadFile(c.originalPath(hash))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read artwork: %w", err)
+	}
+
+	return data, http.DetectContentType(data), nil
+}
+
+// Reports whether an image is over the MaxPixels decoding budget
+func tooManyPixels(config image.Config) bool {
+	return int64(config.Width)*int64(config.Height) > MaxPixels
+}
@@ -0,0 +1,128 @@
+package artwork
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"os"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+// JPEG quality thumbnails are saved at
+const thumbnailQuality = 85
+
+// Gets the path of an image at (at least) the given size, making the
+// thumbnail if it doesn't exist yet. Sizes above the largest thumbnail, and
+// images already small enough or in formats that can't be decoded, use the
+// original. Images over MaxPixels are refused rather than decoded
+func (c *Cache) Thumbnail(hash string, size int) (string, error) {
+	if !c.Has(hash) {
+		return "", fmt.Errorf("artwork %s not found", hash)
+	}
+
+	original := c.originalPath(hash)
+
+	size = snapSize(size)
+	if size == 0 {
+		return original, nil
+	}
+
+	path := c.thumbnailPath(hash, size)
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+
+	data, err := os.ReadFile(original)
+	if err != nil {
+		return "", err
+	}
+
+	// Check the dimensions before decoding, which allocates for every pixel
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (config.Width <= size && config.Height <= size) {
+		return original, nil
+	}
+	if tooManyPixels(config) {
+		return "", fmt.Errorf("artwork %s is too large to thumbnail (%dx%d)", hash, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return original, nil
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, resize(img, size), &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return "", fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return "", fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+
+	return path, nil
+}
+
+// Rounds a requested size up to the nearest thumbnail size, or 0 for the
+// original
+func snapSize(size int) int {
+	if size <= 0 {
+		return 0
+	}
+
+	for _, s := range Sizes {
+		if size <= s {
+			return s
+		}
+	}
+	return 0
+}
+
+// Scales an image down so its longest side is size, averaging the source
+// pixels each output pixel covers
+func resize(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	dw, dh := size, size
+	if w > h {
+		dh = max(1, h*size/w)
+	} else {
+		dw = max(1, w*size/h)
+	}
+
+	// Converting once is far faster than calling At per pixel
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+
+			n := (y1 - y0) * (x1 - x0)
+			i := y*dst.Stride + x*4
+			for c := range sum {
+				dst.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+
+	return dst
+}
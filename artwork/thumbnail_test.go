@@ -0,0 +1,138 @@
+package artwork
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Encodes a solid PNG of the given size
+func testPNG(t *testing.T, w int, h int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Builds the start of a PNG claiming the given size, with no pixel data.
+// Enough for DecodeConfig, which is all an oversized image should get
+func pngHeader(w uint32, h uint32) []byte {
+	var ihdr bytes.Buffer
+	ihdr.WriteString("IHDR")
+	binary.Write(&ihdr, binary.BigEndian, []uint32{w, h})
+	ihdr.Write([]byte{8, 6, 0, 0, 0}) // 8 bit RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(ihdr.Len()-4))
+	buf.Write(ihdr.Bytes())
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(ihdr.Bytes()))
+	return buf.Bytes()
+}
+
+func TestThumbnail(t *testing.T) {
+	c, err := NewAt(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := func(data []byte) string {
+		hash, err := c.Store(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hash
+	}
+	large := store(testPNG(t, 1200, 600))
+	small := store(testPNG(t, 100, 100))
+	huge := store(pngHeader(20000, 20000))
+
+	tests := []struct {
+		name     string
+		hash     string
+		size     int
+		original bool
+		width    int // of the thumbnail made
+		fails    bool
+	}{
+		{"scaled down", large, Sizes[0], false, Sizes[0], false},
+		{"original size asked for", large, 0, true, 0, false},
+		{"already small enough", small, Sizes[len(Sizes)-1], true, 0, false},
+		{"too many pixels", huge, Sizes[0], false, 0, true},
+		{"not in the cache", "0000", Sizes[0], false, 0, true},
+	}
+
+	for _, test := range tests {
+		path, err := c.Thumbnail(test.hash, test.size)
+		if test.fails {
+			if err == nil {
+				t.Errorf("%s: got %s", test.name, path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		if test.original {
+			if path != c.originalPath(test.hash) {
+				t.Errorf("%s: got %s, want the original", test.name, path)
+			}
+			continue
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, _, err := image.DecodeConfig(f)
+		f.Close()
+		if err != nil || config.Width != test.width {
+			t.Errorf("%s: thumbnail is %dx%d, %v", test.name, config.Width, config.Height, err)
+		}
+	}
+}
+
+func TestStoreFileRejectsTooManyPixels(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewAt(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "huge.png")
+	if err := os.WriteFile(path, pngHeader(20000, 20000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := c.StoreFile(path); err == nil {
+		t.Errorf("stored %s", hash)
+	}
+
+	// Big but within budget is scaled down
+	if err := os.WriteFile(path, testPNG(t, 2000, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := c.StoreFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(c.originalPath(hash))
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != "png" || config.Width != MaxImageSize {
+		t.Errorf("stored image is a %dx%d %s, %v", config.Width, config.Height, format, err)
+	}
+}
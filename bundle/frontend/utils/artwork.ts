@@ -0,0 +1,9 @@
+import defaultArtwork from '@/assets/img/default_artwork.png';
+
+// Gets the URL of cached artwork by its hash, at (at least) the given size in pixels
+export function ArtworkUrl(hash: string | undefined, size?: number) {
+    if (!hash) {
+        return defaultArtwork;
+    }
+    return size ? `/art/${hash}?size=${size}` : `/art/${hash}`;
+}
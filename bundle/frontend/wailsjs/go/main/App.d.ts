@@ -34,6 +34,8 @@ export function PlayFile(arg1:string,arg2:number):Promise<void>;
 
 export function RecallBackupVariables():Promise<Record<string, any>>;
 
+export function RecordSongPlay(arg1:number):Promise<void>;
+
 export function Seek(arg1:number):Promise<void>;
 
 export function SelectAndPlayFile():Promise<void>;
@@ -66,6 +66,10 @@ export function RecallBackupVariables() {
   return window['go']['main']['App']['RecallBackupVariables']();
 }
 
+export function RecordSongPlay(arg1) {
+  return window['go']['main']['App']['RecordSongPlay'](arg1);
+}
+
 export function Seek(arg1) {
   return window['go']['main']['App']['Seek'](arg1);
 }
@@ -0,0 +1,128 @@
+package database
+
+import "fmt"
+
+// Where a picture of an album came from
+const (
+	ArtworkEmbedded = "embedded" // inside an audio file's tags
+	ArtworkFolder   = "folder"   // an image next to the audio files
+	ArtworkManual   = "manual"   // an image picked by the user
+)
+
+// A picture belonging to an album. Kind is one of the playback.Picture kinds
+// (front, back, artist, media, other) and Art its artwork cache hash
+type AlbumArtwork struct {
+	ID      int64
+	AlbumID int64
+	Kind    string
+	Art     string
+	Source  string
+}
+
+// Gets every picture stored for an album, front covers first
+func (db *DB) GetAlbumArtwork(albumID int64) ([]AlbumArtwork, error) {
+	rows, err := db.conn.Query(
+		"SELECT id, album_id, kind, art, source FROM album_artwork WHERE album_id = ? ORDER BY kind != 'front', id",
+		albumID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get album artwork: %w", err)
+	}
+	defer rows.Close()
+
+	artwork := []AlbumArtwork{}
+	for rows.Next() {
+		var a AlbumArtwork
+		if err := rows.Scan(&a.ID, &a.AlbumID, &a.Kind, &a.Art, &a.Source); err != nil {
+			return nil, fmt.Errorf("failed to scan album artwork: %w", err)
+		}
+		artwork = append(artwork, a)
+	}
+
+	return artwork, rows.Err()
+}
+
+// Gets albums whose art is still stored inline as a data: URI, by album ID
+func (db *DB) GetInlineAlbumArt() (map[int64]string, error) {
+	rows, err := db.conn.Query("SELECT id, art FROM albums WHERE art LIKE 'data:%'")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get album art: %w", err)
+	}
+	defer rows.Close()
+
+	art := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var uri string
+		if err := rows.Scan(&id, &uri); err != nil {
+			return nil, fmt.Errorf("failed to scan album art: %w", err)
+		}
+		art[id] = uri
+	}
+
+	return art, rows.Err()
+}
+
+// Sets an album's art (an artwork cache hash, or empty for none)
+func (db *DB) SetAlbumArt(albumID int64, art string) error {
+	_, err := db.conn.Exec("UPDATE albums SET art = ? WHERE id = ?", art, albumID)
+	if err != nil {
+		return fmt.Errorf("failed to set album art: %w", err)
+	}
+
+	return nil
+}
+
+// Sets an album's cover to a picked image, replacing any cover picked
+// before it in the album's pictures. An empty art clears the cover
+func (db *DB) SetAlbumCover(albumID int64, art string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to set album art: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM album_artwork WHERE album_id = ? AND kind = 'front' AND source = ?", albumID, ArtworkManual)
+	if err != nil {
+		return fmt.Errorf("failed to set album art: %w", err)
+	}
+
+	if art != "" {
+		_, err = tx.Exec(
+			"INSERT OR REPLACE INTO album_artwork (album_id, kind, art, source) VALUES (?, 'front', ?, ?)",
+			albumID, art, ArtworkManual,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to set album art: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE albums SET art = ? WHERE id = ?", art, albumID); err != nil {
+		return fmt.Errorf("failed to set album art: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to set album art: %w", err)
+	}
+
+	return nil
+}
+
+// Sets an artist's picture (an artwork cache hash, or empty for none)
+func (db *DB) SetArtistPicture(artistID int64, art string) error {
+	_, err := db.conn.Exec("UPDATE artists SET pfp = ? WHERE id = ?", art, artistID)
+	if err != nil {
+		return fmt.Errorf("failed to set artist picture: %w", err)
+	}
+
+	return nil
+}
+
+// Rebuilds the database file to reclaim space left by deleted data
+func (db *DB) Vacuum() error {
+	if _, err := db.conn.Exec("VACUUM"); err != nil {
+		return fmt.Errorf("failed to compact database: %w", err)
+	}
+
+	return nil
+}
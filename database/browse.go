@@ -0,0 +1,279 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Sorting and paging options for GetAlbums/GetArtists
+type BrowseQuery struct {
+	SortBy   string
+	SortDesc bool
+	Limit    int
+	Offset   int
+}
+
+// An album with aggregates over its tracks. Duration totals songs.duration,
+// which is only filled in for songs imported since the audio properties
+// migration (version 6), so older songs count as 0 until they're rescanned
+type AlbumSummary struct {
+	Album
+	ArtistName string
+	TrackCount int64
+	Duration   float64 // total, in seconds
+	YearFrom   int64
+	YearTo     int64
+}
+
+// An album along with its tracks in play order and all of its pictures
+type AlbumWithTracks struct {
+	AlbumSummary
+	Tracks  []SongWithDetails
+	Artwork []AlbumArtwork
+}
+
+// An artist with aggregates over their albums and songs, totalled the same
+// way as an AlbumSummary
+type ArtistSummary struct {
+	Artist
+	AlbumCount int64
+	TrackCount int64
+	Duration   float64 // total, in seconds
+	YearFrom   int64
+	YearTo     int64
+	Artwork    string
+}
+
+// An artist along with their albums
+type ArtistWithAlbums struct {
+	ArtistSummary
+	Albums []AlbumSummary
+}
+
+// One page of albums, along with how many there are in total
+type AlbumPage struct {
+	Albums []AlbumSummary
+	Total  int64
+}
+
+// One page of artists, along with how many there are in total
+type ArtistPage struct {
+	Artists []ArtistSummary
+	Total   int64
+}
+
+// Album columns and aggregates, in the order scanAlbumSummary expects them.
+// Missing years are stored as "0", so they're left out of the year span
+const albumSummarySelect = `
+	SELECT
+		albums.id,
+		albums.name,
+		COALESCE(albums.art, ''),
+		COALESCE(albums.artist_id, 0),
+		COALESCE(artists.name, '') AS artist_name,
+		COUNT(songs.id) AS track_count,
+		COALESCE(SUM(songs.duration), 0) AS duration,
+		COALESCE(MIN(NULLIF(CAST(songs.year AS INTEGER), 0)), 0) AS year_from,
+		COALESCE(MAX(NULLIF(CAST(songs.year AS INTEGER), 0)), 0) AS year_to
+	FROM albums
+	LEFT JOIN artists ON albums.artist_id = artists.id
+	LEFT JOIN songs ON songs.album_id = albums.id`
+
+// Artist columns and aggregates, in the order scanArtistSummary expects them.
+// Artwork is the artist's picture, or else an artist picture found with one
+// of their albums, or else the art of their biggest album
+const artistSummarySelect = `
+	SELECT
+		artists.id,
+		artists.name,
+		COALESCE(artists.pfp, ''),
+		(SELECT COUNT(*) FROM albums WHERE albums.artist_id = artists.id) AS album_count,
+		COUNT(songs.id) AS track_count,
+		COALESCE(SUM(songs.duration), 0) AS duration,
+		COALESCE(MIN(NULLIF(CAST(songs.year AS INTEGER), 0)), 0) AS year_from,
+		COALESCE(MAX(NULLIF(CAST(songs.year AS INTEGER), 0)), 0) AS year_to,
+		COALESCE(NULLIF(artists.pfp, ''), (
+			SELECT album_artwork.art FROM album_artwork
+			JOIN albums ON album_artwork.album_id = albums.id
+			WHERE albums.artist_id = artists.id AND album_artwork.kind = 'artist'
+			ORDER BY album_artwork.id
+			LIMIT 1
+		), (
+			SELECT albums.art FROM albums
+			WHERE albums.artist_id = artists.id AND COALESCE(albums.art, '') != ''
+			ORDER BY (SELECT COUNT(*) FROM songs s WHERE s.album_id = albums.id) DESC
+			LIMIT 1
+		), '') AS artwork
+	FROM artists
+	LEFT JOIN songs ON songs.artist_id = artists.id`
+
+// SQL expressions albums can be sorted by
+var albumSortFields = map[string]string{
+	"name":        "albums.name COLLATE NOCASE",
+	"artist":      "artist_name COLLATE NOCASE",
+	"year":        "year_from",
+	"track_count": "track_count",
+	"duration":    "duration",
+}
+
+// SQL expressions artists can be sorted by
+var artistSortFields = map[string]string{
+	"name":        "artists.name COLLATE NOCASE",
+	"album_count": "album_count",
+	"track_count": "track_count",
+	"duration":    "duration",
+}
+
+// Builds the ORDER BY/LIMIT/OFFSET part of a browse query
+func (q BrowseQuery) clause(sortFields map[string]string, defaultSort string, idColumn string) (string, []interface{}, error) {
+	sortExpr := sortFields[defaultSort]
+	if q.SortBy != "" {
+		expr, ok := sortFields[q.SortBy]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown sort field %q", q.SortBy)
+		}
+		sortExpr = expr
+	}
+
+	direction := "ASC"
+	if q.SortDesc {
+		direction = "DESC"
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	clause := " ORDER BY " + sortExpr + " " + direction + ", " + idColumn + " " + direction + " LIMIT ? OFFSET ?"
+	return clause, []interface{}{limit, max(q.Offset, 0)}, nil
+}
+
+func scanAlbumSummary(row rowScanner) (AlbumSummary, error) {
+	var a AlbumSummary
+	err := row.Scan(&a.ID, &a.Name, &a.Art, &a.Artist_ID, &a.ArtistName, &a.TrackCount, &a.Duration, &a.YearFrom, &a.YearTo)
+	return a, err
+}
+
+func scanArtistSummary(row rowScanner) (ArtistSummary, error) {
+	var a ArtistSummary
+	err := row.Scan(&a.ID, &a.Name, &a.PFP, &a.AlbumCount, &a.TrackCount, &a.Duration, &a.YearFrom, &a.YearTo, &a.Artwork)
+	return a, err
+}
+
+// Runs an album summary query and scans every row
+func (db *DB) queryAlbumSummaries(query string, args ...interface{}) ([]AlbumSummary, error) {
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get albums: %w", err)
+	}
+	defer rows.Close()
+
+	albums := []AlbumSummary{}
+	for rows.Next() {
+		a, err := scanAlbumSummary(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan album: %w", err)
+		}
+		albums = append(albums, a)
+	}
+
+	return albums, rows.Err()
+}
+
+// Gets a page of albums with their aggregates
+func (db *DB) GetAlbums(q BrowseQuery) (*AlbumPage, error) {
+	clause, args, err := q.clause(albumSortFields, "name", "albums.id")
+	if err != nil {
+		return nil, err
+	}
+
+	page := &AlbumPage{}
+	if err := db.conn.QueryRow("SELECT COUNT(*) FROM albums").Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("failed to count albums: %w", err)
+	}
+
+	page.Albums, err = db.queryAlbumSummaries(albumSummarySelect+" GROUP BY albums.id"+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// Gets an album with its aggregates and tracks
+func (db *DB) GetAlbum(id int64) (*AlbumWithTracks, error) {
+	summary, err := scanAlbumSummary(db.conn.QueryRow(albumSummarySelect+" WHERE albums.id = ? GROUP BY albums.id", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("album with ID %d not found", id)
+		}
+		return nil, err
+	}
+
+	rows, err := db.conn.Query("SELECT "+songDetailsColumns+" FROM songs"+songDetailsJoins+" WHERE songs.album_id = ? ORDER BY songs.disc_number, songs.track_number, songs.id", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get album tracks: %w", err)
+	}
+	defer rows.Close()
+
+	tracks, err := scanSongsWithDetails(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	artwork, err := db.GetAlbumArtwork(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AlbumWithTracks{AlbumSummary: summary, Tracks: tracks, Artwork: artwork}, nil
+}
+
+// Gets a page of artists with their aggregates
+func (db *DB) GetArtists(q BrowseQuery) (*ArtistPage, error) {
+	clause, args, err := q.clause(artistSortFields, "name", "artists.id")
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ArtistPage{Artists: []ArtistSummary{}}
+	if err := db.conn.QueryRow("SELECT COUNT(*) FROM artists").Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("failed to count artists: %w", err)
+	}
+
+	rows, err := db.conn.Query(artistSummarySelect+" GROUP BY artists.id"+clause, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get artists: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanArtistSummary(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan artist: %w", err)
+		}
+		page.Artists = append(page.Artists, a)
+	}
+
+	return page, rows.Err()
+}
+
+// Gets an artist with their aggregates and albums (oldest first)
+func (db *DB) GetArtist(id int64) (*ArtistWithAlbums, error) {
+	summary, err := scanArtistSummary(db.conn.QueryRow(artistSummarySelect+" WHERE artists.id = ? GROUP BY artists.id", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("artist with ID %d not found", id)
+		}
+		return nil, err
+	}
+
+	albums, err := db.queryAlbumSummaries(albumSummarySelect+" WHERE albums.artist_id = ? GROUP BY albums.id ORDER BY year_from, albums.name COLLATE NOCASE", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ArtistWithAlbums{ArtistSummary: summary, Albums: albums}, nil
+}
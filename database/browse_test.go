@@ -0,0 +1,74 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+)
+
+func TestBrowseAggregates(t *testing.T) {
+	db := openTestDB(t)
+
+	artistID, err := db.CreateArtist(Artist{Name: "Artist"})
+	if err != nil {
+		t.Fatalf("failed to create artist: %v", err)
+	}
+
+	albums := []struct {
+		name      string
+		years     []string
+		durations []float64
+	}{
+		{"First", []string{"1999", "2001", ""}, []float64{60.5, 120.25, 30}},
+		{"Second", []string{"2005"}, []float64{200}},
+	}
+
+	var albumIDs []int64
+	for _, album := range albums {
+		albumID, err := db.CreateAlbum(Album{Name: album.name, Artist_ID: artistID})
+		if err != nil {
+			t.Fatalf("failed to create album: %v", err)
+		}
+		albumIDs = append(albumIDs, albumID)
+
+		for i, duration := range album.durations {
+			year := album.years[i]
+			_, err := db.CreateSong(Song{
+				Path:      fmt.Sprintf("/music/%s/%d.mp3", album.name, i),
+				Artist_ID: sql.NullInt64{Int64: artistID, Valid: true},
+				Album_ID:  sql.NullInt64{Int64: albumID, Valid: true},
+				Year:      sql.NullString{String: year, Valid: year != ""},
+				Duration:  duration,
+			})
+			if err != nil {
+				t.Fatalf("failed to create song: %v", err)
+			}
+		}
+	}
+
+	album, err := db.GetAlbum(albumIDs[0])
+	if err != nil {
+		t.Fatalf("failed to get album: %v", err)
+	}
+	if album.TrackCount != 3 || album.Duration != 210.75 || album.YearFrom != 1999 || album.YearTo != 2001 {
+		t.Errorf("album has %d tracks, %v seconds, years %d-%d", album.TrackCount, album.Duration, album.YearFrom, album.YearTo)
+	}
+
+	artist, err := db.GetArtist(artistID)
+	if err != nil {
+		t.Fatalf("failed to get artist: %v", err)
+	}
+	if artist.AlbumCount != 2 || artist.TrackCount != 4 || artist.Duration != 410.75 || artist.YearFrom != 1999 || artist.YearTo != 2005 {
+		t.Errorf("artist has %d albums, %d tracks, %v seconds, years %d-%d",
+			artist.AlbumCount, artist.TrackCount, artist.Duration, artist.YearFrom, artist.YearTo)
+	}
+
+	// Longest album first
+	page, err := db.GetAlbums(BrowseQuery{SortBy: "duration", SortDesc: true})
+	if err != nil {
+		t.Fatalf("failed to get albums: %v", err)
+	}
+	if page.Total != 2 || len(page.Albums) != 2 || page.Albums[0].ID != albumIDs[0] {
+		t.Errorf("albums by duration are %+v", page.Albums)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -12,19 +13,37 @@ import (
 // Wrapper for SQLite operations
 type DB struct {
 	conn *sql.DB
+
+	// Whether the search index exists, see ensureSearchIndex
+	searchable bool
 }
 
 // Represents a song in the database
 type Song struct {
-	ID        int64
-	Path      string
-	Title     string
-	Artist_ID sql.NullInt64
-	Album_ID  sql.NullInt64
-	Composer  sql.NullString
-	Comment   sql.NullString
-	Genre     sql.NullString
-	Year      sql.NullString
+	ID          int64
+	Path        string
+	Title       string
+	Artist_ID   sql.NullInt64
+	Album_ID    sql.NullInt64
+	Composer    sql.NullString
+	Comment     sql.NullString
+	Genre       sql.NullString
+	Year        sql.NullString
+	PlayCount   int64
+	TrackNumber int64
+	TrackTotal  int64
+	DiscNumber  int64
+	DiscTotal   int64
+	Duration    float64 // seconds
+	SampleRate  int64
+	BitDepth    int64
+	Channels    int64
+	Bitrate     int64 // kbps
+	Codec       string
+	FileSize    int64
+	ModTime     int64  // unix seconds
+	ContentHash string // SHA-256 of the file, empty until something needed it
+	Missing     bool   // file was gone at the last rescan
 }
 
 // Represents an artist in the database
@@ -38,17 +57,18 @@ type Artist struct {
 type Album struct {
 	ID        int64
 	Name      string
-	Art       string
+	Art       string // hash in the artwork cache
 	Artist_ID int64
 }
 
 // Represents a song with album/artist name and details
 type SongWithDetails struct {
 	Song
-	ArtistName sql.NullString
-	ArtistPFP  sql.NullString
-	AlbumName  sql.NullString
-	AlbumArt   sql.NullString
+	ArtistName      sql.NullString
+	ArtistPFP       sql.NullString
+	AlbumName       sql.NullString
+	AlbumArt        sql.NullString
+	AlbumArtistName sql.NullString
 }
 
 // Represents a playlist in the database
@@ -83,8 +103,19 @@ type PlaylistEntryWithSong struct {
 
 // Represents a playlist with entries (with songs) included
 type PlaylistWithSongs struct {
-	Playlist Playlist
-	Entries  []PlaylistEntryWithSong
+	Playlist      Playlist
+	Entries       []PlaylistEntryWithSong
+	TotalDuration float64 // seconds
+}
+
+// Represents a saved internet radio station
+type RadioStation struct {
+	ID           int64
+	Name         string
+	URL          string
+	Homepage     string
+	Picture      string
+	FallbackURLs []string
 }
 
 // Gather where the database should be
@@ -123,79 +154,35 @@ func NewDB() (*DB, error) {
 		file.Close()
 	}
 
-	// Begin connection
-	conn, err := sql.Open("sqlite3", dbPath)
+	return openDB(dbPath)
+}
+
+// Opens a database (a file path, or ":memory:") and brings its schema up
+// to date
+func openDB(dsn string) (*DB, error) {
+	conn, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Create tables if they don't exist
-	createTables := `
-    CREATE TABLE IF NOT EXISTS songs (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		path TEXT NOT NULL,
-		title TEXT,
-		artist_id INTEGER,
-		album_id INTEGER,
-		composer TEXT,
-		comment TEXT,
-		genre TEXT,
-		year TEXT,
-		FOREIGN KEY (artist_id) REFERENCES artists(id),
-		FOREIGN KEY (album_id) REFERENCES albums(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS artists (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		pfp TEXT
-	);
-
-	CREATE TABLE IF NOT EXISTS albums (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		art TEXT,
-		artist_id INTEGER,
-		FOREIGN KEY (artist_id) REFERENCES artists(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS tags (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL UNIQUE
-	);
-
-	CREATE TABLE IF NOT EXISTS tag_values (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		tag_id INTEGER,
-		value TEXT,
-		song_id INTEGER,
-		FOREIGN KEY (tag_id) REFERENCES tags(id),
-		FOREIGN KEY (song_id) REFERENCES songs(id)
-	);
-
-	CREATE TABLE IF NOT EXISTS playlists (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT,
-		description TEXT,
-		picture TEXT
-	);
-
-	CREATE TABLE IF NOT EXISTS playlist_entries (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		playlist_id INTEGER,
-		song_id INTEGER,
-		list_order INTEGER,
-		FOREIGN KEY (playlist_id) REFERENCES playlists(id),
-		FOREIGN KEY (song_id) REFERENCES songs(id)
-	);
-	`
-
-	// If table creation fails
-	if _, err = conn.Exec(createTables); err != nil {
-		return nil, fmt.Errorf("failed to create table: %w", err)
-	}
-
-	return &DB{conn: conn}, nil
+	// Every connection to :memory: would get its own empty database
+	if dsn == ":memory:" {
+		conn.SetMaxOpenConns(1)
+	}
+
+	// Bring the schema up to date
+	if err := migrate(conn, dsn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	searchable, err := ensureSearchIndex(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &DB{conn: conn, searchable: searchable}, nil
 }
 
 // Closes the database connection
@@ -203,11 +190,24 @@ func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
+// Runs statements on either the connection or a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // Inserts a new song into the database
 func (db *DB) CreateSong(song Song) (int64, error) {
-	result, err := db.conn.Exec(
-		"INSERT INTO songs (path, title, artist_id, album_id, composer, comment, genre, year) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+	return createSong(db.conn, song)
+}
+
+func createSong(ex execer, song Song) (int64, error) {
+	result, err := ex.Exec(
+		"INSERT INTO songs (path, title, artist_id, album_id, composer, comment, genre, year, track_number, track_total, disc_number, disc_total, duration, sample_rate, bit_depth, channels, bitrate, codec, file_size, mod_time, content_hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
 		song.Path, song.Title, song.Artist_ID, song.Album_ID, song.Composer, song.Comment, song.Genre, song.Year,
+		song.TrackNumber, song.TrackTotal, song.DiscNumber, song.DiscTotal,
+		song.Duration, song.SampleRate, song.BitDepth, song.Channels, song.Bitrate, song.Codec, song.FileSize, song.ModTime,
+		song.ContentHash,
 	)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create song: %w", err)
@@ -216,6 +216,42 @@ func (db *DB) CreateSong(song Song) (int64, error) {
 	return result.LastInsertId()
 }
 
+// Rewrites a song's tags and file details in place, keeping its ID (and so
+// its playlist entries) and play count. Clears the missing flag
+func (db *DB) UpdateSong(song Song) error {
+	return updateSong(db.conn, song)
+}
+
+func updateSong(ex execer, song Song) error {
+	// A fingerprint is only kept while the file's contents are known to be
+	// the same. Files aren't always hashed, and an empty hash proves nothing
+	_, err := ex.Exec(
+		"DELETE FROM song_fingerprints WHERE song_id = ? AND (? = '' OR (SELECT content_hash FROM songs WHERE id = ?) != ?)",
+		song.ID, song.ContentHash, song.ID, song.ContentHash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update song: %w", err)
+	}
+
+	_, err = ex.Exec(`
+		UPDATE songs SET
+			path = ?, title = ?, artist_id = ?, album_id = ?, composer = ?, comment = ?, genre = ?, year = ?,
+			track_number = ?, track_total = ?, disc_number = ?, disc_total = ?,
+			duration = ?, sample_rate = ?, bit_depth = ?, channels = ?, bitrate = ?, codec = ?, file_size = ?, mod_time = ?,
+			content_hash = ?, missing = 0
+		WHERE id = ?`,
+		song.Path, song.Title, song.Artist_ID, song.Album_ID, song.Composer, song.Comment, song.Genre, song.Year,
+		song.TrackNumber, song.TrackTotal, song.DiscNumber, song.DiscTotal,
+		song.Duration, song.SampleRate, song.BitDepth, song.Channels, song.Bitrate, song.Codec, song.FileSize, song.ModTime,
+		song.ContentHash, song.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update song: %w", err)
+	}
+
+	return nil
+}
+
 // Inserts a new artist into the database
 func (db *DB) CreateArtist(artist Artist) (int64, error) {
 	result, err := db.conn.Exec(
@@ -298,10 +334,102 @@ func (db *DB) CreateAlbum(album Album) (int64, error) {
 	return result.LastInsertId()
 }
 
+// Anything rows can be scanned from (*sql.Row or *sql.Rows)
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Columns selected for a Song, in the order scanSong expects them
+const songColumns = `
+	songs.id,
+	songs.path,
+	COALESCE(songs.title, ''),
+	songs.artist_id,
+	songs.album_id,
+	songs.composer,
+	songs.comment,
+	songs.genre,
+	songs.year,
+	songs.play_count,
+	songs.track_number,
+	songs.track_total,
+	songs.disc_number,
+	songs.disc_total,
+	songs.duration,
+	songs.sample_rate,
+	songs.bit_depth,
+	songs.channels,
+	songs.bitrate,
+	songs.codec,
+	songs.file_size,
+	songs.mod_time,
+	songs.content_hash,
+	songs.missing`
+
+// Columns selected for a SongWithDetails, used with songDetailsJoins
+const songDetailsColumns = songColumns + `,
+	COALESCE(artists.name, '') AS artist_name,
+	COALESCE(artists.pfp, '') AS artist_pfp,
+	COALESCE(albums.name, '') AS album_name,
+	COALESCE(albums.art, '') AS album_art,
+	COALESCE(album_artists.name, '') AS album_artist_name`
+
+// Joins needed by songDetailsColumns
+const songDetailsJoins = `
+	LEFT JOIN artists ON songs.artist_id = artists.id
+	LEFT JOIN albums ON songs.album_id = albums.id
+	LEFT JOIN artists AS album_artists ON albums.artist_id = album_artists.id`
+
+// Scan destinations for songColumns
+func songScanDest(s *Song) []interface{} {
+	return []interface{}{
+		&s.ID,
+		&s.Path,
+		&s.Title,
+		&s.Artist_ID,
+		&s.Album_ID,
+		&s.Composer,
+		&s.Comment,
+		&s.Genre,
+		&s.Year,
+		&s.PlayCount,
+		&s.TrackNumber,
+		&s.TrackTotal,
+		&s.DiscNumber,
+		&s.DiscTotal,
+		&s.Duration,
+		&s.SampleRate,
+		&s.BitDepth,
+		&s.Channels,
+		&s.Bitrate,
+		&s.Codec,
+		&s.FileSize,
+		&s.ModTime,
+		&s.ContentHash,
+		&s.Missing,
+	}
+}
+
+// Scans a row selected with songColumns
+func scanSong(row rowScanner) (Song, error) {
+	var s Song
+	err := row.Scan(songScanDest(&s)...)
+	return s, err
+}
+
+// Scans a row selected with songDetailsColumns. Any leading columns
+// (e.g. playlist entry fields) are scanned into leading first
+func scanSongWithDetails(row rowScanner, leading ...interface{}) (SongWithDetails, error) {
+	var s SongWithDetails
+	dest := append(leading, songScanDest(&s.Song)...)
+	dest = append(dest, &s.ArtistName, &s.ArtistPFP, &s.AlbumName, &s.AlbumArt, &s.AlbumArtistName)
+	err := row.Scan(dest...)
+	return s, err
+}
+
 // Retrieves song by ID
 func (db *DB) GetSongById(id int64) (Song, error) {
-	var song Song
-	err := db.conn.QueryRow("SELECT * FROM songs WHERE id = ?", id).Scan(&song.ID, &song.Path, &song.Title, &song.Album_ID, &song.Artist_ID, &song.Composer, &song.Comment, &song.Genre, &song.Year)
+	song, err := scanSong(db.conn.QueryRow("SELECT "+songColumns+" FROM songs WHERE id = ?", id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Song{}, fmt.Errorf("song with ID %d not found", id)
@@ -314,8 +442,7 @@ func (db *DB) GetSongById(id int64) (Song, error) {
 
 // Retrieves a song by file path
 func (db *DB) GetSongByPath(path string) (Song, error) {
-	var song Song
-	err := db.conn.QueryRow("SELECT * FROM songs WHERE path = ?", path).Scan(&song.ID, &song.Path, &song.Title, &song.Album_ID, &song.Artist_ID, &song.Composer, &song.Comment, &song.Genre, &song.Year)
+	song, err := scanSong(db.conn.QueryRow("SELECT "+songColumns+" FROM songs WHERE path = ?", path))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Song{}, fmt.Errorf("song with path %s not found", path)
@@ -328,7 +455,7 @@ func (db *DB) GetSongByPath(path string) (Song, error) {
 
 // Retrieves all songs from the database
 func (db *DB) GetSongs() ([]Song, error) {
-	rows, err := db.conn.Query("SELECT * FROM songs")
+	rows, err := db.conn.Query("SELECT " + songColumns + " FROM songs")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get songs: %w", err)
 	}
@@ -336,8 +463,8 @@ func (db *DB) GetSongs() ([]Song, error) {
 
 	var songs []Song
 	for rows.Next() {
-		var s Song
-		if err := rows.Scan(&s.ID, &s.Path, &s.Title, &s.Artist_ID, &s.Album_ID, &s.Composer, &s.Comment, &s.Genre, &s.Year); err != nil {
+		s, err := scanSong(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan song: %w", err)
 		}
 		songs = append(songs, s)
@@ -346,63 +473,205 @@ func (db *DB) GetSongs() ([]Song, error) {
 	return songs, nil
 }
 
-// Removes a song by ID
+// Retrieves every song whose file is inside a folder (at any depth)
+func (db *DB) GetSongsInFolder(folder string) ([]Song, error) {
+	prefix := strings.TrimRight(folder, `/\`) + string(filepath.Separator)
+
+	// substr rather than LIKE, which would ignore case and treat _ and % as wildcards
+	rows, err := db.conn.Query("SELECT "+songColumns+" FROM songs WHERE substr(path, 1, length(?1)) = ?1", prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get songs in folder: %w", err)
+	}
+	defer rows.Close()
+
+	var songs []Song
+	for rows.Next() {
+		s, err := scanSong(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan song: %w", err)
+		}
+		songs = append(songs, s)
+	}
+
+	return songs, rows.Err()
+}
+
+// Retrieves every song whose file was gone at the last rescan
+func (db *DB) GetMissingSongs() ([]Song, error) {
+	rows, err := db.conn.Query("SELECT " + songColumns + " FROM songs WHERE missing = 1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get missing songs: %w", err)
+	}
+	defer rows.Close()
+
+	var songs []Song
+	for rows.Next() {
+		s, err := scanSong(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan song: %w", err)
+		}
+		songs = append(songs, s)
+	}
+
+	return songs, rows.Err()
+}
+
+// Flags a song whose file has disappeared (or reappeared)
+func (db *DB) SetSongMissing(id int64, missing bool) error {
+	_, err := db.conn.Exec("UPDATE songs SET missing = ? WHERE id = ?", missing, id)
+	if err != nil {
+		return fmt.Errorf("failed to update song: %w", err)
+	}
+
+	return nil
+}
+
+// Retrieves every song on an album
+func (db *DB) GetSongsInAlbum(albumID int64) ([]Song, error) {
+	rows, err := db.conn.Query("SELECT "+songColumns+" FROM songs WHERE album_id = ?", albumID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get album songs: %w", err)
+	}
+	defer rows.Close()
+
+	var songs []Song
+	for rows.Next() {
+		s, err := scanSong(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan song: %w", err)
+		}
+		songs = append(songs, s)
+	}
+
+	return songs, rows.Err()
+}
+
+// Stores the content hash computed for a song's file
+func (db *DB) SetSongContentHash(id int64, hash string) error {
+	_, err := db.conn.Exec("UPDATE songs SET content_hash = ? WHERE id = ?", hash, id)
+	if err != nil {
+		return fmt.Errorf("failed to update song: %w", err)
+	}
+
+	return nil
+}
+
+// Stores a song's file details after its tags were rewritten. The audio is
+// unchanged, so its fingerprint is kept
+func (db *DB) SetSongFile(id int64, size int64, modTime int64, hash string) error {
+	_, err := db.conn.Exec(
+		"UPDATE songs SET file_size = ?, mod_time = ?, content_hash = ? WHERE id = ?",
+		size, modTime, hash, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update song: %w", err)
+	}
+
+	return nil
+}
+
+// Removes a song by ID, taking it out of every playlist (closing the gaps
+// it leaves) along with its tags and fingerprint
 func (db *DB) DeleteSong(id int64) error {
-	_, err := db.conn.Exec("DELETE FROM songs WHERE id = ?", id)
-	return err
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT DISTINCT playlist_id FROM playlist_entries WHERE song_id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to get playlist entries: %w", err)
+	}
+	var playlistIDs []int64
+	for rows.Next() {
+		var playlistID int64
+		if err := rows.Scan(&playlistID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan playlist entry: %w", err)
+		}
+		playlistIDs = append(playlistIDs, playlistID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get playlist entries: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM playlist_entries WHERE song_id = ?", id); err != nil {
+		return fmt.Errorf("failed to remove playlist entries: %w", err)
+	}
+
+	for _, playlistID := range playlistIDs {
+		entryIDs, err := playlistEntryIDs(tx, playlistID)
+		if err != nil {
+			return err
+		}
+		if err := writePlaylistOrder(tx, entryIDs); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM tag_values WHERE song_id = ?", id); err != nil {
+		return fmt.Errorf("failed to remove song tags: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM song_fingerprints WHERE song_id = ?", id); err != nil {
+		return fmt.Errorf("failed to remove song fingerprint: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM songs WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete song: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Adds one to a song's play count
+func (db *DB) IncrementPlayCount(id int64) error {
+	_, err := db.conn.Exec("UPDATE songs SET play_count = play_count + 1 WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to update play count: %w", err)
+	}
+
+	return nil
 }
 
 // Retrieves a song with details (album name/art, artist name/pfp)
 func (db *DB) GetSongsWithDetails() ([]SongWithDetails, error) {
-	query := `
-        SELECT 
-            songs.id,
-            songs.path,
-            songs.title,
-            songs.artist_id,
-            songs.album_id,
-            songs.composer,
-            songs.comment,
-            songs.genre,
-            songs.year,
-            COALESCE(artists.name, '') AS artist_name,
-            COALESCE(artists.pfp, '') AS artist_pfp,
-            COALESCE(albums.name, '') AS album_name,
-            COALESCE(albums.art, '') AS album_art
-        FROM songs
-        LEFT JOIN artists ON songs.artist_id = artists.id
-        LEFT JOIN albums ON songs.album_id = albums.id
-    `
-	rows, err := db.conn.Query(query)
+	rows, err := db.conn.Query("SELECT " + songDetailsColumns + " FROM songs" + songDetailsJoins)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get songs (w/ details): %w", err)
 	}
 	defer rows.Close()
 
+	return scanSongsWithDetails(rows)
+}
+
+// Retrieves one song with details (album name/art, artist name/pfp)
+func (db *DB) GetSongWithDetails(id int64) (SongWithDetails, error) {
+	song, err := scanSongWithDetails(db.conn.QueryRow("SELECT "+songDetailsColumns+" FROM songs"+songDetailsJoins+" WHERE songs.id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return SongWithDetails{}, fmt.Errorf("song with ID %d not found", id)
+		}
+		return SongWithDetails{}, err
+	}
+
+	return song, nil
+}
+
+// Scans every row of a songDetailsColumns query
+func scanSongsWithDetails(rows *sql.Rows) ([]SongWithDetails, error) {
 	var songs []SongWithDetails
 	for rows.Next() {
-		var s SongWithDetails
-		err := rows.Scan(
-			&s.ID,
-			&s.Path,
-			&s.Title,
-			&s.Artist_ID,
-			&s.Album_ID,
-			&s.Composer,
-			&s.Comment,
-			&s.Genre,
-			&s.Year,
-			&s.ArtistName,
-			&s.ArtistPFP,
-			&s.AlbumName,
-			&s.AlbumArt,
-		)
+		s, err := scanSongWithDetails(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan song details: %w", err)
 		}
 		songs = append(songs, s)
 	}
-	return songs, nil
+
+	return songs, rows.Err()
 }
 
 /// ===========
@@ -424,7 +693,7 @@ func (db *DB) CreatePlaylist(playlist Playlist) (int64, error) {
 
 // Gets all playlists
 func (db *DB) GetPlaylists() ([]Playlist, error) {
-	rows, err := db.conn.Query("SELECT * FROM playlists")
+	rows, err := db.conn.Query("SELECT id, COALESCE(name, ''), COALESCE(description, ''), COALESCE(picture, '') FROM playlists")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get playlists: %w", err)
 	}
@@ -442,6 +711,147 @@ func (db *DB) GetPlaylists() ([]Playlist, error) {
 	return playlists, nil
 }
 
+// Retrieves a playlist by ID
+func (db *DB) GetPlaylistById(id int64) (Playlist, error) {
+	var playlist Playlist
+	err := db.conn.QueryRow(
+		"SELECT id, COALESCE(name, ''), COALESCE(description, ''), COALESCE(picture, '') FROM playlists WHERE id = ?", id,
+	).Scan(&playlist.ID, &playlist.Name, &playlist.Description, &playlist.Picture)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Playlist{}, fmt.Errorf("playlist with ID %d not found", id)
+		}
+		return Playlist{}, err
+	}
+
+	return playlist, nil
+}
+
+// Updates a playlist's name, description and picture
+func (db *DB) UpdatePlaylist(playlist Playlist) error {
+	_, err := db.conn.Exec(
+		"UPDATE playlists SET name = ?, description = ?, picture = ? WHERE id = ?",
+		playlist.Name, playlist.Description, playlist.Picture, playlist.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update playlist: %w", err)
+	}
+
+	return nil
+}
+
+// Renames a playlist
+func (db *DB) RenamePlaylist(id int64, name string) error {
+	_, err := db.conn.Exec("UPDATE playlists SET name = ? WHERE id = ?", name, id)
+	if err != nil {
+		return fmt.Errorf("failed to rename playlist: %w", err)
+	}
+
+	return nil
+}
+
+// Sets a playlist's picture
+func (db *DB) SetPlaylistPicture(id int64, picture string) error {
+	_, err := db.conn.Exec("UPDATE playlists SET picture = ? WHERE id = ?", picture, id)
+	if err != nil {
+		return fmt.Errorf("failed to set playlist picture: %w", err)
+	}
+
+	return nil
+}
+
+// Removes a playlist along with all of its entries
+func (db *DB) DeletePlaylist(id int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM playlist_entries WHERE playlist_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete playlist entries: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM playlists WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete playlist: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Copies a playlist and its entries into a new playlist, returning the new ID
+func (db *DB) DuplicatePlaylist(id int64) (int64, error) {
+	playlist, err := db.GetPlaylistById(id)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO playlists (name, description, picture) VALUES (?, ?, ?)",
+		playlist.Name+" (Copy)", playlist.Description, playlist.Picture,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to duplicate playlist: %w", err)
+	}
+
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO playlist_entries (playlist_id, song_id, list_order)
+		SELECT ?, song_id, list_order FROM playlist_entries WHERE playlist_id = ?
+		ORDER BY list_order, id`,
+		newID, id,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to duplicate playlist entries: %w", err)
+	}
+
+	return newID, tx.Commit()
+}
+
+// Creates a playlist holding the given songs in order, all in one
+// transaction so a failure leaves no half-filled playlist behind
+func (db *DB) CreatePlaylistWithSongs(playlist Playlist, songIDs []int64) (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO playlists (name, description, picture) VALUES (?, ?, ?)",
+		playlist.Name, playlist.Description, playlist.Picture,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create playlist: %w", err)
+	}
+
+	playlistID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, songID := range songIDs {
+		_, err := tx.Exec(
+			"INSERT INTO playlist_entries (playlist_id, song_id, list_order) VALUES (?, ?, ?)",
+			playlistID, songID, i,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to add song to playlist: %w", err)
+		}
+	}
+
+	return playlistID, tx.Commit()
+}
+
 // Inserts a new playlist entry into the database
 func (db *DB) CreatePlaylistEntry(pe PlaylistEntry) (int64, error) {
 	result, err := db.conn.Exec(
@@ -449,47 +859,150 @@ func (db *DB) CreatePlaylistEntry(pe PlaylistEntry) (int64, error) {
 		pe.Playlist_ID, pe.Song_ID, pe.ListOrder,
 	)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create playlist: %w", err)
+		return 0, fmt.Errorf("failed to create playlist entry: %w", err)
 	}
 
 	return result.LastInsertId()
 }
 
+// Appends a song to the end of a playlist
+func (db *DB) AddSongToPlaylist(playlistID int64, songID int64) (int64, error) {
+	result, err := db.conn.Exec(`
+		INSERT INTO playlist_entries (playlist_id, song_id, list_order)
+		VALUES (?, ?, (SELECT COALESCE(MAX(list_order) + 1, 0) FROM playlist_entries WHERE playlist_id = ?))`,
+		playlistID, songID, playlistID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add song to playlist: %w", err)
+	}
+
+	return result.LastInsertId()
+}
+
+// Removes an entry from its playlist and closes the gap it leaves
+func (db *DB) RemovePlaylistEntry(entryID int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var playlistID int64
+	err = tx.QueryRow("SELECT playlist_id FROM playlist_entries WHERE id = ?", entryID).Scan(&playlistID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("playlist entry with ID %d not found", entryID)
+		}
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM playlist_entries WHERE id = ?", entryID); err != nil {
+		return fmt.Errorf("failed to remove playlist entry: %w", err)
+	}
+
+	entryIDs, err := playlistEntryIDs(tx, playlistID)
+	if err != nil {
+		return err
+	}
+
+	if err := writePlaylistOrder(tx, entryIDs); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Moves an entry to a new (zero based) position in its playlist, shifting the others around it
+func (db *DB) MovePlaylistEntry(entryID int64, newIndex int) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var playlistID int64
+	err = tx.QueryRow("SELECT playlist_id FROM playlist_entries WHERE id = ?", entryID).Scan(&playlistID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("playlist entry with ID %d not found", entryID)
+		}
+		return err
+	}
+
+	entryIDs, err := playlistEntryIDs(tx, playlistID)
+	if err != nil {
+		return err
+	}
+
+	// Take the entry out and put it back at its new index
+	var reordered []int64
+	for _, id := range entryIDs {
+		if id != entryID {
+			reordered = append(reordered, id)
+		}
+	}
+	newIndex = max(0, min(newIndex, len(reordered)))
+	reordered = append(reordered[:newIndex], append([]int64{entryID}, reordered[newIndex:]...)...)
+
+	if err := writePlaylistOrder(tx, reordered); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Gets the entry IDs of a playlist in their current order
+func playlistEntryIDs(tx *sql.Tx, playlistID int64) ([]int64, error) {
+	rows, err := tx.Query("SELECT id FROM playlist_entries WHERE playlist_id = ? ORDER BY list_order, id", playlistID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get playlist entries: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan playlist entry: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// Rewrites list_order as 0..n-1 following the given entry order
+func writePlaylistOrder(tx *sql.Tx, entryIDs []int64) error {
+	stmt, err := tx.Prepare("UPDATE playlist_entries SET list_order = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, id := range entryIDs {
+		if _, err := stmt.Exec(i, id); err != nil {
+			return fmt.Errorf("failed to reorder playlist: %w", err)
+		}
+	}
+
+	return nil
+}
+
 // Gets a playlist with all of its song entries
 func (db *DB) GetPlaylistWithSongs(playlistID int64) (*PlaylistWithSongs, error) {
-	var playlist Playlist
-
 	// Fetch playlist metadata
-	err := db.conn.QueryRow(`
-		SELECT ID, Name, Description, Picture
-		FROM Playlists
-		WHERE ID = ?`, playlistID).Scan(
-		&playlist.ID,
-		&playlist.Name,
-		&playlist.Description,
-		&playlist.Picture,
-	)
+	playlist, err := db.GetPlaylistById(playlistID)
 	if err != nil {
 		return nil, err
 	}
 
 	// Fetch playlist entries with detailed song info
 	rows, err := db.conn.Query(`
-		SELECT 
-			pe.ID, pe.Playlist_ID, pe.ListOrder,
-
-			s.ID, s.Path, s.Title, s.Artist_ID, s.Album_ID,
-			s.Composer, s.Comment, s.Genre, s.Year,
-
-			ar.Name AS ArtistName, ar.PFP AS ArtistPFP,
-			al.Name AS AlbumName, al.Art AS AlbumArt
-
-		FROM PlaylistEntries pe
-		JOIN Songs s ON pe.Song_ID = s.ID
-		LEFT JOIN Artists ar ON s.Artist_ID = ar.ID
-		LEFT JOIN Albums al ON s.Album_ID = al.ID
-		WHERE pe.Playlist_ID = ?
-		ORDER BY pe.ListOrder
+		SELECT pe.id, pe.playlist_id, pe.list_order, `+songDetailsColumns+`
+		FROM playlist_entries pe
+		JOIN songs ON pe.song_id = songs.id`+songDetailsJoins+`
+		WHERE pe.playlist_id = ?
+		ORDER BY pe.list_order, pe.id
 	`, playlistID)
 	if err != nil {
 		return nil, err
@@ -499,33 +1012,12 @@ func (db *DB) GetPlaylistWithSongs(playlistID int64) (*PlaylistWithSongs, error)
 	var entries []PlaylistEntryWithSong
 	for rows.Next() {
 		var entry PlaylistEntryWithSong
-		var song SongWithDetails
-
-		err := rows.Scan(
-			&entry.ID,
-			&entry.Playlist_ID,
-			&entry.ListOrder,
-
-			&song.ID,
-			&song.Path,
-			&song.Title,
-			&song.Artist_ID,
-			&song.Album_ID,
-			&song.Composer,
-			&song.Comment,
-			&song.Genre,
-			&song.Year,
-
-			&song.ArtistName,
-			&song.ArtistPFP,
-			&song.AlbumName,
-			&song.AlbumArt,
-		)
+
+		entry.Song, err = scanSongWithDetails(rows, &entry.ID, &entry.Playlist_ID, &entry.ListOrder)
 		if err != nil {
 			return nil, err
 		}
 
-		entry.Song = song
 		entries = append(entries, entry)
 	}
 
@@ -534,7 +1026,178 @@ func (db *DB) GetPlaylistWithSongs(playlistID int64) (*PlaylistWithSongs, error)
 	}
 
 	return &PlaylistWithSongs{
-		Playlist: playlist,
-		Entries:  entries,
+		Playlist:      playlist,
+		Entries:       entries,
+		TotalDuration: totalDuration(entries),
 	}, nil
 }
+
+// Adds up the durations of a playlist's songs
+func totalDuration(entries []PlaylistEntryWithSong) float64 {
+	var total float64
+	for _, entry := range entries {
+		total += entry.Song.Duration
+	}
+	return total
+}
+
+/// ================
+///  RADIO STATIONS
+/// ================
+
+// Inserts a new radio station (and its fallback URLs) into the database
+func (db *DB) CreateRadioStation(station RadioStation) (int64, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to create radio station: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO radio_stations (name, url, homepage, picture) VALUES (?, ?, ?, ?)",
+		station.Name, station.URL, station.Homepage, station.Picture,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create radio station: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := insertRadioStationURLs(tx, id, station.FallbackURLs); err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// Inserts the fallback URLs of a station in order
+func insertRadioStationURLs(tx *sql.Tx, stationID int64, urls []string) error {
+	for i, url := range urls {
+		_, err := tx.Exec(
+			"INSERT INTO radio_station_urls (station_id, url, list_order) VALUES (?, ?, ?)",
+			stationID, url, i,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to add radio station url: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Loads the fallback URLs of a station
+func (db *DB) getRadioStationURLs(stationID int64) ([]string, error) {
+	rows, err := db.conn.Query("SELECT url FROM radio_station_urls WHERE station_id = ? ORDER BY list_order", stationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get radio station urls: %w", err)
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, fmt.Errorf("failed to scan radio station url: %w", err)
+		}
+		urls = append(urls, url)
+	}
+
+	return urls, rows.Err()
+}
+
+// Retrieves a radio station by ID
+func (db *DB) GetRadioStationById(id int64) (RadioStation, error) {
+	var station RadioStation
+	err := db.conn.QueryRow(
+		"SELECT id, name, url, COALESCE(homepage, ''), COALESCE(picture, '') FROM radio_stations WHERE id = ?", id,
+	).Scan(&station.ID, &station.Name, &station.URL, &station.Homepage, &station.Picture)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return RadioStation{}, fmt.Errorf("radio station with ID %d not found", id)
+		}
+		return RadioStation{}, err
+	}
+
+	station.FallbackURLs, err = db.getRadioStationURLs(station.ID)
+	if err != nil {
+		return RadioStation{}, err
+	}
+
+	return station, nil
+}
+
+// Gets all saved radio stations
+func (db *DB) GetRadioStations() ([]RadioStation, error) {
+	rows, err := db.conn.Query("SELECT id, name, url, COALESCE(homepage, ''), COALESCE(picture, '') FROM radio_stations ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get radio stations: %w", err)
+	}
+	defer rows.Close()
+
+	var stations []RadioStation
+	for rows.Next() {
+		var r RadioStation
+		if err := rows.Scan(&r.ID, &r.Name, &r.URL, &r.Homepage, &r.Picture); err != nil {
+			return nil, fmt.Errorf("failed to scan radio station: %w", err)
+		}
+		stations = append(stations, r)
+	}
+	rows.Close()
+
+	for i := range stations {
+		stations[i].FallbackURLs, err = db.getRadioStationURLs(stations[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stations, nil
+}
+
+// Updates a saved radio station, replacing its fallback URLs
+func (db *DB) UpdateRadioStation(station RadioStation) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to update radio station: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		"UPDATE radio_stations SET name = ?, url = ?, homepage = ?, picture = ? WHERE id = ?",
+		station.Name, station.URL, station.Homepage, station.Picture, station.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update radio station: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM radio_station_urls WHERE station_id = ?", station.ID); err != nil {
+		return fmt.Errorf("failed to update radio station urls: %w", err)
+	}
+
+	if err := insertRadioStationURLs(tx, station.ID, station.FallbackURLs); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Removes a radio station and its fallback URLs by ID
+func (db *DB) DeleteRadioStation(id int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM radio_station_urls WHERE station_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM radio_stations WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
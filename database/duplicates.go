@@ -0,0 +1,64 @@
+package database
+
+import "fmt"
+
+// Folds duplicate songs into the one being kept: their playlist entries
+// point at it instead and their play counts are added to it, then they're
+// removed from the library along with any albums and artists they leave
+// empty. Files on disk are left alone
+func (db *DB) MergeSongs(keepID int64, removeIDs []int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin merge: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM songs WHERE id = ?", keepID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to find song: %w", err)
+	}
+	if exists == 0 {
+		return fmt.Errorf("song with ID %d not found", keepID)
+	}
+
+	for _, id := range removeIDs {
+		if id == keepID {
+			continue
+		}
+
+		if _, err := tx.Exec("UPDATE playlist_entries SET song_id = ? WHERE song_id = ?", keepID, id); err != nil {
+			return fmt.Errorf("failed to move playlist entries: %w", err)
+		}
+
+		_, err := tx.Exec(
+			"UPDATE songs SET play_count = play_count + (SELECT play_count FROM songs WHERE id = ?) WHERE id = ? AND EXISTS (SELECT 1 FROM songs WHERE id = ?)",
+			id, keepID, id,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to merge play count: %w", err)
+		}
+
+		if _, err := tx.Exec("DELETE FROM tag_values WHERE song_id = ?", id); err != nil {
+			return fmt.Errorf("failed to remove song tags: %w", err)
+		}
+
+		if _, err := tx.Exec("DELETE FROM song_fingerprints WHERE song_id = ?", id); err != nil {
+			return fmt.Errorf("failed to remove song fingerprint: %w", err)
+		}
+
+		if _, err := tx.Exec("DELETE FROM songs WHERE id = ?", id); err != nil {
+			return fmt.Errorf("failed to remove song: %w", err)
+		}
+	}
+
+	// Duplicates can be the only song on their album or by their artist
+	if err := removeOrphans(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit merge: %w", err)
+	}
+
+	return nil
+}
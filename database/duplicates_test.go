@@ -0,0 +1,73 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestMergeSongsRemovesOrphans(t *testing.T) {
+	db := openTestDB(t)
+
+	// The kept song is on one album, its duplicate is the only song on
+	// another album by another artist
+	keepArtist, _ := db.CreateArtist(Artist{Name: "Artist"})
+	keepAlbum, _ := db.CreateAlbum(Album{Name: "Album", Artist_ID: keepArtist})
+	otherArtist, _ := db.CreateArtist(Artist{Name: "Artist (Remastered)"})
+	otherAlbum, _ := db.CreateAlbum(Album{Name: "Album (Remastered)", Artist_ID: otherArtist})
+
+	keepID, err := db.CreateSong(Song{
+		Path:      "/music/keep.mp3",
+		Artist_ID: sql.NullInt64{Int64: keepArtist, Valid: true},
+		Album_ID:  sql.NullInt64{Int64: keepAlbum, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("failed to create song: %v", err)
+	}
+	duplicateID, err := db.CreateSong(Song{
+		Path:      "/music/duplicate.mp3",
+		Artist_ID: sql.NullInt64{Int64: otherArtist, Valid: true},
+		Album_ID:  sql.NullInt64{Int64: otherAlbum, Valid: true},
+	})
+	if err != nil {
+		t.Fatalf("failed to create song: %v", err)
+	}
+
+	playlistID, _ := db.CreatePlaylist(Playlist{Name: "Mix"})
+	if _, err := db.AddSongToPlaylist(playlistID, duplicateID); err != nil {
+		t.Fatalf("failed to add song: %v", err)
+	}
+	for _, id := range []int64{keepID, duplicateID, duplicateID} {
+		if err := db.IncrementPlayCount(id); err != nil {
+			t.Fatalf("failed to count play: %v", err)
+		}
+	}
+
+	if err := db.MergeSongs(keepID, []int64{duplicateID}); err != nil {
+		t.Fatalf("failed to merge songs: %v", err)
+	}
+
+	kept, err := db.GetSongById(keepID)
+	if err != nil {
+		t.Fatalf("failed to get kept song: %v", err)
+	}
+	if kept.PlayCount != 3 {
+		t.Errorf("kept song has %d plays, want 3", kept.PlayCount)
+	}
+	assertPlaylistOrder(t, db, playlistID, []int64{keepID})
+
+	if _, err := db.GetSongById(duplicateID); err == nil {
+		t.Error("duplicate wasn't removed")
+	}
+	if _, err := db.GetAlbumById(otherAlbum); err == nil {
+		t.Error("emptied album wasn't removed")
+	}
+	if _, err := db.GetArtistById(otherArtist); err == nil {
+		t.Error("emptied artist wasn't removed")
+	}
+	if _, err := db.GetAlbumById(keepAlbum); err != nil {
+		t.Errorf("kept song's album was removed: %v", err)
+	}
+	if _, err := db.GetArtistById(keepArtist); err != nil {
+		t.Errorf("kept song's artist was removed: %v", err)
+	}
+}
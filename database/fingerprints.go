@@ -0,0 +1,75 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Stores a song's acoustic fingerprint (Chromaprint's encoded form)
+func (db *DB) SetSongFingerprint(songID int64, fingerprint string) error {
+	_, err := db.conn.Exec(
+		"INSERT INTO song_fingerprints (song_id, fingerprint) VALUES (?, ?) ON CONFLICT (song_id) DO UPDATE SET fingerprint = excluded.fingerprint",
+		songID, fingerprint,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store fingerprint: %w", err)
+	}
+
+	return nil
+}
+
+// Retrieves a song's fingerprint. ok is false if it hasn't been computed
+func (db *DB) GetSongFingerprint(songID int64) (fingerprint string, ok bool, err error) {
+	err = db.conn.QueryRow("SELECT fingerprint FROM song_fingerprints WHERE song_id = ?", songID).Scan(&fingerprint)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get fingerprint: %w", err)
+	}
+
+	return fingerprint, true, nil
+}
+
+// Gets every stored fingerprint by song ID
+func (db *DB) GetSongFingerprints() (map[int64]string, error) {
+	rows, err := db.conn.Query("SELECT song_id, fingerprint FROM song_fingerprints")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fingerprints: %w", err)
+	}
+	defer rows.Close()
+
+	fingerprints := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var fingerprint string
+		if err := rows.Scan(&id, &fingerprint); err != nil {
+			return nil, fmt.Errorf("failed to scan fingerprint: %w", err)
+		}
+		fingerprints[id] = fingerprint
+	}
+
+	return fingerprints, rows.Err()
+}
+
+// Retrieves songs (with files present) that don't have a fingerprint yet
+func (db *DB) GetSongsWithoutFingerprint() ([]Song, error) {
+	rows, err := db.conn.Query(
+		"SELECT " + songColumns + " FROM songs WHERE missing = 0 AND id NOT IN (SELECT song_id FROM song_fingerprints)",
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get songs: %w", err)
+	}
+	defer rows.Close()
+
+	var songs []Song
+	for rows.Next() {
+		s, err := scanSong(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan song: %w", err)
+		}
+		songs = append(songs, s)
+	}
+
+	return songs, rows.Err()
+}
@@ -0,0 +1,199 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Saves a group of imported songs in one transaction, finding or creating
+// their artists and albums along the way
+type ImportBatch struct {
+	tx      *sql.Tx
+	artists map[string]int64
+	albums  map[albumKey]int64
+}
+
+type albumKey struct {
+	name     string
+	artistID int64
+}
+
+// Starts a new import batch. It must be committed or rolled back
+func (db *DB) BeginImportBatch() (*ImportBatch, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin import batch: %w", err)
+	}
+
+	return &ImportBatch{
+		tx:      tx,
+		artists: make(map[string]int64),
+		albums:  make(map[albumKey]int64),
+	}, nil
+}
+
+// Gets the ID of the artist with this name, creating them if needed
+func (b *ImportBatch) ArtistID(name string) (int64, error) {
+	if id, ok := b.artists[name]; ok {
+		return id, nil
+	}
+
+	var id int64
+	err := b.tx.QueryRow("SELECT id FROM artists WHERE name = ?", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		var result sql.Result
+		result, err = b.tx.Exec("INSERT INTO artists (name, pfp) VALUES (?, '')", name)
+		if err == nil {
+			id, err = result.LastInsertId()
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find or create artist: %w", err)
+	}
+
+	b.artists[name] = id
+	return id, nil
+}
+
+// Gets the ID of an album by name and artist, creating it with the given art
+// (an artwork cache hash) if needed. Albums without art get this art
+func (b *ImportBatch) AlbumID(name string, art string, artistID int64) (int64, error) {
+	key := albumKey{name, artistID}
+	id, ok := b.albums[key]
+	if !ok {
+		err := b.tx.QueryRow("SELECT id FROM albums WHERE name = ? AND artist_id = ?", name, artistID).Scan(&id)
+		if err == sql.ErrNoRows {
+			var result sql.Result
+			result, err = b.tx.Exec("INSERT INTO albums (name, art, artist_id) VALUES (?, ?, ?)", name, art, artistID)
+			if err == nil {
+				id, err = result.LastInsertId()
+			}
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to find or create album: %w", err)
+		}
+
+		b.albums[key] = id
+	}
+
+	if art != "" {
+		_, err := b.tx.Exec("UPDATE albums SET art = ? WHERE id = ? AND COALESCE(art, '') = ''", art, id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to set album art: %w", err)
+		}
+	}
+
+	return id, nil
+}
+
+// Records a picture of an album, if it isn't already
+func (b *ImportBatch) AddAlbumArtwork(albumID int64, kind string, art string, source string) error {
+	_, err := b.tx.Exec(
+		"INSERT OR IGNORE INTO album_artwork (album_id, kind, art, source) VALUES (?, ?, ?, ?)",
+		albumID, kind, art, source,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to add album artwork: %w", err)
+	}
+
+	return nil
+}
+
+// Stores a song, updating the one already at its path in place (keeping its
+// ID) or inserting it. Reports whether it was newly created
+func (b *ImportBatch) SaveSong(song Song) (int64, bool, error) {
+	err := b.tx.QueryRow("SELECT id FROM songs WHERE path = ?", song.Path).Scan(&song.ID)
+	if err == sql.ErrNoRows {
+		id, err := createSong(b.tx, song)
+		return id, true, err
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to find song: %w", err)
+	}
+
+	return song.ID, false, updateSong(b.tx, song)
+}
+
+// Rewrites an existing song by ID, e.g. to point it at a file it moved to
+func (b *ImportBatch) UpdateSong(song Song) error {
+	return updateSong(b.tx, song)
+}
+
+// Rewrites a song's tags, and its file details after the tags were
+// written to the file. The audio is unchanged, so its fingerprint is kept
+func (b *ImportBatch) UpdateSongTags(song Song) error {
+	_, err := b.tx.Exec(`
+		UPDATE songs SET
+			title = ?, artist_id = ?, album_id = ?, composer = ?, comment = ?, genre = ?, year = ?,
+			track_number = ?, track_total = ?, disc_number = ?, disc_total = ?,
+			file_size = ?, mod_time = ?, content_hash = ?
+		WHERE id = ?`,
+		song.Title, song.Artist_ID, song.Album_ID, song.Composer, song.Comment, song.Genre, song.Year,
+		song.TrackNumber, song.TrackTotal, song.DiscNumber, song.DiscTotal,
+		song.FileSize, song.ModTime, song.ContentHash, song.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update song: %w", err)
+	}
+
+	return nil
+}
+
+// Gives an album the pictures of another, e.g. when songs are moved to a
+// renamed album
+func (b *ImportBatch) CopyAlbumArtwork(fromID int64, toID int64) error {
+	_, err := b.tx.Exec(
+		"INSERT OR IGNORE INTO album_artwork (album_id, kind, art, source) SELECT ?, kind, art, source FROM album_artwork WHERE album_id = ?",
+		toID, fromID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to copy album artwork: %w", err)
+	}
+
+	return nil
+}
+
+// Deletes albums no song is on, then artists with no songs or albums left
+func (b *ImportBatch) RemoveOrphans() error {
+	if err := removeOrphans(b.tx); err != nil {
+		return err
+	}
+
+	// Forget the deleted rows so they aren't handed out again
+	clear(b.artists)
+	clear(b.albums)
+
+	return nil
+}
+
+func removeOrphans(ex execer) error {
+	statements := []string{
+		"DELETE FROM album_artwork WHERE album_id NOT IN (SELECT album_id FROM songs WHERE album_id IS NOT NULL)",
+		"DELETE FROM albums WHERE id NOT IN (SELECT album_id FROM songs WHERE album_id IS NOT NULL)",
+		`DELETE FROM artists WHERE
+			id NOT IN (SELECT artist_id FROM songs WHERE artist_id IS NOT NULL) AND
+			id NOT IN (SELECT artist_id FROM albums WHERE artist_id IS NOT NULL)`,
+	}
+
+	for _, statement := range statements {
+		if _, err := ex.Exec(statement); err != nil {
+			return fmt.Errorf("failed to remove orphaned artists and albums: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Saves everything in the batch
+func (b *ImportBatch) Commit() error {
+	if err := b.tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit import batch: %w", err)
+	}
+
+	return nil
+}
+
+// Throws away everything in the batch
+func (b *ImportBatch) Rollback() error {
+	return b.tx.Rollback()
+}
@@ -0,0 +1,224 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sorting, filtering and paging options for QuerySongs. Zero values mean
+// "no filter". Either Offset or Cursor (from a previous page) can be used
+type SongQuery struct {
+	SortBy   string
+	SortDesc bool
+	ArtistID int64
+	AlbumID  int64
+	Genre    string
+	YearFrom int
+	YearTo   int
+	Limit    int
+	Offset   int
+	Cursor   string
+}
+
+// One page of songs, along with how many songs match in total
+type SongPage struct {
+	Songs      []SongWithDetails
+	Total      int64
+	NextCursor string
+}
+
+// Position after the last song of a page, for keyset paging, along with the
+// sort it was made for
+type songCursor struct {
+	SortBy   string      `json:"s,omitempty"`
+	SortDesc bool        `json:"d,omitempty"`
+	Value    interface{} `json:"v"`
+	ID       int64       `json:"id"`
+}
+
+// SQL expressions songs can be sorted by. Each is NULL-free so keyset
+// comparisons behave. Migration 12 indexes the songs columns by these exact
+// expressions, so keep the two in step
+var songSortFields = map[string]string{
+	"title":      "COALESCE(songs.title, '') COLLATE NOCASE",
+	"artist":     "COALESCE(artists.name, '') COLLATE NOCASE",
+	"album":      "COALESCE(albums.name, '') COLLATE NOCASE",
+	"genre":      "COALESCE(songs.genre, '') COLLATE NOCASE",
+	"year":       "COALESCE(CAST(songs.year AS INTEGER), 0)",
+	"play_count": "songs.play_count",
+	"duration":   "songs.duration",
+	"path":       "songs.path",
+}
+
+// Sort fields stored as REAL, whose cursor values keep their fraction
+var realSongSortFields = map[string]bool{
+	"duration": true,
+}
+
+// Default and largest page sizes
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// Builds the WHERE clause (without the cursor) for a query's filters
+func (q SongQuery) filters() (string, []interface{}) {
+	conditions := []string{"1"}
+	var args []interface{}
+
+	if q.ArtistID != 0 {
+		conditions = append(conditions, "songs.artist_id = ?")
+		args = append(args, q.ArtistID)
+	}
+	if q.AlbumID != 0 {
+		conditions = append(conditions, "songs.album_id = ?")
+		args = append(args, q.AlbumID)
+	}
+	if q.Genre != "" {
+		conditions = append(conditions, "songs.genre = ? COLLATE NOCASE")
+		args = append(args, q.Genre)
+	}
+	if q.YearFrom != 0 {
+		conditions = append(conditions, "CAST(songs.year AS INTEGER) >= ?")
+		args = append(args, q.YearFrom)
+	}
+	if q.YearTo != 0 {
+		conditions = append(conditions, "CAST(songs.year AS INTEGER) <= ?")
+		args = append(args, q.YearTo)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// Gets a page of songs (with details), sorted and filtered, along with the
+// total number of matching songs so the UI can size a virtual scroller
+func (db *DB) QuerySongs(q SongQuery) (*SongPage, error) {
+	sortExpr := "songs.id"
+	if q.SortBy != "" {
+		expr, ok := songSortFields[q.SortBy]
+		if !ok {
+			return nil, fmt.Errorf("unknown sort field %q", q.SortBy)
+		}
+		sortExpr = expr
+	}
+
+	direction, comparison := "ASC", ">"
+	if q.SortDesc {
+		direction, comparison = "DESC", "<"
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	limit = min(limit, maxPageSize)
+
+	where, args := q.filters()
+
+	var total int64
+	err := db.conn.QueryRow("SELECT COUNT(*) FROM songs"+songDetailsJoins+" WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count songs: %w", err)
+	}
+
+	// Continue after the last row of the previous page
+	if q.Cursor != "" {
+		cursor, err := decodeSongCursor(q.Cursor, q.SortBy, q.SortDesc)
+		if err != nil {
+			return nil, err
+		}
+
+		if sortExpr == "songs.id" {
+			where += " AND songs.id " + comparison + " ?"
+			args = append(args, cursor.ID)
+		} else {
+			where += fmt.Sprintf(" AND (%[1]s %[2]s ? OR (%[1]s = ? AND songs.id %[2]s ?))", sortExpr, comparison)
+			args = append(args, cursor.Value, cursor.Value, cursor.ID)
+		}
+	}
+
+	// The sort value is selected first so the cursor can be built from the last row
+	query := "SELECT " + sortExpr + ", " + songDetailsColumns + " FROM songs" + songDetailsJoins +
+		" WHERE " + where +
+		" ORDER BY " + sortExpr + " " + direction + ", songs.id " + direction +
+		" LIMIT ?"
+	args = append(args, limit)
+
+	// Offsets only apply when not using a cursor
+	if q.Cursor == "" && q.Offset > 0 {
+		query += " OFFSET ?"
+		args = append(args, q.Offset)
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query songs: %w", err)
+	}
+	defer rows.Close()
+
+	page := &SongPage{Songs: []SongWithDetails{}, Total: total}
+	var lastValue interface{}
+	for rows.Next() {
+		s, err := scanSongWithDetails(rows, &lastValue)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan song details: %w", err)
+		}
+		page.Songs = append(page.Songs, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// A full page means there may be more
+	if len(page.Songs) == limit {
+		last := page.Songs[len(page.Songs)-1]
+		page.NextCursor, err = encodeSongCursor(songCursor{SortBy: q.SortBy, SortDesc: q.SortDesc, Value: lastValue, ID: last.ID})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+func encodeSongCursor(c songCursor) (string, error) {
+	// Text comes back from SQLite as []byte, which would otherwise encode as base64
+	if b, ok := c.Value.([]byte); ok {
+		c.Value = string(b)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// Decodes a cursor for a query sorted by sortBy
+func decodeSongCursor(cursor string, sortBy string, sortDesc bool) (songCursor, error) {
+	var c songCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	// A value from another sort would silently skip or repeat songs
+	if c.SortBy != sortBy || c.SortDesc != sortDesc {
+		return c, errors.New("cursor is for a different sort order")
+	}
+
+	// JSON numbers decode as float64, which only REAL columns should get
+	if f, ok := c.Value.(float64); ok && !realSongSortFields[sortBy] {
+		c.Value = int64(f)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Represents a folder the library watches for changes
+type LibraryFolder struct {
+	ID          int64
+	Path        string
+	LastScanned int64
+}
+
+func scanLibraryFolder(row rowScanner) (LibraryFolder, error) {
+	var f LibraryFolder
+	err := row.Scan(&f.ID, &f.Path, &f.LastScanned)
+	return f, err
+}
+
+// Inserts a new library folder into the database
+func (db *DB) CreateLibraryFolder(path string) (int64, error) {
+	result, err := db.conn.Exec("INSERT INTO library_folders (path) VALUES (?)", path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create library folder: %w", err)
+	}
+
+	return result.LastInsertId()
+}
+
+// Retrieves a library folder by ID
+func (db *DB) GetLibraryFolderById(id int64) (LibraryFolder, error) {
+	folder, err := scanLibraryFolder(db.conn.QueryRow("SELECT id, path, last_scanned FROM library_folders WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return LibraryFolder{}, fmt.Errorf("library folder with ID %d not found", id)
+		}
+		return LibraryFolder{}, err
+	}
+
+	return folder, nil
+}
+
+// Gets all library folders
+func (db *DB) GetLibraryFolders() ([]LibraryFolder, error) {
+	rows, err := db.conn.Query("SELECT id, path, last_scanned FROM library_folders ORDER BY path")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get library folders: %w", err)
+	}
+	defer rows.Close()
+
+	var folders []LibraryFolder
+	for rows.Next() {
+		f, err := scanLibraryFolder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan library folder: %w", err)
+		}
+		folders = append(folders, f)
+	}
+
+	return folders, rows.Err()
+}
+
+// Records when a library folder was last fully scanned
+func (db *DB) SetLibraryFolderScanned(id int64, scannedAt int64) error {
+	_, err := db.conn.Exec("UPDATE library_folders SET last_scanned = ? WHERE id = ?", scannedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to update library folder: %w", err)
+	}
+
+	return nil
+}
+
+// Removes a library folder by ID. Its songs stay in the library
+func (db *DB) DeleteLibraryFolder(id int64) error {
+	_, err := db.conn.Exec("DELETE FROM library_folders WHERE id = ?", id)
+	return err
+}
+
+// A new path for a song, and whether its file is there
+type SongPathUpdate struct {
+	ID      int64
+	Path    string
+	Missing bool
+}
+
+// Rewrites song and library folder paths in one transaction, e.g. after the
+// library has moved to a different drive
+func (db *DB) RelocatePaths(songs []SongPathUpdate, folders []LibraryFolder) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin relocation: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, song := range songs {
+		if _, err := tx.Exec("UPDATE songs SET path = ?, missing = ? WHERE id = ?", song.Path, song.Missing, song.ID); err != nil {
+			return fmt.Errorf("failed to relocate song %d: %w", song.ID, err)
+		}
+	}
+
+	for _, folder := range folders {
+		if _, err := tx.Exec("UPDATE library_folders SET path = ? WHERE id = ?", folder.Path, folder.ID); err != nil {
+			return fmt.Errorf("failed to relocate library folder %d: %w", folder.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit relocation: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestQuerySongsPagesByDuration(t *testing.T) {
+	db := openTestDB(t)
+
+	// Durations that only differ in their fraction, which an integer
+	// cursor would skip or repeat
+	durations := []float64{180.9, 180.2, 180.5, 181, 180.7}
+	for i, duration := range durations {
+		_, err := db.CreateSong(Song{Path: fmt.Sprintf("/music/%d.mp3", i), Duration: duration})
+		if err != nil {
+			t.Fatalf("failed to create song: %v", err)
+		}
+	}
+
+	var got []float64
+	cursor := ""
+	for range len(durations) {
+		page, err := db.QuerySongs(SongQuery{SortBy: "duration", Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("failed to query songs: %v", err)
+		}
+		for _, song := range page.Songs {
+			got = append(got, song.Duration)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	want := slices.Clone(durations)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("paged durations are %v, want %v", got, want)
+	}
+}
+
+func TestSongSortFieldsUseIndexes(t *testing.T) {
+	db := openTestDB(t)
+
+	// Sorts by song columns should walk an index rather than sort every row
+	for _, field := range []string{"title", "genre", "year", "play_count", "duration", "path"} {
+		rows, err := db.conn.Query("EXPLAIN QUERY PLAN SELECT songs.id FROM songs" + songDetailsJoins +
+			" ORDER BY " + songSortFields[field] + ", songs.id LIMIT 10")
+		if err != nil {
+			t.Fatalf("failed to explain %s sort: %v", field, err)
+		}
+
+		var plan []string
+		for rows.Next() {
+			var id, parent, unused int
+			var detail string
+			if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+				t.Fatalf("failed to scan plan: %v", err)
+			}
+			plan = append(plan, detail)
+		}
+		rows.Close()
+
+		joined := strings.Join(plan, "; ")
+		if !strings.Contains(joined, "USING INDEX") || strings.Contains(joined, "TEMP B-TREE FOR ORDER BY") {
+			t.Errorf("%s sort plan is %q", field, joined)
+		}
+	}
+}
+
+func TestQuerySongsRejectsCursorForOtherSort(t *testing.T) {
+	db := openTestDB(t)
+	createTestSongs(t, db, 3)
+
+	page, err := db.QuerySongs(SongQuery{SortBy: "title", Limit: 1})
+	if err != nil {
+		t.Fatalf("failed to query songs: %v", err)
+	}
+	if page.NextCursor == "" {
+		t.Fatal("first page has no cursor")
+	}
+
+	if _, err := db.QuerySongs(SongQuery{SortBy: "title", Limit: 1, Cursor: page.NextCursor}); err != nil {
+		t.Errorf("cursor was rejected by its own sort: %v", err)
+	}
+
+	for _, q := range []SongQuery{
+		{SortBy: "year", Cursor: page.NextCursor},
+		{SortBy: "title", SortDesc: true, Cursor: page.NextCursor},
+		{Cursor: page.NextCursor},
+		{SortBy: "title", Cursor: "not a cursor"},
+	} {
+		if _, err := db.QuerySongs(q); err == nil {
+			t.Errorf("query %+v accepted the cursor", q)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// A numbered schema change. Migrations only ever move forward, and each one
+// runs in its own transaction
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// Runs a plain SQL script as a migration
+func execSQL(script string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(script)
+		return err
+	}
+}
+
+// All migrations in order. Never edit or reorder one that has shipped,
+// add a new one at the end instead
+var migrations = []migration{
+	{
+		// Tables from before migrations existed. Everything is IF NOT EXISTS
+		// so databases created by older versions (user_version 0) pass through
+		version: 1,
+		name:    "initial schema",
+		up: execSQL(`
+			CREATE TABLE IF NOT EXISTS songs (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				path TEXT NOT NULL,
+				title TEXT,
+				artist_id INTEGER,
+				album_id INTEGER,
+				composer TEXT,
+				comment TEXT,
+				genre TEXT,
+				year TEXT,
+				FOREIGN KEY (artist_id) REFERENCES artists(id),
+				FOREIGN KEY (album_id) REFERENCES albums(id)
+			);
+
+			CREATE TABLE IF NOT EXISTS artists (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				pfp TEXT
+			);
+
+			CREATE TABLE IF NOT EXISTS albums (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				art TEXT,
+				artist_id INTEGER,
+				FOREIGN KEY (artist_id) REFERENCES artists(id)
+			);
+
+			CREATE TABLE IF NOT EXISTS tags (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL UNIQUE
+			);
+
+			CREATE TABLE IF NOT EXISTS tag_values (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				tag_id INTEGER,
+				value TEXT,
+				song_id INTEGER,
+				FOREIGN KEY (tag_id) REFERENCES tags(id),
+				FOREIGN KEY (song_id) REFERENCES songs(id)
+			);
+
+			CREATE TABLE IF NOT EXISTS playlists (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT,
+				description TEXT,
+				picture TEXT
+			);
+
+			CREATE TABLE IF NOT EXISTS playlist_entries (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				playlist_id INTEGER,
+				song_id INTEGER,
+				list_order INTEGER,
+				FOREIGN KEY (playlist_id) REFERENCES playlists(id),
+				FOREIGN KEY (song_id) REFERENCES songs(id)
+			);
+
+			CREATE TABLE IF NOT EXISTS radio_stations (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT NOT NULL,
+				url TEXT NOT NULL,
+				homepage TEXT,
+				picture TEXT
+			);
+
+			CREATE TABLE IF NOT EXISTS radio_station_urls (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				station_id INTEGER,
+				url TEXT NOT NULL,
+				list_order INTEGER,
+				FOREIGN KEY (station_id) REFERENCES radio_stations(id)
+			);
+
+			CREATE TABLE IF NOT EXISTS podcast_shows (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				feed_url TEXT NOT NULL UNIQUE,
+				title TEXT,
+				author TEXT,
+				description TEXT,
+				link TEXT,
+				image TEXT,
+				last_refreshed INTEGER
+			);
+
+			CREATE TABLE IF NOT EXISTS podcast_episodes (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				show_id INTEGER NOT NULL,
+				guid TEXT NOT NULL,
+				title TEXT,
+				description TEXT,
+				audio_url TEXT NOT NULL,
+				pub_date INTEGER,
+				duration INTEGER,
+				download_path TEXT,
+				played INTEGER NOT NULL DEFAULT 0,
+				position REAL NOT NULL DEFAULT 0,
+				UNIQUE (show_id, guid),
+				FOREIGN KEY (show_id) REFERENCES podcast_shows(id)
+			);
+		`),
+	},
+	{
+		version: 2,
+		name:    "play counts and smart playlists",
+		up: execSQL(`
+			ALTER TABLE songs ADD COLUMN play_count INTEGER NOT NULL DEFAULT 0;
+
+			CREATE TABLE smart_playlists (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				name TEXT,
+				description TEXT,
+				picture TEXT,
+				rules TEXT NOT NULL
+			);
+		`),
+	},
+	{
+		version: 3,
+		name:    "full-text search",
+		up:      createSearchIndex,
+	},
+	{
+		version: 4,
+		name:    "library indexes",
+		up: execSQL(`
+			CREATE INDEX idx_songs_path ON songs (path);
+			CREATE INDEX idx_songs_artist ON songs (artist_id);
+			CREATE INDEX idx_songs_album ON songs (album_id);
+			CREATE INDEX idx_songs_title ON songs (title COLLATE NOCASE);
+			CREATE INDEX idx_songs_genre ON songs (genre COLLATE NOCASE);
+			CREATE INDEX idx_songs_year ON songs (CAST(year AS INTEGER));
+			CREATE INDEX idx_songs_play_count ON songs (play_count);
+			CREATE INDEX idx_artists_name ON artists (name);
+			CREATE INDEX idx_albums_artist_name ON albums (artist_id, name);
+			CREATE INDEX idx_playlist_entries_playlist ON playlist_entries (playlist_id, list_order);
+		`),
+	},
+	{
+		version: 5,
+		name:    "track and disc numbers",
+		up: execSQL(`
+			ALTER TABLE songs ADD COLUMN track_number INTEGER NOT NULL DEFAULT 0;
+			ALTER TABLE songs ADD COLUMN track_total INTEGER NOT NULL DEFAULT 0;
+			ALTER TABLE songs ADD COLUMN disc_number INTEGER NOT NULL DEFAULT 0;
+			ALTER TABLE songs ADD COLUMN disc_total INTEGER NOT NULL DEFAULT 0;
+
+			CREATE INDEX idx_songs_album_order ON songs (album_id, disc_number, track_number);
+		`),
+	},
+	{
+		version: 6,
+		name:    "audio properties",
+		up: execSQL(`
+			ALTER TABLE songs ADD COLUMN duration REAL NOT NULL DEFAULT 0;
+			ALTER TABLE songs ADD COLUMN sample_rate INTEGER NOT NULL DEFAULT 0;
+			ALTER TABLE songs ADD COLUMN bit_depth INTEGER NOT NULL DEFAULT 0;
+			ALTER TABLE songs ADD COLUMN channels INTEGER NOT NULL DEFAULT 0;
+			ALTER TABLE songs ADD COLUMN bitrate INTEGER NOT NULL DEFAULT 0;
+			ALTER TABLE songs ADD COLUMN codec TEXT NOT NULL DEFAULT '';
+			ALTER TABLE songs ADD COLUMN file_size INTEGER NOT NULL DEFAULT 0;
+			ALTER TABLE songs ADD COLUMN mod_time INTEGER NOT NULL DEFAULT 0;
+		`),
+	},
+	{
+		version: 7,
+		name:    "rescan state",
+		up: execSQL(`
+			ALTER TABLE songs ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+			ALTER TABLE songs ADD COLUMN missing INTEGER NOT NULL DEFAULT 0;
+		`),
+	},
+	{
+		version: 8,
+		name:    "library folders",
+		up: execSQL(`
+			CREATE TABLE library_folders (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				path TEXT NOT NULL UNIQUE,
+				last_scanned INTEGER NOT NULL DEFAULT 0
+			);
+		`),
+	},
+	{
+		version: 9,
+		name:    "settings",
+		up: execSQL(`
+			CREATE TABLE settings (
+				key TEXT PRIMARY KEY,
+				value TEXT NOT NULL
+			);
+		`),
+	},
+	{
+		version: 10,
+		name:    "song fingerprints",
+		up: execSQL(`
+			CREATE TABLE song_fingerprints (
+				song_id INTEGER PRIMARY KEY,
+				fingerprint TEXT NOT NULL,
+				FOREIGN KEY (song_id) REFERENCES songs(id)
+			);
+		`),
+	},
+	{
+		version: 11,
+		name:    "album artwork",
+		up: execSQL(`
+			CREATE TABLE album_artwork (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				album_id INTEGER NOT NULL,
+				kind TEXT NOT NULL,
+				art TEXT NOT NULL,
+				source TEXT NOT NULL,
+				UNIQUE (album_id, kind, art),
+				FOREIGN KEY (album_id) REFERENCES albums(id)
+			);
+
+			CREATE INDEX idx_album_artwork_kind ON album_artwork (kind, album_id);
+		`),
+	},
+	{
+		version: 12,
+		name:    "song sort indexes",
+		// Expression indexes only apply to queries using the same expression,
+		// so these match songSortFields in library.go
+		up: execSQL(`
+			CREATE INDEX idx_songs_sort_title ON songs (COALESCE(title, '') COLLATE NOCASE);
+			CREATE INDEX idx_songs_sort_genre ON songs (COALESCE(genre, '') COLLATE NOCASE);
+			CREATE INDEX idx_songs_sort_year ON songs (COALESCE(CAST(year AS INTEGER), 0));
+			CREATE INDEX idx_songs_duration ON songs (duration);
+		`),
+	},
+	{
+		version: 13,
+		name:    "search update trigger columns",
+		up:      narrowSearchUpdateTrigger,
+	},
+}
+
+// Gets the schema version stored in PRAGMA user_version
+func schemaVersion(conn *sql.DB) (int, error) {
+	var version int
+	if err := conn.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	return version, nil
+}
+
+// Applies every migration newer than the database's current version,
+// backing up the database file first if it already has data in it
+func migrate(conn *sql.DB, dbPath string) error {
+	current, err := schemaVersion(conn)
+	if err != nil {
+		return err
+	}
+
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than this version of OpenTurntable supports (%d)", current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+
+	if err := backupDatabase(conn, dbPath, current); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		log.Printf("migrating database to version %d (%s)\n", m.version, m.name)
+		if err := runMigration(conn, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Runs a single migration and bumps user_version in the same transaction
+func runMigration(conn *sql.DB, m migration) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %d: %w", m.version, err)
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+	}
+
+	// PRAGMA doesn't take parameters, version is always our own int
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", m.version)); err != nil {
+		return fmt.Errorf("failed to set schema version %d: %w", m.version, err)
+	}
+
+	return tx.Commit()
+}
+
+// Copies the database next to itself (app.db.v<version>-<timestamp>.bak)
+// before migrating. Brand new, empty databases are skipped
+func backupDatabase(conn *sql.DB, dbPath string, version int) error {
+	var tables int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&tables); err != nil {
+		return fmt.Errorf("failed to inspect database: %w", err)
+	}
+	if tables == 0 {
+		return nil
+	}
+
+	backupPath := fmt.Sprintf("%s.v%d-%s.bak", dbPath, version, time.Now().Format("20060102-150405"))
+	if _, err := os.Stat(backupPath); err == nil {
+		return fmt.Errorf("database backup %s already exists", backupPath)
+	}
+
+	// VACUUM INTO writes a consistent copy even with the connection open
+	if _, err := conn.Exec("VACUUM INTO ?", backupPath); err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+
+	log.Println("backed up database to", backupPath)
+	return nil
+}
@@ -0,0 +1,182 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// Creates a database as versions from before migrations left it: the
+// original tables, some data, and user_version 0
+func createV0Database(t *testing.T, dbPath string) {
+	t.Helper()
+
+	conn, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	tx, err := conn.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrations[0].up(tx); err != nil {
+		t.Fatalf("failed to create baseline schema: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.Exec(`
+		INSERT INTO artists (id, name, pfp) VALUES (1, 'Artist', '');
+		INSERT INTO albums (id, name, art, artist_id) VALUES (1, 'Album', '', 1);
+		INSERT INTO songs (id, path, title, artist_id, album_id) VALUES (1, '/music/a.mp3', 'First', 1, 1);
+		INSERT INTO songs (id, path, title, artist_id, album_id) VALUES (2, '/music/b.mp3', 'Second', 1, 1);
+		INSERT INTO playlists (id, name, description, picture) VALUES (1, 'Mix', '', '');
+		INSERT INTO playlist_entries (playlist_id, song_id, list_order) VALUES (1, 2, 0);
+	`)
+	if err != nil {
+		t.Fatalf("failed to add fixture rows: %v", err)
+	}
+
+	if version, err := schemaVersion(conn); err != nil || version != 0 {
+		t.Fatalf("fixture is at version %d (%v), want 0", version, err)
+	}
+}
+
+// Reports whether a table has a column
+func hasColumn(t *testing.T, conn *sql.DB, table string, column string) bool {
+	t.Helper()
+
+	var n int
+	err := conn.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func TestMigrateFromV0(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "app.db")
+	createV0Database(t, dbPath)
+
+	db, err := openDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	defer db.Close()
+
+	version, err := schemaVersion(db.conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 13 {
+		t.Errorf("schema version is %d, want 13", version)
+	}
+
+	for _, column := range []string{"play_count", "track_number", "disc_total", "duration", "codec", "content_hash", "missing"} {
+		if !hasColumn(t, db.conn, "songs", column) {
+			t.Errorf("songs has no %s column", column)
+		}
+	}
+
+	tables := []string{"smart_playlists", "library_folders", "settings", "song_fingerprints", "album_artwork"}
+	if db.searchable {
+		tables = append(tables, "songs_fts")
+	}
+	for _, table := range tables {
+		var n int
+		if err := db.conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = ?", table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n == 0 {
+			t.Errorf("table %s wasn't created", table)
+		}
+	}
+
+	// Old rows survive, with the new columns at their defaults
+	song, err := db.GetSongById(2)
+	if err != nil {
+		t.Fatalf("song didn't survive: %v", err)
+	}
+	if song.Title != "Second" || song.PlayCount != 0 || song.Missing {
+		t.Errorf("song is %+v", song)
+	}
+
+	playlist, err := db.GetPlaylistWithSongs(1)
+	if err != nil {
+		t.Fatalf("playlist didn't survive: %v", err)
+	}
+	if len(playlist.Entries) != 1 || playlist.Entries[0].Song.ID != 2 {
+		t.Errorf("playlist entries are %+v", playlist.Entries)
+	}
+
+	// Existing songs are indexed for search
+	if db.searchable {
+		results, err := db.SearchLibrary("first", 10, 0)
+		if err != nil {
+			t.Fatalf("search failed: %v", err)
+		}
+		if len(results) != 1 || results[0].ID != 1 {
+			t.Errorf("search found %d songs", len(results))
+		}
+	}
+
+	backups, err := filepath.Glob(dbPath + ".v0-*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("found %d backups, want 1", len(backups))
+	}
+
+	// The backup is the database as it was before migrating
+	backup, err := sql.Open("sqlite3", backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	if version, err := schemaVersion(backup); err != nil || version != 0 {
+		t.Errorf("backup is at version %d (%v), want 0", version, err)
+	}
+	if hasColumn(t, backup, "songs", "play_count") {
+		t.Error("backup was taken after migrating")
+	}
+
+	// Running again changes nothing and takes no new backup
+	if err := migrate(db.conn, dbPath); err != nil {
+		t.Fatalf("second migrate failed: %v", err)
+	}
+	if version, _ := schemaVersion(db.conn); version != 13 {
+		t.Errorf("schema version is %d after a second migrate", version)
+	}
+	if backups, _ := filepath.Glob(dbPath + ".v*.bak"); len(backups) != 1 {
+		t.Errorf("second migrate left %d backups", len(backups))
+	}
+}
+
+func TestMigrateNewDatabaseSkipsBackup(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "app.db")
+
+	db, err := openDB(dbPath)
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	db.Close()
+
+	if backups, _ := filepath.Glob(dbPath + ".v*.bak"); len(backups) != 0 {
+		t.Errorf("new database was backed up: %v", backups)
+	}
+}
+
+func TestMigrateRejectsNewerSchema(t *testing.T) {
+	db := openTestDB(t)
+
+	if _, err := db.conn.Exec("PRAGMA user_version = 999"); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(db.conn, ":memory:"); err == nil {
+		t.Error("migrating a newer schema succeeded")
+	}
+}
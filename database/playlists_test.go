@@ -0,0 +1,254 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// Opens a fresh, fully migrated in-memory database
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := openDB(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// Adds n songs, returning their IDs
+func createTestSongs(t *testing.T, db *DB, n int) []int64 {
+	t.Helper()
+
+	var ids []int64
+	for i := range n {
+		id, err := db.CreateSong(Song{Path: fmt.Sprintf("/music/%d.mp3", i), Title: fmt.Sprintf("Song %d", i)})
+		if err != nil {
+			t.Fatalf("failed to create song: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// Checks a playlist's songs are in the expected order, and its list_order
+// values run 0..n-1 with no gaps or duplicates
+func assertPlaylistOrder(t *testing.T, db *DB, playlistID int64, songIDs []int64) {
+	t.Helper()
+
+	playlist, err := db.GetPlaylistWithSongs(playlistID)
+	if err != nil {
+		t.Fatalf("failed to get playlist: %v", err)
+	}
+
+	var got []int64
+	for i, entry := range playlist.Entries {
+		if entry.ListOrder != int64(i) {
+			t.Errorf("entry %d has list_order %d", i, entry.ListOrder)
+		}
+		got = append(got, entry.Song.ID)
+	}
+
+	if !slices.Equal(got, songIDs) {
+		t.Errorf("playlist songs are %v, want %v", got, songIDs)
+	}
+}
+
+// Gets the entry IDs of a playlist in order
+func entryIDs(t *testing.T, db *DB, playlistID int64) []int64 {
+	t.Helper()
+
+	playlist, err := db.GetPlaylistWithSongs(playlistID)
+	if err != nil {
+		t.Fatalf("failed to get playlist: %v", err)
+	}
+
+	var ids []int64
+	for _, entry := range playlist.Entries {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func TestPlaylistAddRemoveMove(t *testing.T) {
+	db := openTestDB(t)
+	songs := createTestSongs(t, db, 4)
+
+	playlistID, err := db.CreatePlaylist(Playlist{Name: "Mix"})
+	if err != nil {
+		t.Fatalf("failed to create playlist: %v", err)
+	}
+
+	for _, id := range songs {
+		if _, err := db.AddSongToPlaylist(playlistID, id); err != nil {
+			t.Fatalf("failed to add song: %v", err)
+		}
+	}
+	assertPlaylistOrder(t, db, playlistID, songs)
+
+	// Removing from the middle closes the gap
+	entries := entryIDs(t, db, playlistID)
+	if err := db.RemovePlaylistEntry(entries[1]); err != nil {
+		t.Fatalf("failed to remove entry: %v", err)
+	}
+	assertPlaylistOrder(t, db, playlistID, []int64{songs[0], songs[2], songs[3]})
+
+	// Appending after a removal doesn't reuse a position
+	if _, err := db.AddSongToPlaylist(playlistID, songs[1]); err != nil {
+		t.Fatalf("failed to add song: %v", err)
+	}
+	assertPlaylistOrder(t, db, playlistID, []int64{songs[0], songs[2], songs[3], songs[1]})
+
+	// Move to the front, to the back, and past the end (clamped)
+	entries = entryIDs(t, db, playlistID)
+	if err := db.MovePlaylistEntry(entries[3], 0); err != nil {
+		t.Fatalf("failed to move entry: %v", err)
+	}
+	assertPlaylistOrder(t, db, playlistID, []int64{songs[1], songs[0], songs[2], songs[3]})
+
+	entries = entryIDs(t, db, playlistID)
+	if err := db.MovePlaylistEntry(entries[0], 2); err != nil {
+		t.Fatalf("failed to move entry: %v", err)
+	}
+	assertPlaylistOrder(t, db, playlistID, []int64{songs[0], songs[2], songs[1], songs[3]})
+
+	entries = entryIDs(t, db, playlistID)
+	if err := db.MovePlaylistEntry(entries[0], 100); err != nil {
+		t.Fatalf("failed to move entry: %v", err)
+	}
+	assertPlaylistOrder(t, db, playlistID, []int64{songs[2], songs[1], songs[3], songs[0]})
+
+	if err := db.MovePlaylistEntry(-1, 0); err == nil {
+		t.Error("moving a missing entry succeeded")
+	}
+	if err := db.RemovePlaylistEntry(-1); err == nil {
+		t.Error("removing a missing entry succeeded")
+	}
+}
+
+func TestCreatePlaylistWithSongs(t *testing.T) {
+	db := openTestDB(t)
+	songs := createTestSongs(t, db, 3)
+
+	// Songs can appear more than once
+	want := []int64{songs[2], songs[0], songs[2], songs[1]}
+	playlistID, err := db.CreatePlaylistWithSongs(Playlist{Name: "Imported"}, want)
+	if err != nil {
+		t.Fatalf("failed to create playlist: %v", err)
+	}
+	assertPlaylistOrder(t, db, playlistID, want)
+
+	// A failure part way leaves no playlist behind
+	if _, err := db.conn.Exec("DROP TABLE playlist_entries"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreatePlaylistWithSongs(Playlist{Name: "Broken"}, songs); err == nil {
+		t.Fatal("creating a playlist without an entries table succeeded")
+	}
+	playlists, err := db.GetPlaylists()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(playlists) != 1 {
+		t.Errorf("playlists are %+v, want only the first", playlists)
+	}
+}
+
+func TestDeleteSong(t *testing.T) {
+	db := openTestDB(t)
+	songs := createTestSongs(t, db, 3)
+
+	first, err := db.CreatePlaylistWithSongs(Playlist{Name: "First"}, []int64{songs[1], songs[0], songs[1], songs[2]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := db.CreatePlaylistWithSongs(Playlist{Name: "Second"}, []int64{songs[2], songs[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetSongFingerprint(songs[1], "fingerprint"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteSong(songs[1]); err != nil {
+		t.Fatalf("failed to delete song: %v", err)
+	}
+
+	// Every entry goes, and the playlists close up around them
+	assertPlaylistOrder(t, db, first, []int64{songs[0], songs[2]})
+	assertPlaylistOrder(t, db, second, []int64{songs[2]})
+
+	if _, err := db.GetSongById(songs[1]); err == nil {
+		t.Error("deleted song is still there")
+	}
+	if _, ok, _ := db.GetSongFingerprint(songs[1]); ok {
+		t.Error("deleted song's fingerprint is still there")
+	}
+}
+
+func TestDeletePlaylist(t *testing.T) {
+	db := openTestDB(t)
+	songs := createTestSongs(t, db, 2)
+
+	keep, _ := db.CreatePlaylist(Playlist{Name: "Keep"})
+	remove, _ := db.CreatePlaylist(Playlist{Name: "Remove"})
+	for _, id := range songs {
+		db.AddSongToPlaylist(keep, id)
+		db.AddSongToPlaylist(remove, id)
+	}
+
+	if err := db.DeletePlaylist(remove); err != nil {
+		t.Fatalf("failed to delete playlist: %v", err)
+	}
+
+	if _, err := db.GetPlaylistById(remove); err == nil {
+		t.Error("deleted playlist still exists")
+	}
+
+	var entries int
+	if err := db.conn.QueryRow("SELECT COUNT(*) FROM playlist_entries WHERE playlist_id = ?", remove).Scan(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if entries != 0 {
+		t.Errorf("deleted playlist left %d entries behind", entries)
+	}
+
+	assertPlaylistOrder(t, db, keep, songs)
+}
+
+func TestDuplicatePlaylist(t *testing.T) {
+	db := openTestDB(t)
+	songs := createTestSongs(t, db, 3)
+
+	original, _ := db.CreatePlaylist(Playlist{Name: "Original", Description: "desc"})
+	for _, id := range songs {
+		db.AddSongToPlaylist(original, id)
+	}
+
+	// Reorder first, so the copy has to follow list_order rather than IDs
+	entries := entryIDs(t, db, original)
+	if err := db.MovePlaylistEntry(entries[2], 0); err != nil {
+		t.Fatalf("failed to move entry: %v", err)
+	}
+	want := []int64{songs[2], songs[0], songs[1]}
+
+	copyID, err := db.DuplicatePlaylist(original)
+	if err != nil {
+		t.Fatalf("failed to duplicate playlist: %v", err)
+	}
+
+	copied, err := db.GetPlaylistById(copyID)
+	if err != nil {
+		t.Fatalf("failed to get copy: %v", err)
+	}
+	if copied.Name != "Original (Copy)" || copied.Description != "desc" {
+		t.Errorf("copy is %+v", copied)
+	}
+
+	assertPlaylistOrder(t, db, copyID, want)
+	assertPlaylistOrder(t, db, original, want)
+}
@@ -0,0 +1,228 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Represents a subscribed podcast
+type PodcastShow struct {
+	ID            int64
+	FeedURL       string
+	Title         string
+	Author        string
+	Description   string
+	Link          string
+	Image         string
+	LastRefreshed int64
+}
+
+// Represents a single podcast episode
+type PodcastEpisode struct {
+	ID           int64
+	Show_ID      int64
+	GUID         string
+	Title        string
+	Description  string
+	AudioURL     string
+	PubDate      int64
+	Duration     int64
+	DownloadPath string
+	Played       bool
+	Position     float64
+}
+
+const podcastShowColumns = "id, feed_url, COALESCE(title, ''), COALESCE(author, ''), COALESCE(description, ''), COALESCE(link, ''), COALESCE(image, ''), COALESCE(last_refreshed, 0)"
+
+const podcastEpisodeColumns = "id, show_id, guid, COALESCE(title, ''), COALESCE(description, ''), audio_url, COALESCE(pub_date, 0), COALESCE(duration, 0), COALESCE(download_path, ''), played, position"
+
+func scanPodcastShow(row rowScanner) (PodcastShow, error) {
+	var s PodcastShow
+	err := row.Scan(&s.ID, &s.FeedURL, &s.Title, &s.Author, &s.Description, &s.Link, &s.Image, &s.LastRefreshed)
+	return s, err
+}
+
+func scanPodcastEpisode(row rowScanner) (PodcastEpisode, error) {
+	var e PodcastEpisode
+	err := row.Scan(&e.ID, &e.Show_ID, &e.GUID, &e.Title, &e.Description, &e.AudioURL, &e.PubDate, &e.Duration, &e.DownloadPath, &e.Played, &e.Position)
+	return e, err
+}
+
+// Inserts a new podcast show into the database
+func (db *DB) CreatePodcastShow(show PodcastShow) (int64, error) {
+	result, err := db.conn.Exec(
+		"INSERT INTO podcast_shows (feed_url, title, author, description, link, image, last_refreshed) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		show.FeedURL, show.Title, show.Author, show.Description, show.Link, show.Image, show.LastRefreshed,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create podcast show: %w", err)
+	}
+
+	return result.LastInsertId()
+}
+
+// Updates a podcast show's details
+func (db *DB) UpdatePodcastShow(show PodcastShow) error {
+	_, err := db.conn.Exec(
+		"UPDATE podcast_shows SET feed_url = ?, title = ?, author = ?, description = ?, link = ?, image = ?, last_refreshed = ? WHERE id = ?",
+		show.FeedURL, show.Title, show.Author, show.Description, show.Link, show.Image, show.LastRefreshed, show.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update podcast show: %w", err)
+	}
+
+	return nil
+}
+
+// Retrieves a podcast show by ID
+func (db *DB) GetPodcastShowById(id int64) (PodcastShow, error) {
+	show, err := scanPodcastShow(db.conn.QueryRow("SELECT "+podcastShowColumns+" FROM podcast_shows WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return PodcastShow{}, fmt.Errorf("podcast show with ID %d not found", id)
+		}
+		return PodcastShow{}, err
+	}
+
+	return show, nil
+}
+
+// Retrieves a podcast show by its feed URL
+func (db *DB) GetPodcastShowByFeedURL(feedURL string) (PodcastShow, error) {
+	show, err := scanPodcastShow(db.conn.QueryRow("SELECT "+podcastShowColumns+" FROM podcast_shows WHERE feed_url = ?", feedURL))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return PodcastShow{}, fmt.Errorf("podcast show with feed %s not found", feedURL)
+		}
+		return PodcastShow{}, err
+	}
+
+	return show, nil
+}
+
+// Gets all subscribed podcast shows
+func (db *DB) GetPodcastShows() ([]PodcastShow, error) {
+	rows, err := db.conn.Query("SELECT " + podcastShowColumns + " FROM podcast_shows ORDER BY title")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get podcast shows: %w", err)
+	}
+	defer rows.Close()
+
+	var shows []PodcastShow
+	for rows.Next() {
+		s, err := scanPodcastShow(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan podcast show: %w", err)
+		}
+		shows = append(shows, s)
+	}
+
+	return shows, rows.Err()
+}
+
+// Removes a podcast show and all of its episodes
+func (db *DB) DeletePodcastShow(id int64) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM podcast_episodes WHERE show_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete podcast episodes: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM podcast_shows WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete podcast show: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// Inserts an episode, or updates its feed details if the show already has an
+// episode with the same GUID. Played state, position and downloads are kept
+func (db *DB) UpsertPodcastEpisode(episode PodcastEpisode) (int64, error) {
+	var id int64
+	err := db.conn.QueryRow(`
+		INSERT INTO podcast_episodes (show_id, guid, title, description, audio_url, pub_date, duration)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (show_id, guid) DO UPDATE SET
+			title = excluded.title,
+			description = excluded.description,
+			audio_url = excluded.audio_url,
+			pub_date = excluded.pub_date,
+			duration = excluded.duration
+		RETURNING id`,
+		episode.Show_ID, episode.GUID, episode.Title, episode.Description, episode.AudioURL, episode.PubDate, episode.Duration,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save podcast episode: %w", err)
+	}
+
+	return id, nil
+}
+
+// Retrieves a podcast episode by ID
+func (db *DB) GetPodcastEpisodeById(id int64) (PodcastEpisode, error) {
+	episode, err := scanPodcastEpisode(db.conn.QueryRow("SELECT "+podcastEpisodeColumns+" FROM podcast_episodes WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return PodcastEpisode{}, fmt.Errorf("podcast episode with ID %d not found", id)
+		}
+		return PodcastEpisode{}, err
+	}
+
+	return episode, nil
+}
+
+// Gets all episodes of a show, newest first
+func (db *DB) GetPodcastEpisodes(showID int64) ([]PodcastEpisode, error) {
+	rows, err := db.conn.Query("SELECT "+podcastEpisodeColumns+" FROM podcast_episodes WHERE show_id = ? ORDER BY pub_date DESC", showID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get podcast episodes: %w", err)
+	}
+	defer rows.Close()
+
+	var episodes []PodcastEpisode
+	for rows.Next() {
+		e, err := scanPodcastEpisode(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan podcast episode: %w", err)
+		}
+		episodes = append(episodes, e)
+	}
+
+	return episodes, rows.Err()
+}
+
+// Sets (or clears, with an empty path) where an episode has been downloaded to
+func (db *DB) SetPodcastEpisodeDownloadPath(id int64, path string) error {
+	_, err := db.conn.Exec(
+		"UPDATE podcast_episodes SET download_path = ? WHERE id = ?",
+		sql.NullString{String: path, Valid: path != ""}, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set podcast episode download: %w", err)
+	}
+
+	return nil
+}
+
+// Stores the resume position (in seconds) of an episode
+func (db *DB) SetPodcastEpisodePosition(id int64, position float64) error {
+	_, err := db.conn.Exec("UPDATE podcast_episodes SET position = ? WHERE id = ?", position, id)
+	if err != nil {
+		return fmt.Errorf("failed to set podcast episode position: %w", err)
+	}
+
+	return nil
+}
+
+// Marks an episode as played or unplayed. Either way it starts from the beginning next time
+func (db *DB) SetPodcastEpisodePlayed(id int64, played bool) error {
+	_, err := db.conn.Exec("UPDATE podcast_episodes SET played = ?, position = 0 WHERE id = ?", played, id)
+	if err != nil {
+		return fmt.Errorf("failed to set podcast episode played: %w", err)
+	}
+
+	return nil
+}
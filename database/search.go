@@ -0,0 +1,249 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// Keeps a song's index row up to date. Only the indexed columns fire it, so
+// play counts and rescans don't rewrite the index
+const searchUpdateTrigger = `
+	CREATE TRIGGER songs_fts_update AFTER UPDATE OF title, artist_id, album_id, composer, genre, comment ON songs BEGIN
+		DELETE FROM songs_fts WHERE rowid = old.id;
+		INSERT INTO songs_fts (rowid, title, artist, album, composer, genre, comment)
+		VALUES (
+			new.id, new.title,
+			(SELECT name FROM artists WHERE id = new.artist_id),
+			(SELECT name FROM albums WHERE id = new.album_id),
+			new.composer, new.genre, new.comment
+		);
+	END;
+`
+
+// Full-text index over songs, kept in sync with songs/artists/albums by
+// triggers. Requires SQLite built with FTS5 (the sqlite_fts5 build tag)
+const searchIndexSchema = `
+	CREATE VIRTUAL TABLE songs_fts USING fts5(
+		title, artist, album, composer, genre, comment,
+		tokenize = 'unicode61 remove_diacritics 2',
+		prefix = '2 3'
+	);
+
+	INSERT INTO songs_fts (rowid, title, artist, album, composer, genre, comment)
+	SELECT songs.id, songs.title, artists.name, albums.name, songs.composer, songs.genre, songs.comment
+	FROM songs
+	LEFT JOIN artists ON songs.artist_id = artists.id
+	LEFT JOIN albums ON songs.album_id = albums.id;
+
+	CREATE TRIGGER songs_fts_insert AFTER INSERT ON songs BEGIN
+		INSERT INTO songs_fts (rowid, title, artist, album, composer, genre, comment)
+		VALUES (
+			new.id, new.title,
+			(SELECT name FROM artists WHERE id = new.artist_id),
+			(SELECT name FROM albums WHERE id = new.album_id),
+			new.composer, new.genre, new.comment
+		);
+	END;
+
+` + searchUpdateTrigger + `
+
+	CREATE TRIGGER songs_fts_delete AFTER DELETE ON songs BEGIN
+		DELETE FROM songs_fts WHERE rowid = old.id;
+	END;
+
+	CREATE TRIGGER songs_fts_artist_update AFTER UPDATE OF name ON artists BEGIN
+		UPDATE songs_fts SET artist = new.name
+		WHERE rowid IN (SELECT id FROM songs WHERE artist_id = new.id);
+	END;
+
+	CREATE TRIGGER songs_fts_album_update AFTER UPDATE OF name ON albums BEGIN
+		UPDATE songs_fts SET album = new.name
+		WHERE rowid IN (SELECT id FROM songs WHERE album_id = new.id);
+	END;
+`
+
+// Returned by SearchLibrary when the search index couldn't be created
+var ErrSearchUnavailable = errors.New("library search is unavailable, SQLite was built without FTS5 (build with -tags \"sqlite_fts5\")")
+
+// Reports whether SQLite was built with FTS5
+func hasFTS5(q execer) (bool, error) {
+	var available bool
+	err := q.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&available)
+	return available, err
+}
+
+// Reports whether the search index exists
+func hasSearchIndex(q execer) (bool, error) {
+	var n int
+	err := q.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'songs_fts'").Scan(&n)
+	return n > 0, err
+}
+
+// Migration creating the search index. Without FTS5 it's left out and
+// search is disabled, rather than the database failing to open
+func createSearchIndex(tx *sql.Tx) error {
+	available, err := hasFTS5(tx)
+	if err != nil || !available {
+		return err
+	}
+
+	_, err = tx.Exec(searchIndexSchema)
+	return err
+}
+
+// Migration limiting the update trigger to the indexed columns, on
+// databases that have the search index
+func narrowSearchUpdateTrigger(tx *sql.Tx) error {
+	exists, err := hasSearchIndex(tx)
+	if err != nil || !exists {
+		return err
+	}
+
+	_, err = tx.Exec("DROP TRIGGER songs_fts_update;" + searchUpdateTrigger)
+	return err
+}
+
+// Creates the search index if it's missing but FTS5 is now available, e.g.
+// when the database was created by a build without it. Reports whether
+// search can be used
+func ensureSearchIndex(conn *sql.DB) (bool, error) {
+	exists, err := hasSearchIndex(conn)
+	if err != nil || exists {
+		return exists, err
+	}
+
+	available, err := hasFTS5(conn)
+	if err != nil {
+		return false, err
+	}
+	if !available {
+		log.Println(ErrSearchUnavailable)
+		return false, nil
+	}
+
+	log.Println("building the search index")
+	tx, err := conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to create search index: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(searchIndexSchema); err != nil {
+		return false, fmt.Errorf("failed to create search index: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to create search index: %w", err)
+	}
+
+	return true, nil
+}
+
+// Columns a search term can be limited to with "field:term"
+var searchFields = map[string]bool{
+	"title":    true,
+	"artist":   true,
+	"album":    true,
+	"composer": true,
+	"genre":    true,
+	"comment":  true,
+}
+
+// Turns a user's search into an FTS5 query. Every term must match (as a
+// prefix), "quoted phrases" match exactly and field:term limits a term to
+// one column, e.g. `artist:beatles "let it"` becomes
+// `artist : ("beatles"*) AND "let it"`
+func buildSearchQuery(input string) string {
+	var parts []string
+
+	for _, token := range splitSearchTerms(input) {
+		field := ""
+		if name, rest, ok := strings.Cut(token, ":"); ok && searchFields[strings.ToLower(name)] {
+			field = strings.ToLower(name)
+			token = rest
+		}
+
+		quoted := len(token) >= 2 && strings.HasPrefix(token, `"`) && strings.HasSuffix(token, `"`)
+		term := strings.Trim(token, `"`)
+		if strings.TrimFunc(term, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }) == "" {
+			continue
+		}
+
+		// Terms are always quoted so FTS5 syntax in them is taken literally
+		expr := `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		if !quoted {
+			expr += "*"
+		}
+
+		if field != "" {
+			expr = field + " : (" + expr + ")"
+		}
+		parts = append(parts, expr)
+	}
+
+	return strings.Join(parts, " AND ")
+}
+
+// Splits a search on whitespace, keeping "quoted phrases" (including
+// field:"quoted phrases") together
+func splitSearchTerms(input string) []string {
+	var terms []string
+	var current strings.Builder
+	inQuotes := false
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuotes:
+			if current.Len() > 0 {
+				terms = append(terms, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		terms = append(terms, current.String())
+	}
+
+	return terms
+}
+
+// Searches the library, best matches first. Matches in titles count for
+// more than artists, then albums, then everything else
+func (db *DB) SearchLibrary(query string, limit int, offset int) ([]SongWithDetails, error) {
+	if !db.searchable {
+		return nil, ErrSearchUnavailable
+	}
+
+	match := buildSearchQuery(query)
+	if match == "" {
+		return []SongWithDetails{}, nil
+	}
+
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := db.conn.Query(`
+		SELECT `+songDetailsColumns+`
+		FROM songs_fts
+		JOIN songs ON songs.id = songs_fts.rowid`+songDetailsJoins+`
+		WHERE songs_fts MATCH ?
+		ORDER BY bm25(songs_fts, 10.0, 5.0, 3.0, 1.0, 1.0, 0.5)
+		LIMIT ? OFFSET ?`,
+		match, limit, offset,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search library: %w", err)
+	}
+	defer rows.Close()
+
+	return scanSongsWithDetails(rows)
+}
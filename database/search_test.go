@@ -0,0 +1,235 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestBuildSearchQuery(t *testing.T) {
+	tests := map[string]string{
+		"beatles":                  `"beatles"*`,
+		"let it be":                `"let"* AND "it"* AND "be"*`,
+		`"let it" be`:              `"let it" AND "be"*`,
+		"artist:beatles":           `artist : ("beatles"*)`,
+		`ARTIST:"the beatles" abc`: `artist : ("the beatles") AND "abc"*`,
+		"year:1969":                `"year:1969"*`,
+		`a"b OR c`:                 `"a""b OR c"*`,
+		"NOT -- *":                 `"NOT"*`,
+		"   ":                      "",
+	}
+
+	for input, want := range tests {
+		if got := buildSearchQuery(input); got != want {
+			t.Errorf("buildSearchQuery(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+// Opens a test database, skipping the test if SQLite lacks FTS5
+func openSearchTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db := openTestDB(t)
+	if !db.searchable {
+		t.Skip(ErrSearchUnavailable)
+	}
+	return db
+}
+
+// Adds songs for searching, each with an artist and album of its own
+func createSearchSongs(t *testing.T, db *DB, songs []struct{ title, artist, album, comment string }) map[string]int64 {
+	t.Helper()
+
+	ids := make(map[string]int64)
+	for i, s := range songs {
+		artistID, err := db.CreateArtist(Artist{Name: s.artist})
+		if err != nil {
+			t.Fatal(err)
+		}
+		albumID, err := db.CreateAlbum(Album{Name: s.album, Artist_ID: artistID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id, err := db.CreateSong(Song{
+			Path:      "/music/" + string(rune('a'+i)) + ".mp3",
+			Title:     s.title,
+			Artist_ID: sql.NullInt64{Int64: artistID, Valid: true},
+			Album_ID:  sql.NullInt64{Int64: albumID, Valid: true},
+			Comment:   sql.NullString{String: s.comment, Valid: s.comment != ""},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[s.title] = id
+	}
+	return ids
+}
+
+// Searches and lists the titles found, best first
+func searchTitles(t *testing.T, db *DB, query string) []string {
+	t.Helper()
+
+	results, err := db.SearchLibrary(query, 0, 0)
+	if err != nil {
+		t.Fatalf("search for %q failed: %v", query, err)
+	}
+
+	titles := []string{}
+	for _, song := range results {
+		titles = append(titles, song.Title)
+	}
+	return titles
+}
+
+func TestSearchLibrary(t *testing.T) {
+	db := openSearchTestDB(t)
+	createSearchSongs(t, db, []struct{ title, artist, album, comment string }{
+		{"Halo", "Beyoncé", "I Am... Sasha Fierce", ""},
+		{"Yesterday", "The Beatles", "Help!", ""},
+		{"Blackbird", "The Beatles", "The Beatles", "Recorded live in one take"},
+		{"Café del Mar", "Energy 52", "Café del Mar", ""},
+		{"Beatles Medley", "Tribute Band", "Covers", ""},
+		{"Night Drive", "Someone", "Yesterday's News", "sounds like yesterday"},
+	})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Every term matches as a prefix
+		{"yest", []string{"Yesterday", "Night Drive"}},
+		{"black bird", []string{}},
+		{"bla", []string{"Blackbird"}},
+
+		// Diacritics are folded both ways
+		{"beyonce", []string{"Halo"}},
+		{"Beyoncé", []string{"Halo"}},
+		{"cafe", []string{"Café del Mar"}},
+
+		// Field qualifiers limit a term to one column
+		{"artist:beatles", []string{"Yesterday", "Blackbird"}},
+		{"title:beatles", []string{"Beatles Medley"}},
+		{"comment:live", []string{"Blackbird"}},
+		{`album:"del mar"`, []string{"Café del Mar"}},
+		{"artist:beatles black", []string{"Blackbird"}},
+
+		// Phrases match exactly, in order
+		{`"one take"`, []string{"Blackbird"}},
+		{`"take one"`, []string{}},
+
+		// FTS5 syntax is taken literally rather than failing
+		{"NOT OR AND", []string{}},
+		{`halo"`, []string{"Halo"}},
+		{"   ", []string{}},
+	}
+
+	for _, test := range tests {
+		got := searchTitles(t, db, test.query)
+		if strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("search for %q found %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func TestSearchLibraryRanksTitlesFirst(t *testing.T) {
+	db := openSearchTestDB(t)
+	createSearchSongs(t, db, []struct{ title, artist, album, comment string }{
+		{"Something Else", "Aurora Band", "Other", ""},
+		{"Untitled", "Someone", "Other", "aurora on the b-side"},
+		{"Aurora", "Someone", "Other", ""},
+		{"Another", "Someone", "Aurora Nights", ""},
+	})
+
+	// Title, then artist, then album, then comment
+	want := []string{"Aurora", "Something Else", "Another", "Untitled"}
+	if got := searchTitles(t, db, "aurora"); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("search ranked %q, want %q", got, want)
+	}
+}
+
+func TestSearchIndexFollowsChanges(t *testing.T) {
+	db := openSearchTestDB(t)
+	ids := createSearchSongs(t, db, []struct{ title, artist, album, comment string }{
+		{"Original Title", "First Artist", "First Album", ""},
+	})
+	id := ids["Original Title"]
+
+	song, err := db.GetSongById(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	song.Title = "Renamed"
+	if err := db.UpdateSong(song); err != nil {
+		t.Fatalf("failed to update song: %v", err)
+	}
+	if _, err := db.conn.Exec("UPDATE artists SET name = 'Second Artist' WHERE id = ?", song.Artist_ID.Int64); err != nil {
+		t.Fatal(err)
+	}
+
+	checks := map[string][]string{
+		"original":      {},
+		"renamed":       {"Renamed"},
+		"artist:first":  {},
+		"artist:second": {"Renamed"},
+	}
+	for query, want := range checks {
+		if got := searchTitles(t, db, query); strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("search for %q found %q, want %q", query, got, want)
+		}
+	}
+
+	// Columns that aren't indexed don't fire the update trigger
+	var triggerSQL string
+	err = db.conn.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'trigger' AND name = 'songs_fts_update'").Scan(&triggerSQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(triggerSQL, "AFTER UPDATE OF title, artist_id, album_id, composer, genre, comment ON songs") {
+		t.Errorf("update trigger is %q", triggerSQL)
+	}
+
+	if err := db.IncrementPlayCount(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.conn.Exec("DELETE FROM songs WHERE id = ?", id); err != nil {
+		t.Fatal(err)
+	}
+	if got := searchTitles(t, db, "renamed"); len(got) != 0 {
+		t.Errorf("deleted song is still found: %q", got)
+	}
+}
+
+func TestEnsureSearchIndexRebuilds(t *testing.T) {
+	db := openSearchTestDB(t)
+	createSearchSongs(t, db, []struct{ title, artist, album, comment string }{
+		{"Existing Song", "Artist", "Album", ""},
+	})
+
+	// As a database created by a build without FTS5 would be
+	_, err := db.conn.Exec(`
+		DROP TABLE songs_fts;
+		DROP TRIGGER songs_fts_insert;
+		DROP TRIGGER songs_fts_update;
+		DROP TRIGGER songs_fts_delete;
+		DROP TRIGGER songs_fts_artist_update;
+		DROP TRIGGER songs_fts_album_update;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	searchable, err := ensureSearchIndex(db.conn)
+	if err != nil || !searchable {
+		t.Fatalf("ensureSearchIndex returned %v, %v", searchable, err)
+	}
+	if got := searchTitles(t, db, "existing"); len(got) != 1 {
+		t.Errorf("search after rebuilding found %q", got)
+	}
+
+	db.searchable = false
+	if _, err := db.SearchLibrary("existing", 0, 0); err != ErrSearchUnavailable {
+		t.Errorf("search without an index returned %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Retrieves a stored setting. ok is false if it has never been set
+func (db *DB) GetSetting(key string) (value string, ok bool, err error) {
+	err = db.conn.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get setting %s: %w", key, err)
+	}
+
+	return value, true, nil
+}
+
+// Stores a setting, replacing any previous value
+func (db *DB) SetSetting(key string, value string) error {
+	_, err := db.conn.Exec(
+		"INSERT INTO settings (key, value) VALUES (?, ?) ON CONFLICT (key) DO UPDATE SET value = excluded.value",
+		key, value,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set setting %s: %w", key, err)
+	}
+
+	return nil
+}
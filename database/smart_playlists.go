@@ -0,0 +1,345 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A node in a smart playlist's rule tree. A node with Rules is a group whose
+// children are combined with Match ("all" for AND, "any" for OR), otherwise
+// it's a single Field/Operator/Value condition
+type SmartRule struct {
+	Match    string      `json:"match,omitempty"`
+	Rules    []SmartRule `json:"rules,omitempty"`
+	Field    string      `json:"field,omitempty"`
+	Operator string      `json:"operator,omitempty"`
+	Value    string      `json:"value,omitempty"`
+}
+
+// The full definition of a smart playlist: which songs match, and how
+// they're sorted and limited
+type SmartPlaylistRules struct {
+	Root     SmartRule `json:"root"`
+	SortBy   string    `json:"sortBy,omitempty"`
+	SortDesc bool      `json:"sortDesc,omitempty"`
+	Limit    int       `json:"limit,omitempty"`
+}
+
+// Represents a smart playlist in the database
+type SmartPlaylist struct {
+	ID          int64
+	Name        string
+	Description string
+	Picture     string
+	Rules       SmartPlaylistRules
+}
+
+// SQL expressions rule fields are allowed to refer to
+var smartRuleFields = map[string]string{
+	"title":        "songs.title",
+	"artist":       "artists.name",
+	"album":        "albums.name",
+	"album_artist": "album_artists.name",
+	"genre":        "songs.genre",
+	"composer":     "songs.composer",
+	"comment":      "songs.comment",
+	"path":         "songs.path",
+	"year":         "CAST(songs.year AS INTEGER)",
+	"play_count":   "songs.play_count",
+	"duration":     "songs.duration",
+	"bitrate":      "songs.bitrate",
+	"codec":        "songs.codec",
+}
+
+// Fields compared as numbers rather than text
+var smartNumericFields = map[string]bool{
+	"year":       true,
+	"play_count": true,
+	"duration":   true,
+	"bitrate":    true,
+}
+
+// Numeric fields stored as REAL, which may be compared with fractions
+var smartRealFields = map[string]bool{
+	"duration": true,
+}
+
+// SQL expressions smart playlists can be sorted by
+var smartSortFields = map[string]string{
+	"title":      "songs.title COLLATE NOCASE",
+	"artist":     "artists.name COLLATE NOCASE",
+	"album":      "albums.name COLLATE NOCASE",
+	"genre":      "songs.genre COLLATE NOCASE",
+	"year":       "CAST(songs.year AS INTEGER)",
+	"play_count": "songs.play_count",
+	"duration":   "songs.duration",
+	"random":     "RANDOM()",
+}
+
+// Turns a rule tree into a parameterized WHERE expression
+func (r SmartRule) compile() (string, []interface{}, error) {
+	if len(r.Rules) > 0 || r.Field == "" {
+		joiner := " AND "
+		switch r.Match {
+		case "", "all":
+		case "any":
+			joiner = " OR "
+		default:
+			return "", nil, fmt.Errorf("unknown rule match %q", r.Match)
+		}
+
+		// An empty group matches everything
+		if len(r.Rules) == 0 {
+			return "1", nil, nil
+		}
+
+		var parts []string
+		var args []interface{}
+		for _, child := range r.Rules {
+			part, childArgs, err := child.compile()
+			if err != nil {
+				return "", nil, err
+			}
+			parts = append(parts, part)
+			args = append(args, childArgs...)
+		}
+
+		return "(" + strings.Join(parts, joiner) + ")", args, nil
+	}
+
+	column, ok := smartRuleFields[r.Field]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown rule field %q", r.Field)
+	}
+
+	var value interface{} = r.Value
+	if smartRealFields[r.Field] {
+		f, err := strconv.ParseFloat(strings.TrimSpace(r.Value), 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("rule field %q needs a number, got %q", r.Field, r.Value)
+		}
+		value = f
+	} else if smartNumericFields[r.Field] {
+		n, err := strconv.ParseInt(strings.TrimSpace(r.Value), 10, 64)
+		if err != nil {
+			return "", nil, fmt.Errorf("rule field %q needs a number, got %q", r.Field, r.Value)
+		}
+		value = n
+	}
+
+	// Text comparisons ignore case, and NULLs count as empty text
+	if !smartNumericFields[r.Field] {
+		column = "COALESCE(" + column + ", '')"
+	}
+	textEq := column + " = ? COLLATE NOCASE"
+
+	switch r.Operator {
+	case "=", "is":
+		if smartNumericFields[r.Field] {
+			return column + " = ?", []interface{}{value}, nil
+		}
+		return textEq, []interface{}{value}, nil
+	case "!=", "is_not":
+		if smartNumericFields[r.Field] {
+			return column + " != ?", []interface{}{value}, nil
+		}
+		return "NOT (" + textEq + ")", []interface{}{value}, nil
+	case "<", "<=", ">", ">=":
+		return column + " " + r.Operator + " ?", []interface{}{value}, nil
+	case "contains":
+		return column + " LIKE ? ESCAPE '\\'", []interface{}{"%" + escapeLike(r.Value) + "%"}, nil
+	case "not_contains":
+		return column + " NOT LIKE ? ESCAPE '\\'", []interface{}{"%" + escapeLike(r.Value) + "%"}, nil
+	case "starts_with":
+		return column + " LIKE ? ESCAPE '\\'", []interface{}{escapeLike(r.Value) + "%"}, nil
+	case "ends_with":
+		return column + " LIKE ? ESCAPE '\\'", []interface{}{"%" + escapeLike(r.Value)}, nil
+	}
+
+	return "", nil, fmt.Errorf("unknown rule operator %q", r.Operator)
+}
+
+// Escapes LIKE wildcards so values match literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// Builds the full song query (and its arguments) for a set of rules
+func (rules SmartPlaylistRules) query() (string, []interface{}, error) {
+	where, args, err := rules.Root.compile()
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := "SELECT " + songDetailsColumns + " FROM songs" + songDetailsJoins + " WHERE " + where
+
+	if rules.SortBy != "" {
+		sortExpr, ok := smartSortFields[rules.SortBy]
+		if !ok {
+			return "", nil, fmt.Errorf("unknown sort field %q", rules.SortBy)
+		}
+		direction := "ASC"
+		if rules.SortDesc {
+			direction = "DESC"
+		}
+		query += " ORDER BY " + sortExpr + " " + direction + ", songs.id"
+	} else {
+		query += " ORDER BY songs.id"
+	}
+
+	if rules.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, rules.Limit)
+	}
+
+	return query, args, nil
+}
+
+// Inserts a new smart playlist into the database
+func (db *DB) CreateSmartPlaylist(playlist SmartPlaylist) (int64, error) {
+	// Make sure the rules are valid before saving them
+	if _, _, err := playlist.Rules.query(); err != nil {
+		return 0, err
+	}
+
+	rules, err := json.Marshal(playlist.Rules)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode smart playlist rules: %w", err)
+	}
+
+	result, err := db.conn.Exec(
+		"INSERT INTO smart_playlists (name, description, picture, rules) VALUES (?, ?, ?, ?)",
+		playlist.Name, playlist.Description, playlist.Picture, string(rules),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create smart playlist: %w", err)
+	}
+
+	return result.LastInsertId()
+}
+
+// Updates a smart playlist's details and rules
+func (db *DB) UpdateSmartPlaylist(playlist SmartPlaylist) error {
+	if _, _, err := playlist.Rules.query(); err != nil {
+		return err
+	}
+
+	rules, err := json.Marshal(playlist.Rules)
+	if err != nil {
+		return fmt.Errorf("failed to encode smart playlist rules: %w", err)
+	}
+
+	_, err = db.conn.Exec(
+		"UPDATE smart_playlists SET name = ?, description = ?, picture = ?, rules = ? WHERE id = ?",
+		playlist.Name, playlist.Description, playlist.Picture, string(rules), playlist.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update smart playlist: %w", err)
+	}
+
+	return nil
+}
+
+// Removes a smart playlist by ID
+func (db *DB) DeleteSmartPlaylist(id int64) error {
+	_, err := db.conn.Exec("DELETE FROM smart_playlists WHERE id = ?", id)
+	return err
+}
+
+func scanSmartPlaylist(row rowScanner) (SmartPlaylist, error) {
+	var p SmartPlaylist
+	var rules string
+	if err := row.Scan(&p.ID, &p.Name, &p.Description, &p.Picture, &rules); err != nil {
+		return SmartPlaylist{}, err
+	}
+
+	if err := json.Unmarshal([]byte(rules), &p.Rules); err != nil {
+		return SmartPlaylist{}, fmt.Errorf("failed to decode smart playlist rules: %w", err)
+	}
+
+	return p, nil
+}
+
+// Retrieves a smart playlist by ID
+func (db *DB) GetSmartPlaylistById(id int64) (SmartPlaylist, error) {
+	playlist, err := scanSmartPlaylist(db.conn.QueryRow(
+		"SELECT id, COALESCE(name, ''), COALESCE(description, ''), COALESCE(picture, ''), rules FROM smart_playlists WHERE id = ?", id,
+	))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return SmartPlaylist{}, fmt.Errorf("smart playlist with ID %d not found", id)
+		}
+		return SmartPlaylist{}, err
+	}
+
+	return playlist, nil
+}
+
+// Gets all smart playlists
+func (db *DB) GetSmartPlaylists() ([]SmartPlaylist, error) {
+	rows, err := db.conn.Query("SELECT id, COALESCE(name, ''), COALESCE(description, ''), COALESCE(picture, ''), rules FROM smart_playlists")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get smart playlists: %w", err)
+	}
+	defer rows.Close()
+
+	var playlists []SmartPlaylist
+	for rows.Next() {
+		p, err := scanSmartPlaylist(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan smart playlist: %w", err)
+		}
+		playlists = append(playlists, p)
+	}
+
+	return playlists, rows.Err()
+}
+
+// Evaluates a smart playlist's rules, returning the matching songs in the
+// same shape as GetPlaylistWithSongs. Entry IDs are 0 since the entries
+// aren't stored anywhere
+func (db *DB) GetSmartPlaylistWithSongs(id int64) (*PlaylistWithSongs, error) {
+	smart, err := db.GetSmartPlaylistById(id)
+	if err != nil {
+		return nil, err
+	}
+
+	query, args, err := smart.Rules.query()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run smart playlist: %w", err)
+	}
+	defer rows.Close()
+
+	songs, err := scanSongsWithDetails(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]PlaylistEntryWithSong, len(songs))
+	for i, song := range songs {
+		entries[i] = PlaylistEntryWithSong{
+			Playlist_ID: smart.ID,
+			ListOrder:   int64(i),
+			Song:        song,
+		}
+	}
+
+	return &PlaylistWithSongs{
+		Playlist: Playlist{
+			ID:          smart.ID,
+			Name:        smart.Name,
+			Description: smart.Description,
+			Picture:     smart.Picture,
+		},
+		Entries:       entries,
+		TotalDuration: totalDuration(entries),
+	}, nil
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestSmartPlaylistDurationRule(t *testing.T) {
+	db := openTestDB(t)
+
+	for i, duration := range []float64{179.4, 180.5, 181} {
+		_, err := db.CreateSong(Song{Path: fmt.Sprintf("/music/%d.mp3", i), Duration: duration})
+		if err != nil {
+			t.Fatalf("failed to create song: %v", err)
+		}
+	}
+
+	id, err := db.CreateSmartPlaylist(SmartPlaylist{
+		Name: "Long",
+		Rules: SmartPlaylistRules{
+			Root:   SmartRule{Field: "duration", Operator: ">", Value: "180.5"},
+			SortBy: "duration",
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to create smart playlist: %v", err)
+	}
+
+	playlist, err := db.GetSmartPlaylistWithSongs(id)
+	if err != nil {
+		t.Fatalf("failed to get smart playlist songs: %v", err)
+	}
+
+	var got []float64
+	for _, entry := range playlist.Entries {
+		got = append(got, entry.Song.Duration)
+	}
+	if !slices.Equal(got, []float64{181}) {
+		t.Errorf("matched durations %v, want [181]", got)
+	}
+}
+
+func TestSmartRuleNeedsNumber(t *testing.T) {
+	for _, field := range []string{"duration", "play_count"} {
+		rule := SmartRule{Field: field, Operator: "=", Value: "long"}
+		if _, _, err := rule.compile(); err == nil {
+			t.Errorf("%s rule with a non-number value compiled", field)
+		}
+	}
+
+	// Only REAL fields take fractions
+	rule := SmartRule{Field: "play_count", Operator: "=", Value: "1.5"}
+	if _, _, err := rule.compile(); err == nil {
+		t.Error("play_count rule with a fraction compiled")
+	}
+}
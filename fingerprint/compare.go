@@ -0,0 +1,36 @@
+package fingerprint
+
+import "math/bits"
+
+// Furthest two fingerprints are shifted against each other when comparing,
+// in sub-fingerprints (about 8 per second)
+const maxCompareOffset = 80
+
+// Fewest overlapping sub-fingerprints for a comparison to count
+const minCompareOverlap = 40
+
+// Scores how alike two fingerprints are, from 0 (unrelated) to 1 (the same
+// audio). The fingerprints are lined up at whichever offset matches best,
+// so a few seconds of extra silence or a cut intro don't matter
+func Similarity(a []uint32, b []uint32) float64 {
+	best := 0.0
+	for offset := -maxCompareOffset; offset <= maxCompareOffset; offset++ {
+		// Compare a[i] with b[i+offset]
+		start := max(0, -offset)
+		end := min(len(a), len(b)-offset)
+		if end-start < minCompareOverlap {
+			continue
+		}
+
+		errors := 0
+		for i := start; i < end; i++ {
+			errors += bits.OnesCount32(a[i] ^ b[i+offset])
+		}
+
+		score := 1 - float64(errors)/float64(32*(end-start))
+		best = max(best, score)
+	}
+
+	// Unrelated audio still agrees on about half its bits
+	return max(0, (best-0.5)*2)
+}
@@ -0,0 +1,131 @@
+package fingerprint
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+// Bit gaps from this size up are stored as an extra 5 bit value
+const maxNormalValue = 7
+
+// Compresses a raw fingerprint into Chromaprint's base64 string format, as
+// produced by fpcalc and accepted by AcoustID
+func Encode(fingerprint []uint32) string {
+	size := len(fingerprint)
+	out := []byte{Algorithm, byte(size >> 16), byte(size >> 8), byte(size)}
+
+	// Each sub-fingerprint is XORed with the one before, then stored as the
+	// gaps between its set bits, ended by a 0
+	var normal, exceptional []uint32
+	var prev uint32
+	for _, x := range fingerprint {
+		x, prev = x^prev, x
+
+		bit, lastBit := uint32(1), uint32(0)
+		for ; x != 0; x >>= 1 {
+			if x&1 != 0 {
+				gap := bit - lastBit
+				if gap >= maxNormalValue {
+					exceptional = append(exceptional, gap-maxNormalValue)
+					gap = maxNormalValue
+				}
+				normal = append(normal, gap)
+				lastBit = bit
+			}
+			bit++
+		}
+		normal = append(normal, 0)
+	}
+
+	out = append(out, packBits(normal, 3)...)
+	out = append(out, packBits(exceptional, 5)...)
+
+	return base64.RawURLEncoding.EncodeToString(out)
+}
+
+// Reverses Encode, returning the raw fingerprint and its algorithm
+func Decode(encoded string) ([]uint32, int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, 0, errors.New("fingerprint isn't valid base64")
+	}
+	if len(data) < 4 {
+		return nil, 0, errors.New("fingerprint is too short")
+	}
+
+	algorithm := int(data[0])
+	size := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+	data = data[4:]
+
+	// Read 3 bit values until every sub-fingerprint has its closing 0
+	var normal []uint32
+	ended, exceptionalCount := 0, 0
+	for i := 0; ended < size; i++ {
+		if i*3+3 > len(data)*8 {
+			return nil, 0, errors.New("fingerprint is truncated")
+		}
+		v := readBits(data, i*3, 3)
+		switch v {
+		case 0:
+			ended++
+		case maxNormalValue:
+			exceptionalCount++
+		}
+		normal = append(normal, v)
+	}
+
+	offset := (len(normal)*3 + 7) / 8
+	if exceptionalCount*5 > (len(data)-offset)*8 {
+		return nil, 0, errors.New("fingerprint is truncated")
+	}
+
+	fingerprint := make([]uint32, 0, size)
+	var x, prev, lastBit uint32
+	exceptional := 0
+	for _, v := range normal {
+		if v == 0 {
+			prev ^= x
+			fingerprint = append(fingerprint, prev)
+			x, lastBit = 0, 0
+			continue
+		}
+
+		if v == maxNormalValue {
+			v += readBits(data[offset:], exceptional*5, 5)
+			exceptional++
+		}
+		lastBit += v
+		if lastBit > 32 {
+			return nil, 0, errors.New("fingerprint is corrupt")
+		}
+		x |= 1 << (lastBit - 1)
+	}
+
+	return fingerprint, algorithm, nil
+}
+
+// Packs values into bytes using a fixed number of bits each, lowest bits first
+func packBits(values []uint32, bits int) []byte {
+	out := make([]byte, (len(values)*bits+7)/8)
+	for i, v := range values {
+		for b := 0; b < bits; b++ {
+			if v&(1<<b) != 0 {
+				pos := i*bits + b
+				out[pos/8] |= 1 << (pos % 8)
+			}
+		}
+	}
+	return out
+}
+
+// Reads a value packed by packBits, starting at a bit position
+func readBits(data []byte, pos int, bits int) uint32 {
+	var v uint32
+	for b := 0; b < bits; b++ {
+		p := pos + b
+		if data[p/8]&(1<<(p%8)) != 0 {
+			v |= 1 << b
+		}
+	}
+	return v
+}
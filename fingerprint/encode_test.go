@@ -0,0 +1,98 @@
+package fingerprint
+
+import (
+	"bytes"
+	"encoding/base64"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// Vectors from Chromaprint's own compressor tests. Only the bytes after the
+// 4 byte header are compared, since Chromaprint's tests use algorithm 0
+var compressorVectors = []struct {
+	name        string
+	fingerprint []uint32
+	body        []byte
+}{
+	{"one item, one bit", []uint32{1}, []byte{1}},
+	{"one item, three bits", []uint32{7}, []byte{73, 0}},
+	{"one item, exceptional bit", []uint32{1 << 6}, []byte{7, 0}},
+	{"one item, larger exceptional bit", []uint32{1 << 8}, []byte{7, 2}},
+	{"two items", []uint32{1, 0}, []byte{65, 0}},
+	{"two items, no change", []uint32{1, 1}, []byte{1, 0}},
+}
+
+func TestEncodeMatchesChromaprint(t *testing.T) {
+	for _, v := range compressorVectors {
+		data, err := base64.RawURLEncoding.DecodeString(Encode(v.fingerprint))
+		if err != nil {
+			t.Fatalf("%s: encoded fingerprint isn't base64: %v", v.name, err)
+		}
+
+		header := []byte{Algorithm, 0, 0, byte(len(v.fingerprint))}
+		if !bytes.Equal(data[:4], header) || !bytes.Equal(data[4:], v.body) {
+			t.Errorf("%s: encoded as %v, want %v then %v", v.name, data, header, v.body)
+		}
+
+		got, algorithm, err := Decode(Encode(v.fingerprint))
+		if err != nil || algorithm != Algorithm || !slices.Equal(got, v.fingerprint) {
+			t.Errorf("%s: decoded as %v, %d, %v", v.name, got, algorithm, err)
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	fingerprints := [][]uint32{
+		{},
+		{0},
+		{0xffffffff, 0, 0xffffffff},
+		{1 << 31, 1, 1 << 31},
+		{0x80000001, 0x00010000},
+	}
+
+	// Realistic prints change a few bits from one sub-fingerprint to the next
+	realistic := make([]uint32, 1000)
+	for i := range realistic {
+		if i > 0 {
+			realistic[i] = realistic[i-1] ^ (1 << r.Intn(32)) ^ (1 << r.Intn(32))
+		}
+	}
+	random := make([]uint32, 1000)
+	for i := range random {
+		random[i] = r.Uint32()
+	}
+	fingerprints = append(fingerprints, realistic, random)
+
+	for _, fp := range fingerprints {
+		encoded := Encode(fp)
+		got, algorithm, err := Decode(encoded)
+		if err != nil {
+			t.Errorf("failed to decode %d sub-fingerprints: %v", len(fp), err)
+			continue
+		}
+		if algorithm != Algorithm || !slices.Equal(got, fp) {
+			t.Errorf("round trip of %d sub-fingerprints gave %d, algorithm %d", len(fp), len(got), algorithm)
+		}
+	}
+}
+
+func TestDecodeRejectsBadInput(t *testing.T) {
+	valid := Encode([]uint32{0x12345678, 0x9abcdef0, 1 << 31})
+	data, _ := base64.RawURLEncoding.DecodeString(valid)
+
+	tests := map[string]string{
+		"not base64":       "not base64!",
+		"short header":     base64.RawURLEncoding.EncodeToString([]byte{Algorithm, 0}),
+		"truncated body":   base64.RawURLEncoding.EncodeToString(data[:len(data)-3]),
+		"oversized length": base64.RawURLEncoding.EncodeToString(append([]byte{Algorithm, 0, 1, 0}, data[4:]...)),
+	}
+
+	for name, encoded := range tests {
+		if fp, _, err := Decode(encoded); err == nil {
+			t.Errorf("%s: decoded as %v", name, fp)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+// Package fingerprint computes Chromaprint-compatible acoustic fingerprints
+// (the default "TEST2" algorithm), which identify recordings regardless of
+// tags, format or bitrate.
+package fingerprint
+
+import (
+	"math"
+)
+
+// Sample rate audio must be converted to (mono) before fingerprinting
+const SampleRate = 11025
+
+// Chromaprint's identifier for the algorithm used
+const Algorithm = 1
+
+const (
+	frameSize      = 4096
+	frameHop       = frameSize / 3 // Chromaprint overlaps frames by 2/3
+	minFreq        = 28
+	maxFreq        = 3520
+	numBands       = 12
+	maxFilterWidth = 16
+)
+
+// Smooths chroma features over time
+var chromaFilter = []float64{0.25, 0.75, 1.0, 0.75, 0.25}
+
+// Compares two areas of the chroma image
+type filter struct {
+	kind   int
+	y      int
+	height int
+	width  int
+}
+
+// Maps a filter's response to 0-3
+type quantizer struct {
+	t0, t1, t2 float64
+}
+
+type classifier struct {
+	filter    filter
+	quantizer quantizer
+}
+
+// Chromaprint's trained classifiers for the TEST2 algorithm. Each one
+// contributes two bits to every 32 bit sub-fingerprint
+var classifiers = []classifier{
+	{filter{0, 4, 3, 15}, quantizer{1.98215, 2.35817, 2.63523}},
+	{filter{4, 4, 6, 15}, quantizer{-1.03809, -0.651211, -0.282167}},
+	{filter{1, 0, 4, 16}, quantizer{-0.298702, 0.119262, 0.558497}},
+	{filter{3, 8, 2, 12}, quantizer{-0.105439, 0.0153946, 0.135898}},
+	{filter{3, 4, 4, 8}, quantizer{-0.142891, 0.0258736, 0.200632}},
+	{filter{4, 0, 3, 5}, quantizer{-0.826319, -0.590612, -0.368214}},
+	{filter{1, 2, 2, 9}, quantizer{-0.557409, -0.233035, 0.0534525}},
+	{filter{2, 7, 3, 4}, quantizer{-0.0646826, 0.00620476, 0.0784847}},
+	{filter{2, 6, 2, 16}, quantizer{-0.192387, -0.029699, 0.215855}},
+	{filter{2, 1, 3, 2}, quantizer{-0.0397818, -0.00568076, 0.0292026}},
+	{filter{5, 10, 1, 15}, quantizer{-0.53823, -0.369934, -0.190235}},
+	{filter{3, 6, 2, 10}, quantizer{-0.124877, 0.0296483, 0.139239}},
+	{filter{2, 1, 1, 14}, quantizer{-0.101475, 0.0225617, 0.231971}},
+	{filter{3, 5, 6, 4}, quantizer{-0.0799915, -0.00729616, 0.063262}},
+	{filter{1, 9, 2, 12}, quantizer{-0.272556, 0.019424, 0.302559}},
+	{filter{3, 4, 2, 14}, quantizer{-0.164292, -0.0321188, 0.0846339}},
+}
+
+// Two bit gray code for quantized values, so neighbors differ by one bit
+var grayCode = []uint32{0, 1, 3, 2}
+
+// Computes the raw fingerprint of mono audio sampled at SampleRate, with
+// samples in [-1, 1]. Returns nil if the audio is too short
+func Calculate(samples []float64) []uint32 {
+	window := make([]float64, frameSize)
+	for i := range window {
+		window[i] = 0.54 - 0.46*math.Cos(float64(i)*2*math.Pi/(frameSize-1))
+	}
+
+	// Which chroma band each FFT bin falls in
+	minIndex := max(1, freqToIndex(minFreq))
+	maxIndex := min(frameSize/2, freqToIndex(maxFreq))
+	notes := make([]int, maxIndex)
+	for i := minIndex; i < maxIndex; i++ {
+		freq := float64(i) * SampleRate / frameSize
+		octave := math.Log2(freq / (440.0 / 16))
+		notes[i] = int(numBands * (octave - math.Floor(octave)))
+	}
+
+	var chromas [][]float64
+	buf := make([]complex128, frameSize)
+	for start := 0; start+frameSize <= len(samples); start += frameHop {
+		for i := range buf {
+			buf[i] = complex(samples[start+i]*window[i], 0)
+		}
+		fft(buf)
+
+		chroma := make([]float64, numBands)
+		for i := minIndex; i < maxIndex; i++ {
+			re, im := real(buf[i]), imag(buf[i])
+			chroma[notes[i]] += re*re + im*im
+		}
+		chromas = append(chromas, chroma)
+	}
+
+	// Chromaprint only starts filtering once a full window of frames has
+	// been buffered, so the first output comes from frames 1-5
+	var image [][]float64
+	for t := len(chromaFilter); t < len(chromas); t++ {
+		row := make([]float64, numBands)
+		for j, coef := range chromaFilter {
+			frame := chromas[t-len(chromaFilter)+1+j]
+			for b := range row {
+				row[b] += frame[b] * coef
+			}
+		}
+		normalize(row)
+		image = append(image, row)
+	}
+
+	if len(image) < maxFilterWidth {
+		return nil
+	}
+
+	integral := newIntegralImage(image)
+	fingerprint := make([]uint32, 0, len(image)-maxFilterWidth+1)
+	for offset := 0; offset+maxFilterWidth <= len(image); offset++ {
+		var bits uint32
+		for _, c := range classifiers {
+			bits = bits<<2 | grayCode[c.quantizer.quantize(c.filter.apply(integral, offset))]
+		}
+		fingerprint = append(fingerprint, bits)
+	}
+
+	return fingerprint
+}
+
+func freqToIndex(freq float64) int {
+	return int(math.Round(frameSize * freq / SampleRate))
+}
+
+// Scales a vector to unit length, or zeroes it if it's near silent
+func normalize(v []float64) {
+	var sum float64
+	for _, x := range v {
+		sum += x * x
+	}
+
+	norm := math.Sqrt(sum)
+	for i := range v {
+		if norm < 0.01 {
+			v[i] = 0
+		} else {
+			v[i] /= norm
+		}
+	}
+}
+
+func (q quantizer) quantize(value float64) int {
+	if value < q.t1 {
+		if value < q.t0 {
+			return 0
+		}
+		return 1
+	}
+	if value < q.t2 {
+		return 2
+	}
+	return 3
+}
+
+// Sums of the chroma image, so any rectangle's total is four lookups
+type integralImage struct {
+	sums [][]float64
+}
+
+func newIntegralImage(image [][]float64) *integralImage {
+	sums := make([][]float64, len(image))
+	for r, row := range image {
+		sums[r] = make([]float64, numBands)
+		var rowSum float64
+		for c, v := range row {
+			rowSum += v
+			sums[r][c] = rowSum
+			if r > 0 {
+				sums[r][c] += sums[r-1][c]
+			}
+		}
+	}
+	return &integralImage{sums: sums}
+}
+
+// Total over rows [r1, r2) and columns [c1, c2)
+func (img *integralImage) area(r1, c1, r2, c2 int) float64 {
+	if r1 == r2 || c1 == c2 {
+		return 0
+	}
+
+	at := func(r, c int) float64 {
+		if r < 0 || c < 0 {
+			return 0
+		}
+		return img.sums[r][c]
+	}
+
+	return at(r2-1, c2-1) - at(r1-1, c2-1) - at(r2-1, c1-1) + at(r1-1, c1-1)
+}
+
+func subtractLog(a, b float64) float64 {
+	return math.Log(1+a) - math.Log(1+b)
+}
+
+// Applies the filter at a time offset. x runs along time, y along chroma bands
+func (f filter) apply(img *integralImage, x int) float64 {
+	y, w, h := f.y, f.width, f.height
+
+	switch f.kind {
+	case 0:
+		return subtractLog(img.area(x, y, x+w, y+h), 0)
+	case 1:
+		h2 := h / 2
+		return subtractLog(img.area(x, y+h2, x+w, y+h), img.area(x, y, x+w, y+h2))
+	case 2:
+		w2 := w / 2
+		return subtractLog(img.area(x+w2, y, x+w, y+h), img.area(x, y, x+w2, y+h))
+	case 3:
+		w2, h2 := w/2, h/2
+		a := img.area(x, y+h2, x+w2, y+h) + img.area(x+w2, y, x+w, y+h2)
+		b := img.area(x, y, x+w2, y+h2) + img.area(x+w2, y+h2, x+w, y+h)
+		return subtractLog(a, b)
+	case 4:
+		h3 := h / 3
+		a := img.area(x, y+h3, x+w, y+2*h3)
+		b := img.area(x, y, x+w, y+h3) + img.area(x, y+2*h3, x+w, y+h)
+		return subtractLog(a, b)
+	case 5:
+		w3 := w / 3
+		a := img.area(x+w3, y, x+2*w3, y+h)
+		b := img.area(x, y, x+w3, y+h) + img.area(x+2*w3, y, x+w, y+h)
+		return subtractLog(a, b)
+	}
+
+	return 0
+}
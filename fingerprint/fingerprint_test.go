@@ -0,0 +1,153 @@
+package fingerprint
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Generates a tune: a new note from the scale every half second, with a
+// quieter fifth above it so the chroma isn't a single band
+func generateTune(seconds float64, notes []float64) []float64 {
+	samples := make([]float64, int(seconds*SampleRate))
+	noteLength := SampleRate / 2
+	for i := range samples {
+		freq := notes[(i/noteLength)%len(notes)]
+		t := float64(i) / SampleRate
+		samples[i] = 0.4*math.Sin(2*math.Pi*freq*t) + 0.2*math.Sin(2*math.Pi*freq*1.5*t)
+	}
+	return samples
+}
+
+var (
+	cMajor = []float64{261.63, 293.66, 329.63, 349.23, 392.00, 440.00, 493.88, 523.25}
+	other  = []float64{311.13, 466.16, 277.18, 415.30, 369.99, 554.37, 233.08, 622.25}
+)
+
+// Rounds samples to 16 bits, as they'd be stored in a WAV file
+func quantize16(samples []float64) []float64 {
+	out := make([]float64, len(samples))
+	for i, s := range samples {
+		out[i] = float64(int16(math.Round(s*32767))) / 32768
+	}
+	return out
+}
+
+func TestCalculate(t *testing.T) {
+	tune := generateTune(20, cMajor)
+
+	fp := Calculate(tune)
+
+	// One sub-fingerprint per hop, less the frames the filters need
+	frames := (len(tune)-frameSize)/frameHop + 1
+	if want := frames - len(chromaFilter) - maxFilterWidth + 1; len(fp) != want {
+		t.Fatalf("got %d sub-fingerprints, want %d", len(fp), want)
+	}
+
+	if !slices.Equal(Calculate(tune), fp) {
+		t.Error("fingerprinting the same audio twice gave different results")
+	}
+
+	// Chroma is normalized, so volume and 16 bit rounding barely matter
+	quieter := make([]float64, len(tune))
+	for i, s := range tune {
+		quieter[i] = s / 2
+	}
+	if got := Similarity(fp, Calculate(quantize16(quieter))); got < 0.9 {
+		t.Errorf("quieter copy has similarity %g", got)
+	}
+
+	// Lined up regardless of a second of leading silence
+	delayed := append(make([]float64, SampleRate), tune...)
+	if got := Similarity(fp, Calculate(delayed)); got < 0.8 {
+		t.Errorf("delayed copy has similarity %g", got)
+	}
+
+	if got := Similarity(fp, Calculate(generateTune(20, other))); got > 0.5 {
+		t.Errorf("a different tune has similarity %g", got)
+	}
+}
+
+func TestCalculateShortAudio(t *testing.T) {
+	if fp := Calculate(generateTune(1, cMajor)); fp != nil {
+		t.Errorf("a second of audio gave %d sub-fingerprints", len(fp))
+	}
+	if fp := Calculate(nil); fp != nil {
+		t.Errorf("no audio gave %d sub-fingerprints", len(fp))
+	}
+}
+
+// Writes mono 16 bit samples as a WAV file at SampleRate
+func writeWAV(t *testing.T, path string, samples []float64) {
+	t.Helper()
+
+	var data bytes.Buffer
+	for _, s := range samples {
+		binary.Write(&data, binary.LittleEndian, int16(math.Round(s*32767)))
+	}
+
+	var wav bytes.Buffer
+	wav.WriteString("RIFF")
+	binary.Write(&wav, binary.LittleEndian, uint32(36+data.Len()))
+	wav.WriteString("WAVEfmt ")
+	for _, field := range []any{
+		uint32(16), uint16(1), uint16(1), uint32(SampleRate), uint32(SampleRate * 2), uint16(2), uint16(16),
+	} {
+		binary.Write(&wav, binary.LittleEndian, field)
+	}
+	wav.WriteString("data")
+	binary.Write(&wav, binary.LittleEndian, uint32(data.Len()))
+	wav.Write(data.Bytes())
+
+	if err := os.WriteFile(path, wav.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Compares against Chromaprint itself. The tune is already mono at
+// SampleRate, so fpcalc fingerprints the same samples without resampling
+func TestCalculateMatchesFpcalc(t *testing.T) {
+	fpcalc, err := exec.LookPath("fpcalc")
+	if err != nil {
+		t.Skip("fpcalc isn't installed")
+	}
+
+	tune := generateTune(30, cMajor)
+	path := filepath.Join(t.TempDir(), "tune.wav")
+	writeWAV(t, path, tune)
+
+	out, err := exec.Command(fpcalc, "-raw", "-length", "120", path).Output()
+	if err != nil {
+		t.Fatalf("fpcalc failed: %v", err)
+	}
+
+	var want []uint32
+	for _, line := range strings.Split(string(out), "\n") {
+		values, ok := strings.CutPrefix(strings.TrimSpace(line), "FINGERPRINT=")
+		if !ok {
+			continue
+		}
+		for _, value := range strings.Split(values, ",") {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				t.Fatalf("fpcalc printed %q: %v", value, err)
+			}
+			want = append(want, uint32(n))
+		}
+	}
+	if len(want) == 0 {
+		t.Fatalf("fpcalc printed no fingerprint: %s", out)
+	}
+
+	got := Calculate(quantize16(tune))
+	if similarity := Similarity(got, want); similarity < 0.95 {
+		t.Errorf("similarity to fpcalc's fingerprint is %g (%d vs %d sub-fingerprints)", similarity, len(got), len(want))
+	}
+}
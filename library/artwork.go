@@ -0,0 +1,249 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"openturntable/database"
+	"openturntable/playback"
+)
+
+// Settings key the artwork settings are stored under
+const artworkSettingsKey = "artwork_settings"
+
+// Where album art is looked for during imports
+type ArtworkSettings struct {
+	// Image names (without extension, ignoring case) used as the front cover
+	// when found next to the audio files, in priority order
+	CoverNames []string
+	// Use a cover embedded in the files over one found in the folder
+	PreferEmbedded bool
+}
+
+// The settings used until someone changes them
+var defaultArtworkSettings = ArtworkSettings{
+	CoverNames:     []string{"cover", "folder", "front", "album", "albumart"},
+	PreferEmbedded: true,
+}
+
+// Other kinds of picture recognized next to audio files, by image name
+var folderPictureNames = []struct{ name, kind string }{
+	{"back", playback.PictureBack},
+	{"artist", playback.PictureArtist},
+}
+
+// Image extensions looked for next to audio files
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+}
+
+// A picture found for a file's album, stored in the artwork cache
+type albumPicture struct {
+	Kind   string
+	Art    string
+	Source string
+}
+
+// An image file already stored in the artwork cache, so unchanged images
+// aren't hashed again for every track in their folder
+type storedImage struct {
+	size    int64
+	modTime int64
+	hash    string
+}
+
+// Gets the stored artwork settings
+func (l *Library) GetArtworkSettings() (ArtworkSettings, error) {
+	value, ok, err := l.db.GetSetting(artworkSettingsKey)
+	if err != nil || !ok {
+		return defaultArtworkSettings, err
+	}
+
+	var settings ArtworkSettings
+	if err := json.Unmarshal([]byte(value), &settings); err != nil {
+		return defaultArtworkSettings, fmt.Errorf("failed to decode artwork settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// Stores new artwork settings. They apply from the next import or rescan
+func (l *Library) SetArtworkSettings(settings ArtworkSettings) error {
+	for i, name := range settings.CoverNames {
+		name = strings.TrimSpace(name)
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("invalid cover name %q", settings.CoverNames[i])
+		}
+		settings.CoverNames[i] = name
+	}
+
+	value, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to encode artwork settings: %w", err)
+	}
+
+	return l.db.SetSetting(artworkSettingsKey, string(value))
+}
+
+// Loads the stored artwork settings, falling back to the defaults if they
+// can't be read
+func (l *Library) currentArtworkSettings() ArtworkSettings {
+	settings, err := l.GetArtworkSettings()
+	if err != nil {
+		log.Println("error loading artwork settings, using defaults:", err)
+	}
+	return settings
+}
+
+// Stores a file's embedded pictures and the images next to it in the
+// artwork cache. Returns every picture found, and which to use as the album
+// cover
+func (l *Library) filePictures(filePath string, embedded []playback.Picture, settings ArtworkSettings) (string, []albumPicture) {
+	var pictures []albumPicture
+
+	var embeddedCover string
+	front := playback.FrontCover(embedded)
+	for i, pic := range embedded {
+		hash, err := l.artwork.Store(pic.Data)
+		if err != nil {
+			log.Printf("error storing artwork from %s: %v\n", filePath, err)
+			continue
+		}
+
+		pictures = append(pictures, albumPicture{pic.Kind, hash, database.ArtworkEmbedded})
+		if front == &embedded[i] {
+			embeddedCover = hash
+		}
+	}
+
+	folderCover, folderPictures := l.folderPictures(filepath.Dir(filePath), settings)
+	pictures = append(pictures, folderPictures...)
+
+	if embeddedCover != "" && (settings.PreferEmbedded || folderCover == "") {
+		return embeddedCover, pictures
+	}
+	return folderCover, pictures
+}
+
+// Finds and stores the images in a folder that are covers (by the settings'
+// names) or other recognized pictures
+func (l *Library) folderPictures(dir string, settings ArtworkSettings) (string, []albumPicture) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", nil
+	}
+
+	images := make(map[string]string)
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || !imageExtensions[ext] {
+			continue
+		}
+
+		name := strings.ToLower(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		if _, ok := images[name]; !ok {
+			images[name] = filepath.Join(dir, entry.Name())
+		}
+	}
+
+	var cover string
+	var pictures []albumPicture
+
+	for _, name := range settings.CoverNames {
+		path, ok := images[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+
+		if hash := l.storeImageFile(path); hash != "" {
+			cover = hash
+			pictures = append(pictures, albumPicture{playback.PictureFront, hash, database.ArtworkFolder})
+			break
+		}
+	}
+
+	for _, named := range folderPictureNames {
+		if path, ok := images[named.name]; ok {
+			if hash := l.storeImageFile(path); hash != "" {
+				pictures = append(pictures, albumPicture{named.kind, hash, database.ArtworkFolder})
+			}
+		}
+	}
+
+	return cover, pictures
+}
+
+// Stores an image file in the artwork cache, returning its hash or "" if
+// it can't be read
+func (l *Library) storeImageFile(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+
+	if v, ok := l.images.Load(path); ok {
+		if stored := v.(storedImage); stored.size == info.Size() && stored.modTime == info.ModTime().UnixNano() {
+			return stored.hash
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("error reading %s: %v\n", path, err)
+		return ""
+	}
+
+	hash, err := l.artwork.Store(data)
+	if err != nil {
+		log.Printf("error storing artwork from %s: %v\n", path, err)
+		return ""
+	}
+
+	l.images.Store(path, storedImage{info.Size(), info.ModTime().UnixNano(), hash})
+	return hash
+}
+
+// Moves album art stored inline in the database (as data: URIs, from older
+// versions) into the artwork cache, then compacts the database to reclaim
+// the space
+func (l *Library) MigrateArtwork() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	inline, err := l.db.GetInlineAlbumArt()
+	if err != nil {
+		return err
+	}
+	if len(inline) == 0 {
+		return nil
+	}
+
+	log.Printf("moving art for %d albums into the artwork cache\n", len(inline))
+	moved := 0
+	for id, uri := range inline {
+		// Art that can't be stored is left where it is rather than lost
+		hash, err := l.artwork.StoreDataURI(uri)
+		if err != nil {
+			log.Printf("error moving art for album %d: %v\n", id, err)
+			continue
+		}
+
+		if err := l.db.SetAlbumArt(id, hash); err != nil {
+			return err
+		}
+		moved++
+	}
+
+	// Nothing to reclaim if every album failed
+	if moved == 0 {
+		return nil
+	}
+	return l.db.Vacuum()
+}
@@ -0,0 +1,65 @@
+package library
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"testing"
+
+	"openturntable/database"
+)
+
+func TestMigrateArtwork(t *testing.T) {
+	l := newTestLibrary(t)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 40, 40))); err != nil {
+		t.Fatal(err)
+	}
+
+	albums := map[string]string{
+		"good":     "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()),
+		"bad data": "data:image/png;base64,!!!",
+		"not art":  "data:text/plain;base64," + base64.StdEncoding.EncodeToString([]byte("hello")),
+	}
+	ids := make(map[string]int64)
+	for name, art := range albums {
+		id, err := l.db.CreateAlbum(database.Album{Name: name, Art: art})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[name] = id
+	}
+
+	if err := l.MigrateArtwork(); err != nil {
+		t.Fatal(err)
+	}
+
+	album, err := l.db.GetAlbumById(ids["good"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.artwork.Has(album.Art) {
+		t.Errorf("migrated album art is %q, want a cached hash", album.Art)
+	}
+
+	// Art that couldn't be moved is kept as it was, and left for next time
+	for _, name := range []string{"bad data", "not art"} {
+		album, err := l.db.GetAlbumById(ids[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if album.Art != albums[name] {
+			t.Errorf("%s album art became %q", name, album.Art)
+		}
+	}
+	inline, err := l.db.GetInlineAlbumArt()
+	if err != nil || len(inline) != 2 {
+		t.Errorf("inline art left is %v, %v", inline, err)
+	}
+
+	if err := l.MigrateArtwork(); err != nil {
+		t.Errorf("migrating again failed: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package library
+
+import (
+	"os"
+
+	"openturntable/database"
+	"openturntable/tagwriter"
+)
+
+// What writing tags back to an album's files did
+type TagWriteReport struct {
+	Written int
+	Failed  []ImportError
+}
+
+// Sets an album's cover to an image file, optionally embedding it in every
+// track's tags too. The image is checked and scaled down as needed before
+// it's stored
+func (l *Library) SetAlbumArt(albumID int64, imagePath string, writeToFiles bool) (TagWriteReport, error) {
+	if _, err := l.db.GetAlbumById(albumID); err != nil {
+		return TagWriteReport{}, err
+	}
+
+	hash, err := l.artwork.StoreFile(imagePath)
+	if err != nil {
+		return TagWriteReport{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.db.SetAlbumCover(albumID, hash); err != nil {
+		return TagWriteReport{}, err
+	}
+	if !writeToFiles {
+		return TagWriteReport{}, nil
+	}
+
+	data, mimeType, err := l.artwork.Read(hash)
+	if err != nil {
+		return TagWriteReport{}, err
+	}
+
+	return l.writeAlbumTags(albumID, tagwriter.Changes{
+		Cover: &tagwriter.Picture{MIMEType: mimeType, Data: data},
+	})
+}
+
+// Removes an album's cover, optionally taking it out of every track's tags
+// too. A cover found again in the files or their folder comes back on the
+// next rescan
+func (l *Library) ClearAlbumArt(albumID int64, writeToFiles bool) (TagWriteReport, error) {
+	if _, err := l.db.GetAlbumById(albumID); err != nil {
+		return TagWriteReport{}, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.db.SetAlbumCover(albumID, ""); err != nil {
+		return TagWriteReport{}, err
+	}
+	if !writeToFiles {
+		return TagWriteReport{}, nil
+	}
+
+	return l.writeAlbumTags(albumID, tagwriter.Changes{RemoveCover: true})
+}
+
+// Sets an artist's picture to an image file
+func (l *Library) SetArtistPicture(artistID int64, imagePath string) error {
+	if _, err := l.db.GetArtistById(artistID); err != nil {
+		return err
+	}
+
+	hash, err := l.artwork.StoreFile(imagePath)
+	if err != nil {
+		return err
+	}
+
+	return l.db.SetArtistPicture(artistID, hash)
+}
+
+// Removes an artist's picture, so one from their albums is shown instead
+func (l *Library) ClearArtistPicture(artistID int64) error {
+	if _, err := l.db.GetArtistById(artistID); err != nil {
+		return err
+	}
+
+	return l.db.SetArtistPicture(artistID, "")
+}
+
+// Writes tag changes to every track of an album that's on disk. The
+// caller must hold l.mu
+func (l *Library) writeAlbumTags(albumID int64, changes tagwriter.Changes) (TagWriteReport, error) {
+	songs, err := l.db.GetSongsInAlbum(albumID)
+	if err != nil {
+		return TagWriteReport{}, err
+	}
+
+	var report TagWriteReport
+	for _, song := range songs {
+		if song.Missing {
+			continue
+		}
+
+		if err := l.writeTags(song, changes); err != nil {
+			report.Failed = append(report.Failed, ImportError{Path: song.Path, Error: err.Error()})
+			continue
+		}
+		report.Written++
+	}
+
+	return report, nil
+}
+
+// Writes tag changes to a song's file, then stores the file's new size,
+// time and hash (if it had one) so rescans and the watcher don't see it as
+// changed and import it again. The caller must hold l.mu
+func (l *Library) writeTags(song database.Song, changes tagwriter.Changes) error {
+	if err := tagwriter.Write(song.Path, changes); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(song.Path)
+	if err != nil {
+		return err
+	}
+
+	// Songs that were never hashed don't need one now
+	hash := ""
+	if song.ContentHash != "" {
+		if hash, err = HashFile(song.Path); err != nil {
+			return err
+		}
+	}
+
+	return l.db.SetSongFile(song.ID, info.Size(), info.ModTime().Unix(), hash)
+}
@@ -0,0 +1,264 @@
+package library
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+
+	"openturntable/database"
+	"openturntable/fingerprint"
+)
+
+// Ways of deciding two songs are the same track
+const (
+	DuplicatesByTags        = "tags"        // same normalized title and artist, similar duration
+	DuplicatesByHash        = "hash"        // byte-for-byte identical files
+	DuplicatesByFingerprint = "fingerprint" // same audio, even re-encoded (songs must be fingerprinted)
+)
+
+// Longest difference in duration (seconds) for songs matched by tags
+const duplicateDurationTolerance = 2.0
+
+// Songs found to be the same track, and which copy is the best to keep
+type DuplicateGroup struct {
+	Key    string
+	Songs  []database.SongWithDetails
+	BestID int64
+}
+
+// Groups songs that look like copies of the same track, using one of the
+// DuplicatesBy methods. Each group suggests the highest quality copy to keep.
+// Matching by fingerprint only considers songs that have been fingerprinted
+func (l *Library) FindDuplicates(method string) ([]DuplicateGroup, error) {
+	songs, err := l.db.GetSongsWithDetails()
+	if err != nil {
+		return nil, err
+	}
+
+	var groups [][]database.SongWithDetails
+	switch method {
+	case DuplicatesByTags, "":
+		groups = groupByTags(songs)
+	case DuplicatesByHash:
+		l.fillContentHashes(songs)
+		groups = groupBy(songs, func(s database.SongWithDetails) string { return s.ContentHash })
+	case DuplicatesByFingerprint:
+		plain := make([]database.Song, len(songs))
+		for i, song := range songs {
+			plain[i] = song.Song
+		}
+		groups = groupByFingerprint(songs, l.storedFingerprints(plain))
+	default:
+		return nil, fmt.Errorf("unknown duplicate method %q", method)
+	}
+
+	var result []DuplicateGroup
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+
+		best := group[0]
+		for _, song := range group[1:] {
+			if betterCopy(song.Song, best.Song) {
+				best = song
+			}
+		}
+
+		result = append(result, DuplicateGroup{
+			Key:    duplicateLabel(group[0]),
+			Songs:  group,
+			BestID: best.ID,
+		})
+	}
+
+	return result, nil
+}
+
+// Merges duplicates into the song being kept, see database.MergeSongs
+func (l *Library) MergeDuplicates(keepID int64, removeIDs []int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.db.MergeSongs(keepID, removeIDs)
+}
+
+// Hashes the songs that could have an identical copy (another song has the
+// same file size) but haven't been hashed yet, storing the hashes
+func (l *Library) fillContentHashes(songs []database.SongWithDetails) {
+	sizes := make(map[int64]int)
+	for _, song := range songs {
+		sizes[song.FileSize]++
+	}
+
+	for i, song := range songs {
+		if song.ContentHash != "" || song.Missing || song.FileSize == 0 || sizes[song.FileSize] < 2 {
+			continue
+		}
+
+		hash, err := HashFile(song.Path)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if err := l.db.SetSongContentHash(song.ID, hash); err != nil {
+			log.Println(err)
+		}
+		songs[i].ContentHash = hash
+	}
+}
+
+// Groups songs by a key, leaving out songs with an empty key. Groups come
+// back in order of first appearance
+func groupBy(songs []database.SongWithDetails, key func(database.SongWithDetails) string) [][]database.SongWithDetails {
+	index := make(map[string]int)
+	var groups [][]database.SongWithDetails
+
+	for _, song := range songs {
+		k := key(song)
+		if k == "" {
+			continue
+		}
+
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], song)
+	}
+
+	return groups
+}
+
+// Groups songs by normalized title and artist, then splits each group
+// wherever durations are too far apart to be the same recording
+func groupByTags(songs []database.SongWithDetails) [][]database.SongWithDetails {
+	byName := groupBy(songs, func(s database.SongWithDetails) string {
+		title := normalizeName(s.Title)
+		if title == "" {
+			return ""
+		}
+		return title + "\x00" + normalizeName(s.ArtistName.String)
+	})
+
+	var groups [][]database.SongWithDetails
+	for _, group := range byName {
+		sort.SliceStable(group, func(i, j int) bool { return group[i].Duration < group[j].Duration })
+
+		start := 0
+		for i := 1; i <= len(group); i++ {
+			if i == len(group) || group[i].Duration-group[i-1].Duration > duplicateDurationTolerance {
+				groups = append(groups, group[start:i])
+				start = i
+			}
+		}
+	}
+
+	return groups
+}
+
+// Groups songs whose fingerprints match, comparing each song only with
+// those of a similar duration
+func groupByFingerprint(songs []database.SongWithDetails, fps map[int64][]uint32) [][]database.SongWithDetails {
+	var candidates []database.SongWithDetails
+	for _, song := range songs {
+		if _, ok := fps[song.ID]; ok {
+			candidates = append(candidates, song)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Duration < candidates[j].Duration })
+
+	grouped := make(map[int64]bool)
+	var groups [][]database.SongWithDetails
+	for i, song := range candidates {
+		if grouped[song.ID] {
+			continue
+		}
+
+		group := []database.SongWithDetails{song}
+		for _, other := range candidates[i+1:] {
+			if other.Duration-song.Duration > duplicateDurationTolerance {
+				break
+			}
+			if grouped[other.ID] {
+				continue
+			}
+
+			if fingerprint.Similarity(fps[song.ID], fps[other.ID]) >= fingerprintMatchThreshold {
+				grouped[other.ID] = true
+				group = append(group, other)
+			}
+		}
+		groups = append(groups, group)
+	}
+
+	return groups
+}
+
+// Lowercases a name and drops everything but letters and digits, so
+// "Don't Stop  Me Now" and "dont stop me now" compare equal
+func normalizeName(name string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		case unicode.IsSpace(r):
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// A readable name for a group
+func duplicateLabel(song database.SongWithDetails) string {
+	if song.ArtistName.String == "" {
+		return song.Title
+	}
+	return song.ArtistName.String + " - " + song.Title
+}
+
+// Reports whether a is a better copy to keep than b: files that exist beat
+// missing ones, lossless beats lossy, then higher resolution or bitrate,
+// then more plays, then the older song
+func betterCopy(a database.Song, b database.Song) bool {
+	if a.Missing != b.Missing {
+		return !a.Missing
+	}
+
+	if lossless(a.Codec) != lossless(b.Codec) {
+		return lossless(a.Codec)
+	}
+
+	if lossless(a.Codec) {
+		if a.BitDepth*a.SampleRate != b.BitDepth*b.SampleRate {
+			return a.BitDepth*a.SampleRate > b.BitDepth*b.SampleRate
+		}
+		// FLAC over WAV, since it's smaller and holds tags properly
+		if a.Codec != b.Codec {
+			return a.Codec == "flac"
+		}
+	} else if a.Bitrate != b.Bitrate {
+		return a.Bitrate > b.Bitrate
+	}
+
+	if a.PlayCount != b.PlayCount {
+		return a.PlayCount > b.PlayCount
+	}
+
+	return a.ID < b.ID
+}
+
+// Reports whether a codec is lossless
+func lossless(codec string) bool {
+	return codec == "flac" || codec == "wav"
+}
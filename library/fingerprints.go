@@ -0,0 +1,219 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+
+	"openturntable/database"
+	"openturntable/fingerprint"
+	"openturntable/playback"
+)
+
+// Seconds of audio fingerprinted from the start of each file, matching
+// fpcalc's default
+const fingerprintLength = 120
+
+// Lowest similarity for two songs to count as the same recording
+const fingerprintMatchThreshold = 0.9
+
+// Where a fingerprinting job is up to
+type FingerprintProgress struct {
+	Total   int    // songs that need a fingerprint
+	Done    int    // songs fingerprinted (or failed)
+	Failed  int    // songs whose audio couldn't be decoded
+	Current string // most recently fingerprinted file
+}
+
+// Computes the fingerprint of an audio file
+func Fingerprint(filePath string) ([]uint32, error) {
+	samples, err := playback.ReadSamples(filePath, fingerprint.SampleRate, fingerprintLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", filePath, err)
+	}
+
+	fp := fingerprint.Calculate(samples)
+	if fp == nil {
+		return nil, fmt.Errorf("%s is too short to fingerprint", filePath)
+	}
+
+	return fp, nil
+}
+
+// Gets a song's fingerprint, computing and storing it if it hasn't been yet
+func (l *Library) songFingerprint(song database.Song) ([]uint32, error) {
+	encoded, ok, err := l.db.GetSongFingerprint(song.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		fp, _, err := fingerprint.Decode(encoded)
+		if err == nil {
+			return fp, nil
+		}
+		log.Printf("stored fingerprint for song %d is invalid: %v\n", song.ID, err)
+	}
+
+	if song.Missing {
+		return nil, fmt.Errorf("the file for song %d is missing", song.ID)
+	}
+
+	fp, err := Fingerprint(song.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := l.db.SetSongFingerprint(song.ID, fingerprint.Encode(fp)); err != nil {
+		return nil, err
+	}
+
+	return fp, nil
+}
+
+// Scores how alike two songs' audio is, from 0 (unrelated) to 1 (the same
+// recording). Fingerprints are computed for songs that don't have one yet
+func (l *Library) CompareSongs(aID int64, bID int64) (float64, error) {
+	var fps [2][]uint32
+	for i, id := range []int64{aID, bID} {
+		song, err := l.db.GetSongById(id)
+		if err != nil {
+			return 0, err
+		}
+
+		if fps[i], err = l.songFingerprint(song); err != nil {
+			return 0, err
+		}
+	}
+
+	return fingerprint.Similarity(fps[0], fps[1]), nil
+}
+
+// Fingerprints every song that doesn't have a fingerprint yet, decoding
+// files in parallel. onProgress, if set, is called at most every
+// progressInterval and once more at the end. Only one job runs at a time,
+// and CancelFingerprinting stops it early
+func (l *Library) FingerprintLibrary(onProgress func(FingerprintProgress)) (FingerprintProgress, error) {
+	var progress FingerprintProgress
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l.importMu.Lock()
+	if l.fingerprintCancel != nil {
+		l.importMu.Unlock()
+		return progress, errors.New("fingerprinting is already running")
+	}
+	l.fingerprintCancel = cancel
+	l.importMu.Unlock()
+
+	defer func() {
+		l.importMu.Lock()
+		l.fingerprintCancel = nil
+		l.importMu.Unlock()
+	}()
+
+	songs, err := l.db.GetSongsWithoutFingerprint()
+	if err != nil {
+		return progress, err
+	}
+	progress.Total = len(songs)
+
+	jobs := make(chan database.Song)
+	var mu sync.Mutex
+	var lastUpdate time.Time
+
+	var wg sync.WaitGroup
+	for range min(runtime.NumCPU(), maxImportWorkers) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for song := range jobs {
+				fp, err := Fingerprint(song.Path)
+				if err == nil {
+					err = l.db.SetSongFingerprint(song.ID, fingerprint.Encode(fp))
+				}
+
+				mu.Lock()
+				if err != nil {
+					log.Println(err)
+					progress.Failed++
+				}
+				progress.Done++
+				progress.Current = song.Path
+				if onProgress != nil && time.Since(lastUpdate) >= progressInterval {
+					lastUpdate = time.Now()
+					onProgress(progress)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, song := range songs {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- song
+	}
+	close(jobs)
+	wg.Wait()
+
+	if onProgress != nil {
+		onProgress(progress)
+	}
+
+	return progress, nil
+}
+
+// Reports whether a fingerprinting job is running
+func (l *Library) Fingerprinting() bool {
+	l.importMu.Lock()
+	defer l.importMu.Unlock()
+
+	return l.fingerprintCancel != nil
+}
+
+// Stops the running fingerprinting job. Returns false if there isn't one
+func (l *Library) CancelFingerprinting() bool {
+	l.importMu.Lock()
+	defer l.importMu.Unlock()
+
+	if l.fingerprintCancel == nil {
+		return false
+	}
+
+	l.fingerprintCancel()
+	return true
+}
+
+// Loads stored fingerprints for the given songs, skipping any that are
+// missing or invalid
+func (l *Library) storedFingerprints(songs []database.Song) map[int64][]uint32 {
+	stored, err := l.db.GetSongFingerprints()
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	fps := make(map[int64][]uint32)
+	for _, song := range songs {
+		encoded, ok := stored[song.ID]
+		if !ok {
+			continue
+		}
+
+		fp, _, err := fingerprint.Decode(encoded)
+		if err != nil {
+			continue
+		}
+		fps[song.ID] = fp
+	}
+
+	return fps
+}
@@ -0,0 +1,327 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Songs saved per transaction during an import
+const importBatchSize = 50
+
+// Most files read in parallel during an import
+const maxImportWorkers = 8
+
+// Least time between progress updates
+const progressInterval = 100 * time.Millisecond
+
+// Where an import job is up to
+type ImportProgress struct {
+	Seen      int     // audio files found so far
+	Processed int     // files read and saved (or failed, or skipped)
+	Failed    int     // files that couldn't be imported
+	Skipped   int     // files and folders left out by the import rules
+	Current   string  // most recently processed file
+	Scanning  bool    // still looking for files
+	ETA       float64 // seconds left, -1 until every file has been found
+}
+
+// A file that couldn't be imported, and why
+type ImportError struct {
+	Path  string
+	Error string
+}
+
+// What an import job did
+type ImportReport struct {
+	Folder    string
+	Seen      int
+	Added     int
+	Updated   int
+	Failed    int
+	Skipped   int
+	Cancelled bool
+	Elapsed   float64 // seconds
+	Errors    []ImportError
+	// Files and folders left out by the import rules
+	SkippedFiles []SkippedFile
+}
+
+// The outcome of reading (or skipping) one file
+type importResult struct {
+	file    scannedFile
+	err     error
+	skipped string
+}
+
+// Imports every audio file in a folder (recursively), leaving out whatever
+// the import rules say to skip. Files are read by a pool of workers and saved
+// in batched transactions. onProgress, if set, is called at most every
+// progressInterval and once more at the end. Only one import runs at a time,
+// and CancelImport stops it early
+func (l *Library) Import(folder string, onProgress func(ImportProgress)) (ImportReport, error) {
+	report := ImportReport{Folder: filepath.Clean(folder)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l.importMu.Lock()
+	if l.importCancel != nil {
+		l.importMu.Unlock()
+		return report, errors.New("an import is already running")
+	}
+	l.importCancel = cancel
+	l.importMu.Unlock()
+
+	defer func() {
+		l.importMu.Lock()
+		l.importCancel = nil
+		l.importMu.Unlock()
+	}()
+
+	if info, err := os.Stat(report.Folder); err != nil {
+		return report, fmt.Errorf("failed to read folder: %w", err)
+	} else if !info.IsDir() {
+		return report, fmt.Errorf("%s is not a folder", report.Folder)
+	}
+
+	rules := l.currentRules()
+	artworkSettings := l.currentArtworkSettings()
+	start := time.Now()
+	paths := make(chan string, 256)
+	results := make(chan importResult, 256)
+
+	var mu sync.Mutex
+	progress := ImportProgress{Scanning: true, ETA: -1}
+
+	var wg sync.WaitGroup
+
+	// Find files
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(paths)
+
+		filepath.WalkDir(report.Folder, func(path string, d fs.DirEntry, err error) error {
+			if ctx.Err() != nil {
+				return filepath.SkipAll
+			}
+
+			if err != nil {
+				results <- importResult{file: scannedFile{Path: path}, err: err}
+				return nil
+			}
+
+			if d.IsDir() {
+				if reason := rules.skipDir(path); reason != "" {
+					results <- importResult{file: scannedFile{Path: path}, skipped: reason}
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if !IsSupported(path) {
+				return nil
+			}
+
+			mu.Lock()
+			progress.Seen++
+			mu.Unlock()
+
+			info, err := d.Info()
+			if err != nil {
+				results <- importResult{file: scannedFile{Path: path}, err: err}
+				return nil
+			}
+			if reason := rules.skipFile(path, info.Size()); reason != "" {
+				results <- importResult{file: scannedFile{Path: path}, skipped: reason}
+				return nil
+			}
+
+			paths <- path
+			return nil
+		})
+
+		mu.Lock()
+		progress.Scanning = false
+		mu.Unlock()
+	}()
+
+	// Read files
+	workers := min(runtime.NumCPU(), maxImportWorkers)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				// Keep draining after a cancel so the walk can finish
+				if ctx.Err() != nil {
+					continue
+				}
+
+				file, err := l.readFile(path, artworkSettings)
+				if err == nil {
+					if reason := rules.skipAudio(file.Info); reason != "" {
+						results <- importResult{file: file, skipped: reason}
+						continue
+					}
+				}
+				results <- importResult{file: file, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Save files
+	var pending []scannedFile
+	var lastUpdate time.Time
+
+	update := func(force bool) {
+		if onProgress == nil || (!force && time.Since(lastUpdate) < progressInterval) {
+			return
+		}
+		lastUpdate = time.Now()
+
+		mu.Lock()
+		p := progress
+		mu.Unlock()
+
+		if !p.Scanning && p.Processed > 0 {
+			perFile := time.Since(start).Seconds() / float64(p.Processed)
+			p.ETA = perFile * float64(p.Seen-p.Processed)
+		}
+		onProgress(p)
+	}
+
+	fail := func(path string, err error) {
+		log.Printf("error importing %s: %v\n", path, err)
+		report.Errors = append(report.Errors, ImportError{Path: path, Error: err.Error()})
+		report.Failed++
+	}
+
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+
+		l.saveBatch(pending, &report, fail)
+
+		mu.Lock()
+		progress.Processed += len(pending)
+		progress.Failed = report.Failed
+		progress.Current = pending[len(pending)-1].Path
+		mu.Unlock()
+
+		pending = pending[:0]
+	}
+
+	for result := range results {
+		if result.skipped != "" {
+			report.Skipped++
+			report.SkippedFiles = append(report.SkippedFiles, SkippedFile{Path: result.file.Path, Reason: result.skipped})
+
+			mu.Lock()
+			if IsSupported(result.file.Path) {
+				progress.Processed++
+			}
+			progress.Skipped = report.Skipped
+			mu.Unlock()
+		} else if result.err != nil {
+			fail(result.file.Path, result.err)
+
+			mu.Lock()
+			if IsSupported(result.file.Path) {
+				progress.Processed++
+			}
+			progress.Failed = report.Failed
+			mu.Unlock()
+		} else {
+			pending = append(pending, result.file)
+			if len(pending) >= importBatchSize {
+				flush()
+			}
+		}
+
+		update(false)
+	}
+
+	// Files already read before a cancel are still saved
+	flush()
+
+	mu.Lock()
+	report.Seen = progress.Seen
+	mu.Unlock()
+
+	report.Cancelled = ctx.Err() != nil
+	report.Elapsed = time.Since(start).Seconds()
+
+	update(true)
+
+	return report, nil
+}
+
+// Stops the running import, reporting whether there was one
+func (l *Library) CancelImport() bool {
+	l.importMu.Lock()
+	defer l.importMu.Unlock()
+
+	if l.importCancel == nil {
+		return false
+	}
+
+	l.importCancel()
+	return true
+}
+
+// Saves read files in a single transaction, counting them in the report
+func (l *Library) saveBatch(files []scannedFile, report *ImportReport, fail func(path string, err error)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	batch, err := l.db.BeginImportBatch()
+	if err != nil {
+		for _, file := range files {
+			fail(file.Path, err)
+		}
+		return
+	}
+	defer batch.Rollback()
+
+	added, updated := 0, 0
+	var saved []string
+	for _, file := range files {
+		_, created, err := saveFile(batch, file, 0)
+		if err != nil {
+			fail(file.Path, err)
+			continue
+		}
+
+		saved = append(saved, file.Path)
+		if created {
+			added++
+		} else {
+			updated++
+		}
+	}
+
+	if err := batch.Commit(); err != nil {
+		for _, path := range saved {
+			fail(path, err)
+		}
+		return
+	}
+
+	report.Added += added
+	report.Updated += updated
+}
@@ -0,0 +1,121 @@
+package library
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImport(t *testing.T) {
+	l := newTestLibrary(t)
+	dir := t.TempDir()
+
+	// More than one batch, spread over folders
+	const count = importBatchSize + 10
+	for i := range count {
+		writeTestWAV(t, filepath.Join(dir, fmt.Sprint("disc", i%3), fmt.Sprint(i, ".wav")), 200+float64(i)*10, 0.2)
+	}
+	os.WriteFile(filepath.Join(dir, "cover.jpg"), []byte("not audio"), 0644)
+	if err := os.Symlink(filepath.Join(dir, "nowhere.mp3"), filepath.Join(dir, "broken.mp3")); err != nil {
+		t.Fatal(err)
+	}
+
+	var updates []ImportProgress
+	report, err := l.Import(dir, func(p ImportProgress) { updates = append(updates, p) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Seen != count+1 || report.Added != count || report.Updated != 0 || report.Failed != 1 || report.Cancelled {
+		t.Errorf("report was %+v", report)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Path != filepath.Join(dir, "broken.mp3") {
+		t.Errorf("errors were %+v", report.Errors)
+	}
+
+	if len(updates) == 0 {
+		t.Fatal("no progress was reported")
+	}
+	last := updates[len(updates)-1]
+	if last.Scanning || last.Seen != count+1 || last.Processed != count+1 || last.Failed != 1 || last.ETA != 0 {
+		t.Errorf("last progress was %+v", last)
+	}
+	for i := 1; i < len(updates); i++ {
+		if updates[i].Processed < updates[i-1].Processed {
+			t.Errorf("progress went backwards: %+v then %+v", updates[i-1], updates[i])
+		}
+	}
+
+	// Importing again updates the same songs
+	song := songAt(t, l, filepath.Join(dir, "disc0", "0.wav"))
+	report, err = l.Import(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Added != 0 || report.Updated != count {
+		t.Errorf("second import was %+v", report)
+	}
+	if again := songAt(t, l, song.Path); again.ID != song.ID {
+		t.Errorf("re-imported song has ID %d, want %d", again.ID, song.ID)
+	}
+}
+
+func TestImportOneAtATime(t *testing.T) {
+	l := newTestLibrary(t)
+	dir := t.TempDir()
+	for i := range 20 {
+		writeTestWAV(t, filepath.Join(dir, fmt.Sprint(i, ".wav")), 300, 0.2)
+	}
+
+	if l.CancelImport() {
+		t.Error("cancelled an import when none was running")
+	}
+
+	var nestedErr error
+	cancelled := false
+	report, err := l.Import(dir, func(ImportProgress) {
+		if !cancelled {
+			_, nestedErr = l.Import(dir, nil)
+			cancelled = l.CancelImport()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nestedErr == nil {
+		t.Error("a second import started while one was running")
+	}
+	if !cancelled || !report.Cancelled {
+		t.Errorf("import wasn't cancelled: %+v", report)
+	}
+	// Files already read are still saved
+	if report.Added+report.Failed > report.Seen {
+		t.Errorf("report was %+v", report)
+	}
+
+	// The next import runs normally
+	report, err = l.Import(dir, nil)
+	if err != nil || report.Cancelled || report.Added+report.Updated != 20 {
+		t.Errorf("import after cancelling was %+v, %v", report, err)
+	}
+}
+
+func TestImportRejectsNonFolders(t *testing.T) {
+	l := newTestLibrary(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "song.wav")
+	writeTestWAV(t, file, 440, 0.2)
+
+	for _, path := range []string{filepath.Join(dir, "gone"), file} {
+		if report, err := l.Import(path, nil); err == nil {
+			t.Errorf("importing %s gave %+v", path, report)
+		}
+	}
+
+	// The failed attempts don't block the next one
+	if _, err := l.Import(dir, nil); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,265 @@
+package library
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"openturntable/artwork"
+	"openturntable/database"
+	"openturntable/playback"
+)
+
+// Audio file extensions that can be imported and played
+var supportedExtensions = map[string]bool{
+	".mp3":  true,
+	".flac": true,
+	".wav":  true,
+	".ogg":  true,
+}
+
+// Reports whether a file has an extension the library can import
+func IsSupported(filePath string) bool {
+	return supportedExtensions[strings.ToLower(filepath.Ext(filePath))]
+}
+
+// Imports audio files into the database and keeps them in sync with disk
+type Library struct {
+	db      *database.DB
+	artwork *artwork.Cache
+	watcher *watcher
+
+	// Image files already in the artwork cache, by path
+	images sync.Map
+
+	// Held while scans, imports and watcher updates write to the database
+	mu sync.Mutex
+
+	// Cancel the running import and fingerprinting jobs, nil if there
+	// isn't one
+	importMu          sync.Mutex
+	importCancel      context.CancelFunc
+	fingerprintCancel context.CancelFunc
+}
+
+// Creates a library backed by the given database, keeping album art in the
+// given cache
+func New(db *database.DB, art *artwork.Cache) *Library {
+	return &Library{db: db, artwork: art}
+}
+
+// Imports a file, updating the existing song in place if the path is
+// already in the library so its ID and playlist entries survive. The import
+// rules don't apply since the file was picked directly
+func (l *Library) ImportFile(filePath string) (int64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id, _, err := l.importFile(filePath, nil, nil)
+	return id, err
+}
+
+// Imports a single file. If it matches a song in moves (one whose file has
+// gone), that song is pointed at the file instead of a new one being added,
+// and moved is true. Files left out by the rules (if any) return a
+// *skipError. The caller must hold l.mu
+func (l *Library) importFile(filePath string, rules *ruleSet, moves *moveIndex) (id int64, moved bool, err error) {
+	file, err := l.readFile(filePath, l.currentArtworkSettings())
+	if err != nil {
+		return -1, false, err
+	}
+
+	if reason := rules.skipAudio(file.Info); reason != "" {
+		return -1, false, &skipError{reason}
+	}
+
+	// Only files new to the library can be a song that moved
+	var replaceID int64
+	if moves != nil {
+		if _, err := l.db.GetSongByPath(filePath); err != nil {
+			if song, ok := moves.take(&file); ok {
+				replaceID = song.ID
+				log.Printf("%s moved to %s\n", song.Path, filePath)
+			}
+		}
+	}
+
+	batch, err := l.db.BeginImportBatch()
+	if err != nil {
+		return -1, false, err
+	}
+	defer batch.Rollback()
+
+	id, _, err = saveFile(batch, file, replaceID)
+	if err != nil {
+		return -1, false, err
+	}
+
+	return id, replaceID != 0, batch.Commit()
+}
+
+// Everything read from an audio file during import
+type scannedFile struct {
+	Path     string
+	Metadata map[string]string
+	Info     playback.AudioInfo
+	Hash     string // empty unless a possible move needed it, see hash
+	Cover    string // artwork cache hash of the album cover, if any
+	Pictures []albumPicture
+}
+
+// Reads a file's tags and audio properties without touching the database,
+// so files can be read in parallel. Embedded pictures, and images in the
+// file's folder, go straight into the artwork cache
+func (l *Library) readFile(filePath string, settings ArtworkSettings) (scannedFile, error) {
+	file := scannedFile{Path: filePath}
+
+	// Open file for reading
+	f, err := os.Open(filePath)
+	if err != nil {
+		return file, err
+	}
+	defer f.Close()
+
+	// Read metadata
+	metadata, pics := playback.ReadTags(f)
+	file.Metadata = metadata
+
+	// Find album art
+	file.Cover, file.Pictures = l.filePictures(filePath, pics, settings)
+
+	// Read technical details, a file we can't probe is still worth importing
+	file.Info, err = playback.ReadAudioInfo(filePath)
+	if err != nil {
+		log.Println("error reading audio info:", err)
+	}
+
+	return file, nil
+}
+
+// Hashes the file's contents the first time it's needed. Hashing reads the
+// whole file, so it's left until a move has to be confirmed
+func (f *scannedFile) hash() (string, error) {
+	if f.Hash == "" {
+		hash, err := HashFile(f.Path)
+		if err != nil {
+			return "", err
+		}
+		f.Hash = hash
+	}
+
+	return f.Hash, nil
+}
+
+// Stores a read file as a song, finding or creating its artist and album.
+// If replaceID is set that song is rewritten, otherwise the song at the
+// file's path is (or a new one is added). Reports whether the song is new
+func saveFile(batch *database.ImportBatch, file scannedFile, replaceID int64) (int64, bool, error) {
+	metadata := file.Metadata
+
+	artistID, albumID, err := linkArtistAndAlbum(batch, metadata["artist"], metadata["albumartist"], metadata["album"], file.Cover)
+	if err != nil {
+		return -1, false, err
+	}
+
+	if albumID != 0 {
+		for _, pic := range file.Pictures {
+			if err := batch.AddAlbumArtwork(albumID, pic.Kind, pic.Art, pic.Source); err != nil {
+				return -1, false, err
+			}
+		}
+	}
+
+	song := database.Song{
+		Path:        file.Path,
+		Title:       metadata["title"],
+		Artist_ID:   sql.NullInt64{Int64: artistID, Valid: artistID != 0},
+		Album_ID:    sql.NullInt64{Int64: albumID, Valid: albumID != 0},
+		Composer:    sql.NullString{String: metadata["composer"], Valid: metadata["composer"] != ""},
+		Comment:     sql.NullString{String: metadata["comment"], Valid: metadata["comment"] != ""},
+		Genre:       sql.NullString{String: metadata["genre"], Valid: metadata["genre"] != ""},
+		Year:        sql.NullString{String: metadata["year"], Valid: metadata["year"] != ""},
+		TrackNumber: metadataInt(metadata, "track"),
+		TrackTotal:  metadataInt(metadata, "tracktotal"),
+		DiscNumber:  metadataInt(metadata, "disc"),
+		DiscTotal:   metadataInt(metadata, "disctotal"),
+		Duration:    file.Info.Duration,
+		SampleRate:  file.Info.SampleRate,
+		BitDepth:    file.Info.BitDepth,
+		Channels:    file.Info.Channels,
+		Bitrate:     file.Info.Bitrate,
+		Codec:       file.Info.Codec,
+		FileSize:    file.Info.FileSize,
+		ModTime:     file.Info.ModTime,
+		ContentHash: file.Hash,
+	}
+
+	if replaceID != 0 {
+		song.ID = replaceID
+		return replaceID, false, batch.UpdateSong(song)
+	}
+
+	return batch.SaveSong(song)
+}
+
+// Finds or creates a song's artist and album (0 for none), giving a new
+// album the given art
+func linkArtistAndAlbum(batch *database.ImportBatch, artistName string, albumArtistName string, albumName string, art string) (artistID int64, albumID int64, err error) {
+	// Check for artist
+	if artistName != "" {
+		if artistID, err = batch.ArtistID(artistName); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	// Albums belong to the album artist, falling back to the track artist,
+	// so compilations with many track artists stay one album
+	albumArtistID := artistID
+	if albumArtistName != "" && albumArtistName != artistName {
+		if albumArtistID, err = batch.ArtistID(albumArtistName); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	// Check for album
+	if albumName != "" {
+		if albumID, err = batch.AlbumID(albumName, art, albumArtistID); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	return artistID, albumID, nil
+}
+
+// Reads a numeric metadata value, 0 if missing or invalid
+func metadataInt(metadata map[string]string, key string) int64 {
+	n, err := strconv.ParseInt(metadata[key], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// Hashes a file's full contents (SHA-256, hex encoded)
+func HashFile(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
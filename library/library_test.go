@@ -0,0 +1,94 @@
+package library
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"openturntable/artwork"
+	"openturntable/database"
+)
+
+// Creates a library whose database and artwork live in temporary folders
+func newTestLibrary(t *testing.T) *Library {
+	t.Helper()
+
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("APPDATA", configDir)
+	t.Setenv("HOME", configDir)
+
+	db, err := database.NewDB()
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	art, err := artwork.NewAt(filepath.Join(configDir, "artwork"))
+	if err != nil {
+		t.Fatalf("failed to create artwork cache: %v", err)
+	}
+
+	return New(db, art)
+}
+
+// Encodes seconds of a sine tone as a mono 16 bit WAV file at 8 kHz.
+// Different frequencies give different content
+func testWAV(freq float64, seconds float64) []byte {
+	samples := make([]float64, int(seconds*testSampleRate))
+	for i := range samples {
+		samples[i] = 0.5 * math.Sin(2*math.Pi*freq*float64(i)/testSampleRate)
+	}
+	return encodeWAV(samples)
+}
+
+// Sample rate of the WAV files tests write
+const testSampleRate = 8000
+
+// Encodes samples as a mono 16 bit WAV file at testSampleRate
+func encodeWAV(samples []float64) []byte {
+	var data bytes.Buffer
+	for _, s := range samples {
+		binary.Write(&data, binary.LittleEndian, int16(s*32767))
+	}
+
+	var wav bytes.Buffer
+	wav.WriteString("RIFF")
+	binary.Write(&wav, binary.LittleEndian, uint32(36+data.Len()))
+	wav.WriteString("WAVEfmt ")
+	for _, field := range []any{
+		uint32(16), uint16(1), uint16(1), uint32(testSampleRate), uint32(testSampleRate * 2), uint16(2), uint16(16),
+	} {
+		binary.Write(&wav, binary.LittleEndian, field)
+	}
+	wav.WriteString("data")
+	binary.Write(&wav, binary.LittleEndian, uint32(data.Len()))
+	wav.Write(data.Bytes())
+	return wav.Bytes()
+}
+
+// Writes a WAV file (see testWAV), creating its folder
+func writeTestWAV(t *testing.T, path string, freq float64, seconds float64) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, testWAV(freq, seconds), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Gets the song stored for a path, failing the test if there isn't one
+func songAt(t *testing.T, l *Library, path string) database.Song {
+	t.Helper()
+
+	song, err := l.db.GetSongByPath(path)
+	if err != nil {
+		t.Fatalf("no song for %s: %v", path, err)
+	}
+	return song
+}
@@ -0,0 +1,131 @@
+package library
+
+import (
+	"log"
+	"math"
+	"path/filepath"
+
+	"openturntable/database"
+	"openturntable/fingerprint"
+)
+
+// Longest difference in duration (seconds) still treated as the same recording
+const moveDurationTolerance = 1.0
+
+// Songs whose files have gone, indexed so new files can be matched to them
+type moveIndex struct {
+	// A moved file keeps its size, so that narrows things down before
+	// anything has to be hashed
+	bySize map[int64][]database.Song
+	taken  map[int64]bool
+
+	// Fingerprinted songs, for files that were re-encoded or retagged
+	// (changing their hash) as well as moved
+	songs        []database.Song
+	fingerprints map[int64][]uint32
+}
+
+// Indexes gone songs. fingerprints holds whichever of them have one stored
+func newMoveIndex(songs []database.Song, fingerprints map[int64][]uint32) *moveIndex {
+	m := &moveIndex{
+		bySize:       make(map[int64][]database.Song),
+		taken:        make(map[int64]bool),
+		songs:        songs,
+		fingerprints: fingerprints,
+	}
+
+	for _, song := range songs {
+		if song.FileSize > 0 {
+			m.bySize[song.FileSize] = append(m.bySize[song.FileSize], song)
+		}
+	}
+
+	return m
+}
+
+// Finds the gone song a file most likely is, and removes it from the index.
+// Songs with a stored hash have to match the file's hash, which is only
+// computed if one of them has the file's size. Songs without one are matched
+// on size and duration, preferring one with the same file name
+func (m *moveIndex) take(file *scannedFile) (database.Song, bool) {
+	var unhashed []database.Song
+	for _, song := range m.bySize[file.Info.FileSize] {
+		if m.taken[song.ID] || !sameDuration(song.Duration, file.Info.Duration) {
+			continue
+		}
+
+		if song.ContentHash == "" {
+			unhashed = append(unhashed, song)
+			continue
+		}
+
+		hash, err := file.hash()
+		if err != nil {
+			log.Println(err)
+			break
+		}
+		if hash == song.ContentHash {
+			m.taken[song.ID] = true
+			return song, true
+		}
+	}
+
+	if len(unhashed) > 0 {
+		best := unhashed[0]
+		for _, song := range unhashed {
+			if filepath.Base(song.Path) == filepath.Base(file.Path) {
+				best = song
+				break
+			}
+		}
+
+		m.taken[best.ID] = true
+		return best, true
+	}
+
+	return m.takeByFingerprint(*file)
+}
+
+// Finds the gone song whose fingerprint best matches a file's audio. The
+// file is only decoded if some fingerprinted song has a similar duration
+func (m *moveIndex) takeByFingerprint(file scannedFile) (database.Song, bool) {
+	if file.Info.Duration == 0 {
+		return database.Song{}, false
+	}
+
+	var fp []uint32
+	var best database.Song
+	bestScore := fingerprintMatchThreshold
+
+	for _, song := range m.songs {
+		stored, ok := m.fingerprints[song.ID]
+		if !ok || m.taken[song.ID] || song.Duration == 0 || !sameDuration(song.Duration, file.Info.Duration) {
+			continue
+		}
+
+		if fp == nil {
+			var err error
+			if fp, err = Fingerprint(file.Path); err != nil {
+				log.Println(err)
+				return database.Song{}, false
+			}
+		}
+
+		if score := fingerprint.Similarity(fp, stored); score >= bestScore {
+			best, bestScore = song, score
+		}
+	}
+
+	if best.ID == 0 {
+		return database.Song{}, false
+	}
+
+	m.taken[best.ID] = true
+	return best, true
+}
+
+// Reports whether two durations could be the same recording. Unknown (0)
+// durations don't rule a match out
+func sameDuration(a float64, b float64) bool {
+	return a == 0 || b == 0 || math.Abs(a-b) <= moveDurationTolerance
+}
@@ -0,0 +1,207 @@
+package library
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"openturntable/database"
+	"openturntable/playback"
+)
+
+func TestMoveIndexTake(t *testing.T) {
+	dir := t.TempDir()
+	data := testWAV(440, 1)
+	path := filepath.Join(dir, "new name.wav")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(data))
+	hash, err := HashFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		songs  []database.Song
+		want   int64 // 0 for no match
+		hashed bool  // whether the file had to be hashed
+	}{
+		{"same hash", []database.Song{
+			{ID: 1, Path: "/old/a.wav", FileSize: size, Duration: 1, ContentHash: hash},
+		}, 1, true},
+		{"different hash", []database.Song{
+			{ID: 1, Path: "/old/new name.wav", FileSize: size, Duration: 1, ContentHash: "other"},
+		}, 0, true},
+		{"same hash, different duration", []database.Song{
+			{ID: 1, Path: "/old/a.wav", FileSize: size, Duration: 3, ContentHash: hash},
+		}, 0, false},
+		{"same hash, unknown duration", []database.Song{
+			{ID: 1, Path: "/old/a.wav", FileSize: size, ContentHash: hash},
+		}, 1, true},
+		{"different size", []database.Song{
+			{ID: 1, Path: "/old/new name.wav", FileSize: size + 1, Duration: 1, ContentHash: hash},
+		}, 0, false},
+
+		// Songs that were never hashed are matched without hashing the file
+		{"unhashed", []database.Song{
+			{ID: 1, Path: "/old/a.wav", FileSize: size, Duration: 1.5},
+		}, 1, false},
+		{"unhashed, different duration", []database.Song{
+			{ID: 1, Path: "/old/new name.wav", FileSize: size, Duration: 2.5},
+		}, 0, false},
+		{"unhashed, same name preferred", []database.Song{
+			{ID: 1, Path: "/old/a.wav", FileSize: size, Duration: 1},
+			{ID: 2, Path: "/old/new name.wav", FileSize: size, Duration: 1},
+		}, 2, false},
+		{"matching hash beats the same name", []database.Song{
+			{ID: 1, Path: "/old/new name.wav", FileSize: size, Duration: 1},
+			{ID: 2, Path: "/old/b.wav", FileSize: size, Duration: 1, ContentHash: hash},
+		}, 2, true},
+	}
+
+	for _, test := range tests {
+		m := newMoveIndex(test.songs, nil)
+		file := scannedFile{Path: path, Info: playback.AudioInfo{Duration: 1, FileSize: size}}
+
+		song, ok := m.take(&file)
+		if ok != (test.want != 0) || song.ID != test.want {
+			t.Errorf("%s: took song %d (%v), want %d", test.name, song.ID, ok, test.want)
+		}
+		if (file.Hash != "") != test.hashed {
+			t.Errorf("%s: file hash is %q, want hashed %v", test.name, file.Hash, test.hashed)
+		}
+
+		// A song can only move once
+		if ok {
+			if again, ok := m.take(&file); ok && again.ID == song.ID {
+				t.Errorf("%s: song %d was taken twice", test.name, song.ID)
+			}
+		}
+	}
+}
+
+// Samples of a tune changing note every half second
+func testTune(notes []float64, seconds float64, volume float64) []float64 {
+	samples := make([]float64, int(seconds*testSampleRate))
+	for i := range samples {
+		freq := notes[(i/(testSampleRate/2))%len(notes)]
+		samples[i] = volume * math.Sin(2*math.Pi*freq*float64(i)/testSampleRate)
+	}
+	return samples
+}
+
+func TestMoveIndexTakeByFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	scale := []float64{261.63, 293.66, 329.63, 349.23, 392.00, 440.00, 493.88, 523.25}
+	otherScale := []float64{311.13, 466.16, 277.18, 415.30, 369.99, 554.37, 233.08, 622.25}
+
+	write := func(name string, samples []float64) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, encodeWAV(samples), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	fingerprints := make(map[int64][]uint32)
+	for id, path := range map[int64]string{
+		1: write("original.wav", testTune(scale, 10, 0.5)),
+		2: write("other.wav", testTune(otherScale, 10, 0.5)),
+	} {
+		fp, err := Fingerprint(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fingerprints[id] = fp
+	}
+
+	// Re-encoded (here, quieter) so neither its hash nor its size match
+	path := write("reencoded.wav", testTune(scale, 10, 0.25))
+	file := scannedFile{Path: path, Info: playback.AudioInfo{Duration: 10, FileSize: 1}}
+
+	tests := []struct {
+		name  string
+		songs []database.Song
+		want  int64
+	}{
+		{"same audio", []database.Song{{ID: 2, Duration: 10}, {ID: 1, Duration: 10}}, 1},
+		{"different audio", []database.Song{{ID: 2, Duration: 10}}, 0},
+		{"different duration", []database.Song{{ID: 1, Duration: 30}}, 0},
+		{"not fingerprinted", []database.Song{{ID: 3, Duration: 10}}, 0},
+	}
+
+	for _, test := range tests {
+		m := newMoveIndex(test.songs, fingerprints)
+		song, ok := m.take(&file)
+		if ok != (test.want != 0) || song.ID != test.want {
+			t.Errorf("%s: took song %d (%v), want %d", test.name, song.ID, ok, test.want)
+		}
+	}
+}
+
+func TestRescanFindsMoves(t *testing.T) {
+	l := newTestLibrary(t)
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.wav"), filepath.Join(dir, "b.wav")
+	writeTestWAV(t, a, 440, 1)
+	writeTestWAV(t, b, 660, 1)
+
+	if _, err := l.Rescan(dir, ScanOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	songA, songB := songAt(t, l, a), songAt(t, l, b)
+	if songA.ContentHash != "" {
+		t.Error("file was hashed on import")
+	}
+	if err := l.db.SetSongFingerprint(songA.ID, "stale"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without a hash, a file the same size and length is taken as the song
+	renamed := filepath.Join(dir, "sub", "renamed.wav")
+	os.MkdirAll(filepath.Dir(renamed), 0755)
+	if err := os.Rename(a, renamed); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := l.Rescan(dir, ScanOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != (ScanSummary{Moved: 1, Unchanged: 1}) {
+		t.Errorf("rescan was %+v, want one song moved", summary)
+	}
+	if song := songAt(t, l, renamed); song.ID != songA.ID {
+		t.Errorf("moved file is song %d, want %d", song.ID, songA.ID)
+	}
+	// Nothing proved the audio is the same, so the fingerprint is redone
+	if _, ok, _ := l.db.GetSongFingerprint(songA.ID); ok {
+		t.Error("fingerprint was kept for a move matched without a hash")
+	}
+
+	// Once hashed, a file of the same size and length with other audio
+	// isn't mistaken for the song, though it's checked first
+	if _, err := l.Rescan(dir, ScanOptions{VerifyHashes: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+	moved, other := filepath.Join(dir, "c.wav"), filepath.Join(dir, "b2.wav")
+	if err := os.Rename(b, moved); err != nil {
+		t.Fatal(err)
+	}
+	writeTestWAV(t, other, 550, 1)
+
+	summary, err = l.Rescan(dir, ScanOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary != (ScanSummary{Added: 1, Moved: 1, Unchanged: 1}) {
+		t.Errorf("rescan was %+v, want one song moved and one added", summary)
+	}
+	if song := songAt(t, l, moved); song.ID != songB.ID {
+		t.Errorf("moved file is song %d, want %d", song.ID, songB.ID)
+	}
+	if song := songAt(t, l, other); song.ID == songB.ID {
+		t.Error("new file took the moved song's place")
+	}
+}
@@ -0,0 +1,181 @@
+package library
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"openturntable/database"
+)
+
+// Most example paths included in a relocation report
+const relocateSampleSize = 20
+
+// Options for moving the library to a new location
+type RelocateOptions struct {
+	// Only report what would change
+	DryRun bool
+	// Separator for the rewritten paths: "/" or "\\". Empty picks one from
+	// the new prefix, so e.g. C:\Music -> /mnt/music also turns the rest of
+	// each path into POSIX form
+	Separator string
+}
+
+// One song's old and new path
+type RelocatedPath struct {
+	OldPath string
+	NewPath string
+	Exists  bool // the file is at the new path
+}
+
+// What a relocation did (or would do, for a dry run)
+type RelocateReport struct {
+	Matched   int // songs under the old prefix
+	Resolved  int // of those, songs whose file exists at the new path
+	Conflicts int // songs left alone since another song already has the new path
+	Folders   int // library folders rewritten
+	DryRun    bool
+	Samples   []RelocatedPath
+}
+
+// Rewrites every song path (and library folder) starting with oldPrefix to
+// start with newPrefix instead, in one transaction. Songs whose files aren't
+// at the new location are marked missing, ones that are get un-marked
+func (l *Library) Relocate(oldPrefix string, newPrefix string, opts RelocateOptions) (RelocateReport, error) {
+	report := RelocateReport{DryRun: opts.DryRun}
+
+	oldPrefix = trimSeparators(oldPrefix)
+	newPrefix = trimSeparators(newPrefix)
+	if oldPrefix == "" || newPrefix == "" {
+		return report, errors.New("both the old and new locations are needed")
+	}
+
+	separator := opts.Separator
+	if separator == "" {
+		separator = separatorOf(newPrefix)
+	}
+	if separator != "/" && separator != `\` {
+		return report, errors.New(`separator must be "/" or "\"`)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	songs, err := l.db.GetSongs()
+	if err != nil {
+		return report, err
+	}
+
+	taken := make(map[string]bool, len(songs))
+	for _, song := range songs {
+		taken[song.Path] = true
+	}
+
+	var updates []database.SongPathUpdate
+	for _, song := range songs {
+		newPath, ok := relocatePath(song.Path, oldPrefix, newPrefix, separator)
+		if !ok {
+			continue
+		}
+
+		report.Matched++
+		if newPath != song.Path && taken[newPath] {
+			report.Conflicts++
+			continue
+		}
+
+		_, err := os.Stat(newPath)
+		exists := err == nil
+		if exists {
+			report.Resolved++
+		}
+
+		if len(report.Samples) < relocateSampleSize {
+			report.Samples = append(report.Samples, RelocatedPath{OldPath: song.Path, NewPath: newPath, Exists: exists})
+		}
+
+		updates = append(updates, database.SongPathUpdate{ID: song.ID, Path: newPath, Missing: !exists})
+	}
+
+	folders, err := l.db.GetLibraryFolders()
+	if err != nil {
+		return report, err
+	}
+
+	folderTaken := make(map[string]bool, len(folders))
+	for _, folder := range folders {
+		folderTaken[folder.Path] = true
+	}
+
+	var movedFolders []database.LibraryFolder
+	for _, folder := range folders {
+		newPath, ok := relocatePath(folder.Path, oldPrefix, newPrefix, separator)
+		if !ok || folderTaken[newPath] {
+			continue
+		}
+		folder.Path = newPath
+		movedFolders = append(movedFolders, folder)
+	}
+	report.Folders = len(movedFolders)
+
+	if opts.DryRun {
+		return report, nil
+	}
+
+	if err := l.db.RelocatePaths(updates, movedFolders); err != nil {
+		return report, err
+	}
+
+	// Start watching folders at their new location
+	if l.watcher != nil {
+		for _, folder := range movedFolders {
+			go l.watchFolder(folder)
+		}
+	}
+
+	return report, nil
+}
+
+// Rewrites a path under oldPrefix to be under newPrefix, converting the
+// remaining separators. ok is false if the path isn't under oldPrefix.
+// Prefixes are matched with either kind of separator
+func relocatePath(path string, oldPrefix string, newPrefix string, separator string) (string, bool) {
+	slashed := strings.ReplaceAll(path, `\`, "/")
+	prefix := strings.ReplaceAll(oldPrefix, `\`, "/")
+	if !strings.HasPrefix(slashed, prefix) {
+		return "", false
+	}
+
+	// A root prefix ends in its separator, which belongs to the rest
+	rest := slashed[len(prefix):]
+	if strings.HasSuffix(prefix, "/") {
+		rest = "/" + rest
+	}
+	if rest == "" {
+		return newPrefix, true
+	}
+	if rest[0] != '/' {
+		return "", false
+	}
+
+	rest = strings.ReplaceAll(rest, "/", separator)
+	return strings.TrimRight(newPrefix, `/\`) + rest, true
+}
+
+// Picks the separator a path uses, defaulting to "/"
+func separatorOf(path string) string {
+	isDrive := len(path) == 2 && path[1] == ':'
+	if isDrive || (strings.Contains(path, `\`) && !strings.Contains(path, "/")) {
+		return `\`
+	}
+	return "/"
+}
+
+// Removes trailing separators, keeping a lone root
+func trimSeparators(path string) string {
+	trimmed := strings.TrimRight(path, `/\`)
+	if trimmed == "" && path != "" {
+		return path[:1]
+	}
+	return trimmed
+}
@@ -0,0 +1,51 @@
+package library
+
+import "testing"
+
+func TestRelocatePath(t *testing.T) {
+	tests := []struct {
+		path, oldPrefix, newPrefix, separator string
+		want                                  string
+		ok                                    bool
+	}{
+		{"/music/a/b.mp3", "/music", "/mnt/music", "/", "/mnt/music/a/b.mp3", true},
+		{"/music", "/music", "/mnt/music", "/", "/mnt/music", true},
+		{"/musical/b.mp3", "/music", "/mnt/music", "/", "", false},
+		{"/other/b.mp3", "/music", "/mnt/music", "/", "", false},
+
+		// Windows paths to POSIX, with the prefix given either way round
+		{`C:\Music\a\b.mp3`, `C:\Music`, "/mnt/music", "/", "/mnt/music/a/b.mp3", true},
+		{`C:\Music\a\b.mp3`, "C:/Music", "/mnt/music", "/", "/mnt/music/a/b.mp3", true},
+		{"C:/Music/a/b.mp3", `C:\Music`, `D:\Music`, `\`, `D:\Music\a\b.mp3`, true},
+		{`C:\Music\a\b.mp3`, `C:`, `D:`, `\`, `D:\Music\a\b.mp3`, true},
+
+		// Roots on either side
+		{"/a/b.mp3", "/", "/mnt/old", "/", "/mnt/old/a/b.mp3", true},
+		{"/mnt/old/a/b.mp3", "/mnt/old", "/", "/", "/a/b.mp3", true},
+		{`\a\b.mp3`, "/", "/mnt", "/", "/mnt/a/b.mp3", true},
+	}
+
+	for _, test := range tests {
+		got, ok := relocatePath(test.path, test.oldPrefix, test.newPrefix, test.separator)
+		if got != test.want || ok != test.ok {
+			t.Errorf("relocatePath(%q, %q, %q, %q) = %q, %v; want %q, %v",
+				test.path, test.oldPrefix, test.newPrefix, test.separator, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestTrimSeparators(t *testing.T) {
+	tests := map[string]string{
+		"/music/":   "/music",
+		`C:\Music\`: `C:\Music`,
+		"/":         "/",
+		`\\`:        `\`,
+		"":          "",
+	}
+
+	for path, want := range tests {
+		if got := trimSeparators(path); got != want {
+			t.Errorf("trimSeparators(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"openturntable/database"
+	"openturntable/playback"
+)
+
+// Options for a rescan
+type ScanOptions struct {
+	// Also hash files whose size and modification time are unchanged, to
+	// catch edits that preserved both
+	VerifyHashes bool
+}
+
+// What a rescan did
+type ScanSummary struct {
+	Added     int
+	Updated   int
+	Unchanged int
+	Moved     int
+	Missing   int
+	Skipped   int
+	Failed    int
+}
+
+// Compares a folder on disk with the songs stored under it. New files are
+// imported, changed ones are updated in place (keeping their IDs), and songs
+// whose files are gone are marked missing rather than deleted. New files
+// that match a gone or missing song (by size, duration and content hash, or
+// by stored fingerprint) are treated as that song having moved, keeping its
+// ID, playlist entries and play count. Files the import rules leave out count
+// as gone. onFile, if set, is called with each audio file as it's checked
+func (l *Library) Rescan(folder string, opts ScanOptions, onFile func(path string)) (ScanSummary, error) {
+	var summary ScanSummary
+	folder = filepath.Clean(folder)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// An unmounted drive shouldn't mark the whole folder missing
+	if info, err := os.Stat(folder); err != nil {
+		return summary, fmt.Errorf("failed to read folder: %w", err)
+	} else if !info.IsDir() {
+		return summary, fmt.Errorf("%s is not a folder", folder)
+	}
+
+	stored, err := l.db.GetSongsInFolder(folder)
+	if err != nil {
+		return summary, err
+	}
+
+	byPath := make(map[string]database.Song, len(stored))
+	for _, song := range stored {
+		byPath[song.Path] = song
+	}
+
+	rules := l.currentRules()
+	seen := make(map[string]bool)
+	var newFiles []string
+	var unreadable []string
+
+	err = filepath.WalkDir(folder, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("error accessing %s: %v\n", path, err)
+			if d == nil || d.IsDir() {
+				unreadable = append(unreadable, path)
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if reason := rules.skipDir(path); reason != "" {
+				summary.Skipped++
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !IsSupported(path) {
+			return nil
+		}
+
+		if onFile != nil {
+			onFile(path)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			log.Printf("error accessing %s: %v\n", path, err)
+			summary.Failed++
+			return nil
+		}
+		if reason := rules.skipFile(path, info.Size()); reason != "" {
+			summary.Skipped++
+			return nil
+		}
+
+		// New files are imported once the walk is done and it's known which
+		// songs have gone, since they might be those songs moved
+		song, known := byPath[path]
+		if !known {
+			newFiles = append(newFiles, path)
+			return nil
+		}
+
+		changed, hash, err := l.fileChanged(song, path, opts.VerifyHashes)
+		if err != nil {
+			log.Printf("error checking %s: %v\n", path, err)
+			seen[path] = true
+			summary.Failed++
+			return nil
+		}
+
+		if !changed {
+			if reason := rules.skipAudio(playback.AudioInfo{Duration: song.Duration}); reason != "" {
+				summary.Skipped++
+				return nil
+			}
+			seen[path] = true
+
+			// Fill in hashes for songs imported without one
+			if hash != "" && song.ContentHash == "" {
+				if err := l.db.SetSongContentHash(song.ID, hash); err != nil {
+					log.Println(err)
+				}
+			}
+			summary.Unchanged++
+			return nil
+		}
+
+		l.rescanImport(path, rules, nil, seen, &summary, &summary.Updated)
+		return nil
+	})
+	if err != nil {
+		return summary, err
+	}
+
+	var gone []database.Song
+	for _, song := range stored {
+		if !seen[song.Path] && !song.Missing && !withinAny(song.Path, unreadable) {
+			gone = append(gone, song)
+		}
+	}
+
+	// Songs can move in from anywhere, not just this folder
+	missing, err := l.db.GetMissingSongs()
+	if err != nil {
+		log.Println(err)
+	}
+	candidates := append(gone, missing...)
+	moves := newMoveIndex(candidates, l.storedFingerprints(candidates))
+
+	for _, path := range newFiles {
+		l.rescanImport(path, rules, moves, seen, &summary, &summary.Added)
+	}
+
+	for _, song := range gone {
+		if moves.taken[song.ID] {
+			continue
+		}
+
+		if err := l.db.SetSongMissing(song.ID, true); err != nil {
+			log.Println(err)
+			summary.Failed++
+			continue
+		}
+		summary.Missing++
+	}
+
+	return summary, nil
+}
+
+// Imports or re-reads a file during a rescan, bumping counter on success
+// (or Moved if it turned out to be a song that moved). Files that fail to
+// read still count as seen so they aren't marked missing
+func (l *Library) rescanImport(path string, rules *ruleSet, moves *moveIndex, seen map[string]bool, summary *ScanSummary, counter *int) {
+	_, moved, err := l.importFile(path, rules, moves)
+
+	var skip *skipError
+	switch {
+	case errors.As(err, &skip):
+		summary.Skipped++
+		return
+	case err != nil:
+		log.Printf("error importing %s: %v\n", path, err)
+		summary.Failed++
+	case moved:
+		summary.Moved++
+	default:
+		*counter++
+	}
+
+	seen[path] = true
+}
+
+// Reports whether a scan changed anything
+func (s ScanSummary) Changed() bool {
+	return s.Added+s.Updated+s.Moved+s.Missing > 0
+}
+
+// Checks whether a file differs from what's stored for its song. Returns the
+// file's hash when verifyHash is set and the hash had to be computed
+func (l *Library) fileChanged(song database.Song, path string, verifyHash bool) (bool, string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, "", err
+	}
+
+	// Songs that come back after going missing are re-read in case they changed
+	if song.Missing || info.Size() != song.FileSize || info.ModTime().Unix() != song.ModTime {
+		return true, "", nil
+	}
+
+	if !verifyHash {
+		return false, "", nil
+	}
+
+	hash, err := HashFile(path)
+	if err != nil {
+		return false, "", err
+	}
+
+	return song.ContentHash != "" && hash != song.ContentHash, hash, nil
+}
+
+// Reports whether a path is one of the given folders or inside one
+func withinAny(path string, folders []string) bool {
+	for _, folder := range folders {
+		if path == folder || strings.HasPrefix(path, folder+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Rewrites part of a file's audio without changing its size, then puts its
+// modification time back, as some tag editors do
+func editInPlace(t *testing.T, path string) {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := len(data) / 2; i < len(data)/2+100; i++ {
+		data[i] ^= 0xff
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileChanged(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(t *testing.T, path string)
+		missing bool
+		verify  bool
+		want    bool
+	}{
+		{"untouched", func(*testing.T, string) {}, false, false, false},
+		{"untouched, verified", func(*testing.T, string) {}, false, true, false},
+		{"size changed", func(t *testing.T, path string) {
+			writeTestWAV(t, path, 440, 1.5)
+			os.Chtimes(path, time.Unix(1000, 0), time.Unix(1000, 0))
+		}, false, false, true},
+		{"modification time changed", func(t *testing.T, path string) {
+			later := time.Now().Add(time.Hour)
+			os.Chtimes(path, later, later)
+		}, false, false, true},
+		{"edited in place", editInPlace, false, false, false},
+		{"edited in place, verified", editInPlace, false, true, true},
+		{"was missing", func(*testing.T, string) {}, true, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := newTestLibrary(t)
+			path := filepath.Join(t.TempDir(), "song.wav")
+			writeTestWAV(t, path, 440, 1)
+			os.Chtimes(path, time.Unix(1000, 0), time.Unix(1000, 0))
+
+			if _, err := l.ImportFile(path); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := l.Rescan(filepath.Dir(path), ScanOptions{VerifyHashes: true}, nil); err != nil {
+				t.Fatal(err)
+			}
+			song := songAt(t, l, path)
+			song.Missing = test.missing
+
+			test.change(t, path)
+
+			changed, hash, err := l.fileChanged(song, path, test.verify)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed != test.want {
+				t.Errorf("fileChanged = %v, want %v", changed, test.want)
+			}
+			if test.verify && !changed && hash != song.ContentHash {
+				t.Errorf("hash is %q, want the stored %q", hash, song.ContentHash)
+			}
+		})
+	}
+}
+
+func TestRescan(t *testing.T) {
+	l := newTestLibrary(t)
+	dir := t.TempDir()
+
+	paths := map[string]string{}
+	for i, name := range []string{"keep", "grow", "edit", "remove"} {
+		paths[name] = filepath.Join(dir, name+".wav")
+		writeTestWAV(t, paths[name], 300+100*float64(i), 1)
+	}
+
+	first, err := l.Rescan(dir, ScanOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Added != 4 || !first.Changed() {
+		t.Fatalf("first rescan was %+v, want four songs added", first)
+	}
+	ids := map[string]int64{}
+	for name, path := range paths {
+		ids[name] = songAt(t, l, path).ID
+	}
+
+	// Hashes are filled in for songs that don't have one
+	if _, err := l.Rescan(dir, ScanOptions{VerifyHashes: true}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestWAV(t, paths["grow"], 400, 2)
+	editInPlace(t, paths["edit"])
+	os.Remove(paths["remove"])
+	paths["new"] = filepath.Join(dir, "sub", "new.wav")
+	writeTestWAV(t, paths["new"], 900, 1)
+
+	tests := []struct {
+		opts ScanOptions
+		want ScanSummary
+	}{
+		// The edit keeps the size and time, so only hashing notices it
+		{ScanOptions{}, ScanSummary{Added: 1, Updated: 1, Unchanged: 2, Missing: 1}},
+		{ScanOptions{VerifyHashes: true}, ScanSummary{Updated: 1, Unchanged: 3}},
+		{ScanOptions{VerifyHashes: true}, ScanSummary{Unchanged: 4}},
+	}
+	for i, test := range tests {
+		var checked []string
+		got, err := l.Rescan(dir, test.opts, func(path string) { checked = append(checked, path) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("rescan %d was %+v, want %+v", i+1, got, test.want)
+		}
+		if len(checked) != 4 {
+			t.Errorf("rescan %d checked %q", i+1, checked)
+		}
+	}
+
+	// Changed songs keep their IDs, removed ones are kept but marked missing
+	for _, name := range []string{"keep", "grow", "edit"} {
+		if song := songAt(t, l, paths[name]); song.ID != ids[name] || song.Missing {
+			t.Errorf("%s is %+v, want song %d", name, song, ids[name])
+		}
+	}
+	if song := songAt(t, l, paths["grow"]); song.Duration < 1.9 {
+		t.Errorf("grown song has duration %g, want it re-read", song.Duration)
+	}
+	if song := songAt(t, l, paths["remove"]); !song.Missing {
+		t.Error("removed song wasn't marked missing")
+	}
+
+	// Coming back counts as a change
+	writeTestWAV(t, paths["remove"], 600, 1)
+	got, err := l.Rescan(dir, ScanOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Updated != 1 || songAt(t, l, paths["remove"]).Missing {
+		t.Errorf("rescan after restoring a file was %+v", got)
+	}
+}
+
+func TestRescanMissingFolder(t *testing.T) {
+	l := newTestLibrary(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "music", "song.wav")
+	writeTestWAV(t, path, 440, 1)
+	if _, err := l.Rescan(dir, ScanOptions{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Rescan(path, ScanOptions{}, nil); err == nil {
+		t.Error("rescanning a file succeeded")
+	}
+
+	// An unmounted drive isn't the same as every song being deleted
+	os.RemoveAll(filepath.Join(dir, "music"))
+	if _, err := l.Rescan(filepath.Join(dir, "music"), ScanOptions{}, nil); err == nil {
+		t.Error("rescanning a folder that's gone succeeded")
+	}
+	if songAt(t, l, path).Missing {
+		t.Error("song was marked missing when its folder was gone")
+	}
+}
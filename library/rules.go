@@ -0,0 +1,230 @@
+package library
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"openturntable/playback"
+)
+
+// Settings key the import rules are stored under
+const importRulesKey = "import_rules"
+
+// Files that mark a folder (and everything below it) as not for the library
+var markerFiles = []string{".nomedia", ".ignore"}
+
+// Which files imports, rescans and the watcher leave out of the library
+type ImportRules struct {
+	// Glob patterns (e.g. "*.m4r", "Samples", "Voice Memos/*.wav"). Patterns
+	// without a slash are matched against file and folder names, ones with a
+	// slash against the end of the path (using forward slashes)
+	ExcludeGlobs []string
+	// Regular expressions matched against the whole path (using forward slashes)
+	ExcludeRegexes []string
+	// Shortest song to import, in seconds. 0 for no limit
+	MinDuration float64
+	// Smallest file to import, in bytes. 0 for no limit
+	MinFileSize int64
+	// Skip folders containing a .nomedia or .ignore file
+	SkipMarkedFolders bool
+}
+
+// The rules used until someone changes them
+var defaultImportRules = ImportRules{SkipMarkedFolders: true}
+
+// A file or folder left out by the import rules, and why
+type SkippedFile struct {
+	Path   string
+	Reason string
+}
+
+// Import rules ready for matching
+type ruleSet struct {
+	ImportRules
+	regexes []*regexp.Regexp
+}
+
+// Validates and compiles a set of rules
+func (r ImportRules) compile() (*ruleSet, error) {
+	rs := &ruleSet{ImportRules: r}
+
+	for _, pattern := range r.ExcludeGlobs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+	}
+
+	for _, expr := range r.ExcludeRegexes {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude expression %q: %w", expr, err)
+		}
+		rs.regexes = append(rs.regexes, re)
+	}
+
+	return rs, nil
+}
+
+// Gets the stored import rules
+func (l *Library) GetImportRules() (ImportRules, error) {
+	value, ok, err := l.db.GetSetting(importRulesKey)
+	if err != nil || !ok {
+		return defaultImportRules, err
+	}
+
+	var rules ImportRules
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return defaultImportRules, fmt.Errorf("failed to decode import rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// Validates and stores new import rules. They apply from the next import,
+// rescan or watcher update
+func (l *Library) SetImportRules(rules ImportRules) error {
+	if _, err := rules.compile(); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(rules)
+	if err != nil {
+		return fmt.Errorf("failed to encode import rules: %w", err)
+	}
+
+	return l.db.SetSetting(importRulesKey, string(value))
+}
+
+// Loads and compiles the stored rules, falling back to the defaults if
+// they can't be used
+func (l *Library) currentRules() *ruleSet {
+	rules, err := l.GetImportRules()
+	if err == nil {
+		var rs *ruleSet
+		if rs, err = rules.compile(); err == nil {
+			return rs
+		}
+	}
+
+	log.Println("error loading import rules, using defaults:", err)
+	rs, _ := defaultImportRules.compile()
+	return rs
+}
+
+// Checks a folder found while walking. Returns why it's skipped, or ""
+func (rs *ruleSet) skipDir(dirPath string) string {
+	if rs == nil {
+		return ""
+	}
+
+	if reason := rs.excluded(dirPath); reason != "" {
+		return reason
+	}
+
+	if rs.SkipMarkedFolders {
+		for _, marker := range markerFiles {
+			if _, err := os.Stat(filepath.Join(dirPath, marker)); err == nil {
+				return "folder has a " + marker + " file"
+			}
+		}
+	}
+
+	return ""
+}
+
+// Checks a file found while walking, before it's read. Returns why it's
+// skipped, or ""
+func (rs *ruleSet) skipFile(filePath string, size int64) string {
+	if rs == nil {
+		return ""
+	}
+
+	if reason := rs.excluded(filePath); reason != "" {
+		return reason
+	}
+
+	if rs.MinFileSize > 0 && size < rs.MinFileSize {
+		return fmt.Sprintf("smaller than %d bytes", rs.MinFileSize)
+	}
+
+	return ""
+}
+
+// Checks a file's audio properties once it's been read. Returns why it's
+// skipped, or ""
+func (rs *ruleSet) skipAudio(info playback.AudioInfo) string {
+	if rs == nil {
+		return ""
+	}
+
+	// Unknown durations (0) aren't held against a file
+	if rs.MinDuration > 0 && info.Duration > 0 && info.Duration < rs.MinDuration {
+		return fmt.Sprintf("shorter than %g seconds", rs.MinDuration)
+	}
+
+	return ""
+}
+
+// Checks a file that turned up on its own (from the watcher) against every
+// folder between it and the library folder it's in, then against the file
+// rules. Returns why it's skipped, or ""
+func (rs *ruleSet) skipPath(filePath string, root string, size int64) string {
+	if rs == nil {
+		return ""
+	}
+
+	for dir := filepath.Dir(filePath); withinAny(dir, []string{root}); dir = filepath.Dir(dir) {
+		if reason := rs.skipDir(dir); reason != "" {
+			return reason
+		}
+		if dir == root {
+			break
+		}
+	}
+
+	return rs.skipFile(filePath, size)
+}
+
+// Matches a path against the exclude patterns
+func (rs *ruleSet) excluded(filePath string) string {
+	slashPath := filepath.ToSlash(filePath)
+	parts := strings.Split(slashPath, "/")
+
+	for _, pattern := range rs.ExcludeGlobs {
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, parts[len(parts)-1]); ok {
+				return "matches " + pattern
+			}
+			continue
+		}
+
+		for i := range parts {
+			if ok, _ := path.Match(pattern, strings.Join(parts[i:], "/")); ok {
+				return "matches " + pattern
+			}
+		}
+	}
+
+	for _, re := range rs.regexes {
+		if re.MatchString(slashPath) {
+			return "matches " + re.String()
+		}
+	}
+
+	return ""
+}
+
+// Reported when an import rule leaves out a file after it's been read
+type skipError struct {
+	reason string
+}
+
+func (e *skipError) Error() string {
+	return "skipped: " + e.reason
+}
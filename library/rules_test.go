@@ -0,0 +1,184 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"openturntable/playback"
+)
+
+func mustCompile(t *testing.T, rules ImportRules) *ruleSet {
+	t.Helper()
+
+	rs, err := rules.compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rs
+}
+
+func TestExcluded(t *testing.T) {
+	rs := mustCompile(t, ImportRules{
+		ExcludeGlobs:   []string{"*.m4r", "Samples", "Voice Memos/*.wav", "[Tt]emp*"},
+		ExcludeRegexes: []string{`(?i)/podcasts?/`, `_preview\.mp3$`},
+	})
+
+	tests := []struct {
+		path     string
+		excluded bool
+	}{
+		{"/music/Artist/song.mp3", false},
+
+		// Patterns without a slash match the last name only
+		{"/music/ringtone.m4r", true},
+		{"/music/Samples", true},
+		{"/music/Samples/kick.wav", false},
+		{"/music/My Samples", false},
+		{"/music/temp.flac", true},
+		{"/music/Template/song.mp3", false},
+
+		// Patterns with a slash match the end of the path
+		{"/music/Voice Memos/note.wav", true},
+		{"/music/Voice Memos/note.mp3", false},
+		{"/music/Voice Memos/old/note.wav", false},
+		{"/music/Old Voice Memos/note.wav", false},
+
+		// Regular expressions match anywhere in the whole path
+		{"/music/Podcasts/episode.mp3", true},
+		{"/music/podcast/episode.mp3", true},
+		{"/music/Podcast Mix.mp3", false},
+		{"/music/song_preview.mp3", true},
+		{"/music/song_preview.mp3.bak", false},
+	}
+
+	for _, test := range tests {
+		reason := rs.excluded(filepath.FromSlash(test.path))
+		if (reason != "") != test.excluded {
+			t.Errorf("excluded(%q) = %q, want excluded %v", test.path, reason, test.excluded)
+		}
+	}
+}
+
+func TestCompileRejectsInvalidRules(t *testing.T) {
+	tests := []ImportRules{
+		{ExcludeGlobs: []string{"[unclosed"}},
+		{ExcludeRegexes: []string{"(unclosed"}},
+	}
+
+	for _, rules := range tests {
+		if _, err := rules.compile(); err == nil {
+			t.Errorf("compiled %+v", rules)
+		}
+	}
+}
+
+func TestSkipChecks(t *testing.T) {
+	dir := t.TempDir()
+	for _, folder := range []string{"plain", "marked", "ignored", "marked/inner"} {
+		os.MkdirAll(filepath.Join(dir, folder), 0755)
+	}
+	os.WriteFile(filepath.Join(dir, "marked", ".nomedia"), nil, 0644)
+	os.WriteFile(filepath.Join(dir, "ignored", ".ignore"), nil, 0644)
+
+	rules := ImportRules{
+		ExcludeGlobs:      []string{"*.m4r"},
+		MinDuration:       30,
+		MinFileSize:       1000,
+		SkipMarkedFolders: true,
+	}
+	unmarked := rules
+	unmarked.SkipMarkedFolders = false
+
+	tests := []struct {
+		name  string
+		rules *ruleSet
+		check func(rs *ruleSet) string
+		skip  bool
+	}{
+		{"plain folder", mustCompile(t, rules), func(rs *ruleSet) string { return rs.skipDir(filepath.Join(dir, "plain")) }, false},
+		{".nomedia folder", mustCompile(t, rules), func(rs *ruleSet) string { return rs.skipDir(filepath.Join(dir, "marked")) }, true},
+		{".ignore folder", mustCompile(t, rules), func(rs *ruleSet) string { return rs.skipDir(filepath.Join(dir, "ignored")) }, true},
+		{"marked folder, markers off", mustCompile(t, unmarked), func(rs *ruleSet) string { return rs.skipDir(filepath.Join(dir, "marked")) }, false},
+
+		{"big enough file", mustCompile(t, rules), func(rs *ruleSet) string { return rs.skipFile(filepath.Join(dir, "a.mp3"), 1000) }, false},
+		{"small file", mustCompile(t, rules), func(rs *ruleSet) string { return rs.skipFile(filepath.Join(dir, "a.mp3"), 999) }, true},
+		{"excluded file", mustCompile(t, rules), func(rs *ruleSet) string { return rs.skipFile(filepath.Join(dir, "a.m4r"), 5000) }, true},
+
+		{"long song", mustCompile(t, rules), func(rs *ruleSet) string { return rs.skipAudio(playback.AudioInfo{Duration: 30}) }, false},
+		{"short song", mustCompile(t, rules), func(rs *ruleSet) string { return rs.skipAudio(playback.AudioInfo{Duration: 29.9}) }, true},
+		{"unknown duration", mustCompile(t, rules), func(rs *ruleSet) string { return rs.skipAudio(playback.AudioInfo{}) }, false},
+
+		// Files from the watcher are checked against every folder up to the root
+		{"file in plain folder", mustCompile(t, rules), func(rs *ruleSet) string {
+			return rs.skipPath(filepath.Join(dir, "plain", "a.mp3"), dir, 5000)
+		}, false},
+		{"file below marked folder", mustCompile(t, rules), func(rs *ruleSet) string {
+			return rs.skipPath(filepath.Join(dir, "marked", "inner", "a.mp3"), dir, 5000)
+		}, true},
+		{"marked folder above the root", mustCompile(t, rules), func(rs *ruleSet) string {
+			return rs.skipPath(filepath.Join(dir, "marked", "inner", "a.mp3"), filepath.Join(dir, "marked", "inner"), 5000)
+		}, false},
+		{"small file from the watcher", mustCompile(t, rules), func(rs *ruleSet) string {
+			return rs.skipPath(filepath.Join(dir, "plain", "a.mp3"), dir, 10)
+		}, true},
+
+		// No rules (a file picked directly) skip nothing
+		{"no rules", nil, func(rs *ruleSet) string {
+			return rs.skipFile(filepath.Join(dir, "a.m4r"), 1) + rs.skipDir(filepath.Join(dir, "marked")) + rs.skipAudio(playback.AudioInfo{Duration: 1})
+		}, false},
+	}
+
+	for _, test := range tests {
+		if reason := test.check(test.rules); (reason != "") != test.skip {
+			t.Errorf("%s: skip reason %q, want skipped %v", test.name, reason, test.skip)
+		}
+	}
+}
+
+func TestImportRulesSetting(t *testing.T) {
+	l := newTestLibrary(t)
+
+	rules, err := l.GetImportRules()
+	if err != nil || !reflect.DeepEqual(rules, defaultImportRules) {
+		t.Errorf("rules before setting any were %+v, %v", rules, err)
+	}
+
+	want := ImportRules{ExcludeGlobs: []string{"*.m4r"}, ExcludeRegexes: []string{"demo"}, MinDuration: 10, MinFileSize: 100}
+	if err := l.SetImportRules(want); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetImportRules(ImportRules{ExcludeRegexes: []string{"("}}); err == nil {
+		t.Error("stored invalid rules")
+	}
+
+	rules, err = l.GetImportRules()
+	if err != nil || !reflect.DeepEqual(rules, want) {
+		t.Errorf("stored rules are %+v, %v, want %+v", rules, err, want)
+	}
+}
+
+func TestImportAppliesRules(t *testing.T) {
+	l := newTestLibrary(t)
+	dir := t.TempDir()
+
+	writeTestWAV(t, filepath.Join(dir, "song.wav"), 440, 2)
+	writeTestWAV(t, filepath.Join(dir, "jingle.wav"), 440, 0.5)
+	writeTestWAV(t, filepath.Join(dir, "demos", "demo.wav"), 440, 2)
+	writeTestWAV(t, filepath.Join(dir, "private", "song.wav"), 440, 2)
+	os.WriteFile(filepath.Join(dir, "private", ".nomedia"), nil, 0644)
+
+	if err := l.SetImportRules(ImportRules{ExcludeGlobs: []string{"demos"}, MinDuration: 1, SkipMarkedFolders: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := l.Import(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Added != 1 || report.Skipped != 3 || len(report.SkippedFiles) != 3 {
+		t.Errorf("report was %+v", report)
+	}
+	songAt(t, l, filepath.Join(dir, "song.wav"))
+}
@@ -0,0 +1,196 @@
+package library
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"openturntable/tagwriter"
+)
+
+// A song's editable tags
+type SongTags struct {
+	Title  string
+	Artist string
+	Album  string
+	// Empty when it's the same as Artist
+	AlbumArtist string
+	Genre       string
+	Year        string
+	Composer    string
+	Comment     string
+	TrackNumber int64
+	TrackTotal  int64
+	DiscNumber  int64
+	DiscTotal   int64
+}
+
+// Trims the tags and checks they can be stored
+func (t *SongTags) normalize() error {
+	for _, field := range []*string{&t.Title, &t.Artist, &t.Album, &t.AlbumArtist, &t.Genre, &t.Year, &t.Composer, &t.Comment} {
+		*field = strings.TrimSpace(*field)
+	}
+
+	if t.AlbumArtist == t.Artist {
+		t.AlbumArtist = ""
+	}
+
+	if t.Year != "" {
+		if year, err := strconv.Atoi(t.Year); err != nil || year < 0 || year > 9999 {
+			return fmt.Errorf("invalid year %q", t.Year)
+		}
+	}
+
+	if t.TrackNumber < 0 || t.TrackTotal < 0 || t.DiscNumber < 0 || t.DiscTotal < 0 {
+		return errors.New("track and disc numbers can't be negative")
+	}
+
+	return nil
+}
+
+// Gets a song's tags as stored in the library, for editing
+func (l *Library) GetSongTags(id int64) (SongTags, error) {
+	song, err := l.db.GetSongWithDetails(id)
+	if err != nil {
+		return SongTags{}, err
+	}
+
+	tags := SongTags{
+		Title:       song.Title,
+		Artist:      song.ArtistName.String,
+		Album:       song.AlbumName.String,
+		AlbumArtist: song.AlbumArtistName.String,
+		Genre:       song.Genre.String,
+		Year:        song.Year.String,
+		Composer:    song.Composer.String,
+		Comment:     song.Comment.String,
+		TrackNumber: song.TrackNumber,
+		TrackTotal:  song.TrackTotal,
+		DiscNumber:  song.DiscNumber,
+		DiscTotal:   song.DiscTotal,
+	}
+
+	// Imports store a missing year as 0
+	if tags.Year == "0" {
+		tags.Year = ""
+	}
+	if tags.AlbumArtist == tags.Artist {
+		tags.AlbumArtist = ""
+	}
+
+	return tags, nil
+}
+
+// Changes a song's tags, linking it to the artist and album they name and
+// removing any artist or album left without songs. With writeToFile the
+// tags are written into the file first, and the library is only changed
+// if that worked
+func (l *Library) UpdateSong(id int64, tags SongTags, writeToFile bool) error {
+	if err := tags.normalize(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	song, err := l.db.GetSongById(id)
+	if err != nil {
+		return err
+	}
+
+	// A renamed album keeps its art. That's when its last song moves off it
+	var art string
+	var oldAlbumID int64
+	if song.Album_ID.Valid {
+		songs, err := l.db.GetSongsInAlbum(song.Album_ID.Int64)
+		if err != nil {
+			return err
+		}
+		if len(songs) == 1 {
+			album, err := l.db.GetAlbumById(song.Album_ID.Int64)
+			if err != nil {
+				return err
+			}
+			art, oldAlbumID = album.Art, album.ID
+		}
+	}
+
+	if writeToFile {
+		if song.Missing {
+			return fmt.Errorf("can't write tags, %s is missing", song.Path)
+		}
+
+		err := tagwriter.Write(song.Path, tagwriter.Changes{Tags: &tagwriter.Tags{
+			Title:       tags.Title,
+			Artist:      tags.Artist,
+			Album:       tags.Album,
+			AlbumArtist: tags.AlbumArtist,
+			Genre:       tags.Genre,
+			Year:        tags.Year,
+			Composer:    tags.Composer,
+			Comment:     tags.Comment,
+			Track:       tags.TrackNumber,
+			TrackTotal:  tags.TrackTotal,
+			Disc:        tags.DiscNumber,
+			DiscTotal:   tags.DiscTotal,
+		}})
+		if err != nil {
+			return err
+		}
+
+		// Stored so rescans and the watcher don't import the file again
+		info, err := os.Stat(song.Path)
+		if err != nil {
+			return err
+		}
+		if song.ContentHash != "" {
+			if song.ContentHash, err = HashFile(song.Path); err != nil {
+				return err
+			}
+		}
+		song.FileSize, song.ModTime = info.Size(), info.ModTime().Unix()
+	}
+
+	batch, err := l.db.BeginImportBatch()
+	if err != nil {
+		return err
+	}
+	defer batch.Rollback()
+
+	artistID, albumID, err := linkArtistAndAlbum(batch, tags.Artist, tags.AlbumArtist, tags.Album, art)
+	if err != nil {
+		return err
+	}
+	if oldAlbumID != 0 && albumID != 0 && albumID != oldAlbumID {
+		if err := batch.CopyAlbumArtwork(oldAlbumID, albumID); err != nil {
+			return err
+		}
+	}
+
+	// Like imports, a song without a title goes by its file name
+	song.Title = tags.Title
+	if song.Title == "" {
+		song.Title = filepath.Base(song.Path)
+	}
+	song.Artist_ID = sql.NullInt64{Int64: artistID, Valid: artistID != 0}
+	song.Album_ID = sql.NullInt64{Int64: albumID, Valid: albumID != 0}
+	song.Composer = sql.NullString{String: tags.Composer, Valid: tags.Composer != ""}
+	song.Comment = sql.NullString{String: tags.Comment, Valid: tags.Comment != ""}
+	song.Genre = sql.NullString{String: tags.Genre, Valid: tags.Genre != ""}
+	song.Year = sql.NullString{String: tags.Year, Valid: tags.Year != ""}
+	song.TrackNumber, song.TrackTotal = tags.TrackNumber, tags.TrackTotal
+	song.DiscNumber, song.DiscTotal = tags.DiscNumber, tags.DiscTotal
+
+	if err := batch.UpdateSongTags(song); err != nil {
+		return err
+	}
+	if err := batch.RemoveOrphans(); err != nil {
+		return err
+	}
+
+	return batch.Commit()
+}
@@ -0,0 +1,445 @@
+package library
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"openturntable/database"
+)
+
+// Watches library folders and applies changes in debounced batches
+type watcher struct {
+	fs       *fsnotify.Watcher
+	debounce time.Duration
+	onChange func(ScanSummary)
+
+	mu      sync.Mutex
+	pending map[string]bool
+	timer   *time.Timer
+
+	// Size and modification time of queued files at the last check, see
+	// settled
+	unsettled map[string]fileState
+}
+
+// What a file looked like when the watcher last checked it
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// Starts watching every library folder, after catching up on changes made
+// while the app wasn't running. Changes are applied once things have been
+// quiet for the debounce delay, and onChange is called with what each
+// catch-up scan or batch of changes did
+func (l *Library) Watch(ctx context.Context, debounce time.Duration, onChange func(ScanSummary)) error {
+	if l.watcher != nil {
+		return fmt.Errorf("library is already being watched")
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to start library watcher: %w", err)
+	}
+
+	folders, err := l.db.GetLibraryFolders()
+	if err != nil {
+		fsw.Close()
+		return err
+	}
+
+	l.watcher = &watcher{
+		fs:        fsw,
+		debounce:  debounce,
+		onChange:  onChange,
+		pending:   make(map[string]bool),
+		unsettled: make(map[string]fileState),
+	}
+
+	go l.watchLoop(ctx)
+	go func() {
+		for _, folder := range folders {
+			l.watchFolder(folder)
+		}
+	}()
+
+	return nil
+}
+
+// Adds a folder to the library, then watches and scans it if the watcher is running
+func (l *Library) AddFolder(path string) (int64, error) {
+	path = filepath.Clean(path)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return -1, fmt.Errorf("failed to read folder: %w", err)
+	}
+	if !info.IsDir() {
+		return -1, fmt.Errorf("%s is not a folder", path)
+	}
+
+	id, err := l.db.CreateLibraryFolder(path)
+	if err != nil {
+		return -1, err
+	}
+
+	if l.watcher != nil {
+		go l.watchFolder(database.LibraryFolder{ID: id, Path: path})
+	}
+
+	return id, nil
+}
+
+// Removes a folder from the library and stops watching it. Its songs are kept
+func (l *Library) RemoveFolder(id int64) error {
+	folder, err := l.db.GetLibraryFolderById(id)
+	if err != nil {
+		return err
+	}
+
+	if err := l.db.DeleteLibraryFolder(id); err != nil {
+		return err
+	}
+
+	if l.watcher == nil {
+		return nil
+	}
+
+	// Keep watching anything still covered by another library folder
+	remaining, err := l.db.GetLibraryFolders()
+	if err != nil {
+		return err
+	}
+	var roots []string
+	for _, f := range remaining {
+		roots = append(roots, f.Path)
+	}
+
+	for _, path := range l.watcher.fs.WatchList() {
+		if withinAny(path, []string{folder.Path}) && !withinAny(path, roots) {
+			l.watcher.fs.Remove(path)
+		}
+	}
+
+	return nil
+}
+
+// Starts watching a library folder, then scans it for changes
+func (l *Library) watchFolder(folder database.LibraryFolder) {
+	// Watch first so nothing slips through while the scan runs
+	l.watchTree(folder.Path)
+
+	summary, err := l.Rescan(folder.Path, ScanOptions{}, nil)
+	if err != nil {
+		log.Printf("error scanning library folder %s: %v\n", folder.Path, err)
+		return
+	}
+
+	if err := l.db.SetLibraryFolderScanned(folder.ID, time.Now().Unix()); err != nil {
+		log.Println(err)
+	}
+
+	if summary.Changed() && l.watcher.onChange != nil {
+		l.watcher.onChange(summary)
+	}
+}
+
+// Watches a folder and every folder below it (fsnotify isn't recursive).
+// Returns the audio files found along the way
+func (l *Library) watchTree(root string) []string {
+	var files []string
+
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("error accessing %s: %v\n", path, err)
+			return nil
+		}
+
+		if d.IsDir() {
+			if err := l.watcher.fs.Add(path); err != nil {
+				log.Printf("error watching %s: %v\n", path, err)
+			}
+		} else if IsSupported(path) {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+
+	return files
+}
+
+// Receives filesystem events until the context is cancelled
+func (l *Library) watchLoop(ctx context.Context) {
+	defer l.watcher.fs.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-l.watcher.fs.Events:
+			if !ok {
+				return
+			}
+			l.handleEvent(event)
+		case err, ok := <-l.watcher.fs.Errors:
+			if !ok {
+				return
+			}
+			log.Println("library watcher error:", err)
+		}
+	}
+}
+
+// Queues the paths affected by a filesystem event
+func (l *Library) handleEvent(event fsnotify.Event) {
+	switch {
+	case event.Has(fsnotify.Create):
+		info, err := os.Stat(event.Name)
+		if err != nil {
+			return
+		}
+
+		// Folders moved or copied in arrive as a single event, so their
+		// contents need watching and importing too
+		if info.IsDir() {
+			for _, path := range l.watchTree(event.Name) {
+				l.queue(path)
+			}
+			return
+		}
+
+		if IsSupported(event.Name) {
+			l.queue(event.Name)
+		}
+	case event.Has(fsnotify.Write):
+		if IsSupported(event.Name) {
+			l.queue(event.Name)
+		}
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		// Could be a folder, so queue it whatever its extension
+		l.queue(event.Name)
+	}
+}
+
+// Adds a path to the next batch and restarts the debounce timer
+func (l *Library) queue(path string) {
+	w := l.watcher
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending[path] = true
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.debounce, l.flush)
+	} else {
+		w.timer.Reset(w.debounce)
+	}
+}
+
+// Reports whether a file looks the same as at the last check, so it's
+// probably finished being written. Copies and downloads write a little at a
+// time and a quiet moment doesn't mean they're done, so every file has to
+// keep its size and modification time across two checks before importing
+func (w *watcher) settled(path string, info fs.FileInfo) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	state := fileState{size: info.Size(), modTime: info.ModTime()}
+	last, ok := w.unsettled[path]
+	w.unsettled[path] = state
+	return ok && last == state
+}
+
+// Applies every queued change: files that exist are imported or updated,
+// and songs at (or inside) paths that are gone are marked missing, unless a
+// new file turns out to be one of them moved. While any file is still being
+// written the whole batch waits, so both ends of a move stay together
+func (l *Library) flush() {
+	w := l.watcher
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = make(map[string]bool)
+	w.timer = nil
+	w.mu.Unlock()
+
+	settling := false
+	for path := range pending {
+		info, err := os.Stat(path)
+		if err == nil && info.Mode().IsRegular() && IsSupported(path) && !w.settled(path, info) {
+			settling = true
+		}
+	}
+	if settling {
+		for path := range pending {
+			l.queue(path)
+		}
+		return
+	}
+	defer w.forget(pending)
+
+	rules := l.currentRules()
+
+	var roots []string
+	folders, err := l.db.GetLibraryFolders()
+	if err != nil {
+		log.Println(err)
+	}
+	for _, folder := range folders {
+		roots = append(roots, folder.Path)
+	}
+
+	l.mu.Lock()
+	var summary ScanSummary
+
+	// Work out what's gone first, so files that were moved can be matched
+	// to the songs they used to be
+	var present []string
+	var gone []database.Song
+	for path := range pending {
+		if _, err := os.Stat(path); err == nil {
+			present = append(present, path)
+		} else if os.IsNotExist(err) {
+			gone = append(gone, l.songsAt(path)...)
+		} else {
+			log.Printf("error accessing %s: %v\n", path, err)
+		}
+	}
+
+	missing, err := l.db.GetMissingSongs()
+	if err != nil {
+		log.Println(err)
+	}
+	candidates := append(gone, missing...)
+	moves := newMoveIndex(candidates, l.storedFingerprints(candidates))
+
+	for _, path := range present {
+		l.applyChange(path, rules, roots, moves, &summary)
+	}
+
+	for _, song := range gone {
+		if moves.taken[song.ID] {
+			continue
+		}
+		if err := l.db.SetSongMissing(song.ID, true); err != nil {
+			log.Println(err)
+			summary.Failed++
+			continue
+		}
+		summary.Missing++
+	}
+	l.mu.Unlock()
+
+	if summary.Changed() && w.onChange != nil {
+		w.onChange(summary)
+	}
+}
+
+// Drops the states of files that have been dealt with
+func (w *watcher) forget(paths map[string]bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for path := range paths {
+		delete(w.unsettled, path)
+	}
+}
+
+// Gets the songs (not already missing) at a path, or inside it if it was a folder
+func (l *Library) songsAt(path string) []database.Song {
+	songs, err := l.db.GetSongsInFolder(path)
+	if err != nil {
+		log.Println(err)
+	}
+	if song, err := l.db.GetSongByPath(path); err == nil {
+		songs = append(songs, song)
+	}
+
+	var present []database.Song
+	for _, song := range songs {
+		if !song.Missing {
+			present = append(present, song)
+		}
+	}
+	return present
+}
+
+// Brings the library in line with a file that was created or changed
+func (l *Library) applyChange(path string, rules *ruleSet, roots []string, moves *moveIndex, summary *ScanSummary) {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Printf("error accessing %s: %v\n", path, err)
+		return
+	}
+	if info.IsDir() || !IsSupported(path) {
+		return
+	}
+
+	song, err := l.db.GetSongByPath(path)
+	known := err == nil
+
+	// Files the rules leave out are treated like they're gone
+	skipped := func() {
+		summary.Skipped++
+		if known && !song.Missing {
+			if err := l.db.SetSongMissing(song.ID, true); err != nil {
+				log.Println(err)
+				return
+			}
+			summary.Missing++
+		}
+	}
+
+	if reason := rules.skipPath(path, rootOf(path, roots), info.Size()); reason != "" {
+		skipped()
+		return
+	}
+
+	if known {
+		changed, _, err := l.fileChanged(song, path, false)
+		if err == nil && !changed {
+			return
+		}
+	}
+
+	_, moved, err := l.importFile(path, rules, moves)
+
+	var skip *skipError
+	switch {
+	case errors.As(err, &skip):
+		skipped()
+	case err != nil:
+		log.Printf("error importing %s: %v\n", path, err)
+		summary.Failed++
+	case moved:
+		summary.Moved++
+	case known:
+		summary.Updated++
+	default:
+		summary.Added++
+	}
+}
+
+// Finds the innermost library folder holding a path, or the path's own
+// folder if it isn't in one
+func rootOf(path string, roots []string) string {
+	best := ""
+	for _, root := range roots {
+		if withinAny(path, []string{root}) && len(root) > len(best) {
+			best = root
+		}
+	}
+
+	if best == "" {
+		return filepath.Dir(path)
+	}
+	return best
+}
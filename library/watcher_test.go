@@ -0,0 +1,201 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Sets up the library's watcher without watching the filesystem, so tests
+// can feed it events. Returns the summaries of applied batches
+func startTestWatcher(t *testing.T, l *Library, debounce time.Duration) <-chan ScanSummary {
+	t.Helper()
+
+	changes := make(chan ScanSummary, 10)
+	l.watcher = &watcher{
+		debounce:  debounce,
+		onChange:  func(summary ScanSummary) { changes <- summary },
+		pending:   make(map[string]bool),
+		unsettled: make(map[string]fileState),
+	}
+	return changes
+}
+
+// Sends filesystem events to the watcher
+func sendEvents(l *Library, op fsnotify.Op, paths ...string) {
+	for _, path := range paths {
+		l.handleEvent(fsnotify.Event{Name: path, Op: op})
+	}
+}
+
+// Gets the summary of the last batch, failing if there wasn't one
+func nextChange(t *testing.T, changes <-chan ScanSummary) ScanSummary {
+	t.Helper()
+
+	select {
+	case summary := <-changes:
+		return summary
+	case <-time.After(5 * time.Second):
+		t.Fatal("no batch was applied")
+		return ScanSummary{}
+	}
+}
+
+func assertNoChange(t *testing.T, changes <-chan ScanSummary) {
+	t.Helper()
+
+	select {
+	case summary := <-changes:
+		t.Fatalf("a batch was applied early: %+v", summary)
+	default:
+	}
+}
+
+func TestWatcherWaitsForFilesToSettle(t *testing.T) {
+	l := newTestLibrary(t)
+	// The timer never fires, batches are flushed by hand
+	changes := startTestWatcher(t, l, time.Hour)
+
+	path := filepath.Join(t.TempDir(), "song.wav")
+	data := testWAV(440, 2)
+
+	// A copy that's only partway done
+	if err := os.WriteFile(path, data[:len(data)/2], 0644); err != nil {
+		t.Fatal(err)
+	}
+	sendEvents(l, fsnotify.Create, path)
+	l.flush()
+	assertNoChange(t, changes)
+
+	// Still growing at the next check
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(data[len(data)/2:])
+	f.Close()
+	sendEvents(l, fsnotify.Write, path)
+	l.flush()
+	assertNoChange(t, changes)
+	if _, err := l.db.GetSongByPath(path); err == nil {
+		t.Fatal("file was imported while it was still being written")
+	}
+
+	// Unchanged since the last check, so it's imported whole
+	l.flush()
+	if summary := nextChange(t, changes); summary.Added != 1 {
+		t.Errorf("batch was %+v, want one song added", summary)
+	}
+	if song := songAt(t, l, path); song.Duration < 1.9 {
+		t.Errorf("imported duration is %g, want the whole 2s", song.Duration)
+	}
+	if len(l.watcher.unsettled) != 0 || len(l.watcher.pending) != 0 {
+		t.Errorf("watcher still tracks %v and %v", l.watcher.unsettled, l.watcher.pending)
+	}
+}
+
+func TestWatcherMovesAndRemovals(t *testing.T) {
+	l := newTestLibrary(t)
+	changes := startTestWatcher(t, l, time.Hour)
+
+	dir := t.TempDir()
+	if _, err := l.db.CreateLibraryFolder(dir); err != nil {
+		t.Fatal(err)
+	}
+	a, b := filepath.Join(dir, "a.wav"), filepath.Join(dir, "b.wav")
+	writeTestWAV(t, a, 440, 1)
+	writeTestWAV(t, b, 660, 1)
+
+	sendEvents(l, fsnotify.Create, a, b)
+	l.flush()
+	l.flush()
+	if summary := nextChange(t, changes); summary.Added != 2 {
+		t.Fatalf("batch was %+v, want two songs added", summary)
+	}
+	songA, songB := songAt(t, l, a), songAt(t, l, b)
+
+	// Renames arrive as the old name going and the new one appearing
+	renamed := filepath.Join(dir, "renamed.wav")
+	if err := os.Rename(a, renamed); err != nil {
+		t.Fatal(err)
+	}
+	sendEvents(l, fsnotify.Rename, a)
+	sendEvents(l, fsnotify.Create, renamed)
+
+	// The old song isn't given up on while the new file settles
+	l.flush()
+	assertNoChange(t, changes)
+	if song := songAt(t, l, a); song.Missing {
+		t.Error("moved song was marked missing before its new file was checked")
+	}
+
+	l.flush()
+	if summary := nextChange(t, changes); summary.Moved != 1 || summary.Missing != 0 || summary.Added != 0 {
+		t.Errorf("batch was %+v, want one song moved", summary)
+	}
+	if song := songAt(t, l, renamed); song.ID != songA.ID {
+		t.Errorf("renamed file is song %d, want %d", song.ID, songA.ID)
+	}
+
+	// Removed files are marked missing straight away
+	if err := os.Remove(b); err != nil {
+		t.Fatal(err)
+	}
+	sendEvents(l, fsnotify.Remove, b)
+	l.flush()
+	if summary := nextChange(t, changes); summary.Missing != 1 {
+		t.Errorf("batch was %+v, want one song missing", summary)
+	}
+	if song, err := l.db.GetSongById(songB.ID); err != nil || !song.Missing {
+		t.Errorf("removed song is %+v, %v", song, err)
+	}
+
+	// Files that aren't audio are ignored
+	other := filepath.Join(dir, "notes.txt")
+	os.WriteFile(other, []byte("notes"), 0644)
+	sendEvents(l, fsnotify.Create, other)
+	if len(l.watcher.pending) != 0 {
+		t.Errorf("queued %v", l.watcher.pending)
+	}
+}
+
+func TestWatcherDebouncesIntoOneBatch(t *testing.T) {
+	const debounce = 300 * time.Millisecond
+
+	l := newTestLibrary(t)
+	changes := startTestWatcher(t, l, debounce)
+
+	dir := t.TempDir()
+	var paths []string
+	for i, freq := range []float64{440, 550, 660} {
+		path := filepath.Join(dir, string(rune('a'+i))+".wav")
+		writeTestWAV(t, path, freq, 1)
+		paths = append(paths, path)
+	}
+
+	// Each event pushes the batch back
+	sendEvents(l, fsnotify.Create, paths[0])
+	time.Sleep(debounce * 2 / 3)
+	sendEvents(l, fsnotify.Create, paths[1])
+	time.Sleep(debounce * 2 / 3)
+	sendEvents(l, fsnotify.Create, paths[2], paths[2])
+	assertNoChange(t, changes)
+
+	// Not even checked yet, the first event's delay has long passed
+	l.watcher.mu.Lock()
+	checked := len(l.watcher.unsettled)
+	l.watcher.mu.Unlock()
+	if checked != 0 {
+		t.Error("the batch was checked before things were quiet")
+	}
+
+	if summary := nextChange(t, changes); summary.Added != 3 {
+		t.Errorf("batch was %+v, want all three songs added", summary)
+	}
+
+	time.Sleep(2 * debounce)
+	assertNoChange(t, changes)
+}
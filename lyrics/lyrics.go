@@ -0,0 +1,260 @@
+package lyrics
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dhowden/tag"
+)
+
+// A single word of an enhanced LRC line
+type Word struct {
+	Time float64
+	Text string
+}
+
+// A single lyric line. Time is in seconds, or -1 for unsynced lyrics
+type Line struct {
+	Time  float64
+	Text  string
+	Words []Word
+}
+
+// Lyrics for a song, either synced (from LRC) or plain text
+type Lyrics struct {
+	Synced bool
+	Source string
+	Lines  []Line
+	Tags   map[string]string
+}
+
+var (
+	// [mm:ss], [mm:ss.xx] or [mm:ss:xx]
+	timeTagPattern = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?:[.:](\d{1,3}))?\]`)
+
+	// [key:value] ID tags such as [ar:Artist] or [offset:+200]
+	idTagPattern = regexp.MustCompile(`^\[([A-Za-z#]+):(.*)\]$`)
+
+	// <mm:ss.xx> word timings in enhanced LRC
+	wordTagPattern = regexp.MustCompile(`<(\d+):(\d{1,2})(?:[.:](\d{1,3}))?>`)
+)
+
+// Finds lyrics for an audio file, preferring a synced sidecar .lrc file and
+// falling back to lyrics embedded in the file's tags (ID3 USLT / Vorbis LYRICS)
+func Load(audioPath string) (*Lyrics, error) {
+	if lrcPath := findSidecar(audioPath); lrcPath != "" {
+		f, err := os.Open(lrcPath)
+		if err == nil {
+			defer f.Close()
+
+			// Without timestamps there are no lyrics to show, so try the tags
+			l, err := ParseLRC(f)
+			if err == nil && l.Synced {
+				l.Source = lrcPath
+				return l, nil
+			}
+		}
+	}
+
+	f, err := os.Open(audioPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tags, err := tag.ReadFrom(f)
+	if err != nil {
+		return nil, err
+	}
+
+	text := tags.Lyrics()
+	if text == "" {
+		if raw, ok := tags.Raw()["unsyncedlyrics"].(string); ok {
+			text = raw
+		}
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, errors.New("no lyrics found")
+	}
+
+	// Some taggers embed LRC text, so use the timestamps if there are any
+	l, err := ParseLRC(strings.NewReader(text))
+	if err != nil || !l.Synced {
+		l = ParsePlain(text)
+	}
+	l.Source = "tag"
+
+	return l, nil
+}
+
+// Looks for a .lrc file with the same name as the audio file
+func findSidecar(audioPath string) string {
+	base := strings.TrimSuffix(audioPath, filepath.Ext(audioPath))
+	for _, ext := range []string{".lrc", ".LRC", ".Lrc"} {
+		if info, err := os.Stat(base + ext); err == nil && !info.IsDir() {
+			return base + ext
+		}
+	}
+	return ""
+}
+
+// Splits plain (unsynced) lyrics into lines
+func ParsePlain(text string) *Lyrics {
+	l := &Lyrics{Tags: make(map[string]string)}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		l.Lines = append(l.Lines, Line{Time: -1, Text: strings.TrimSpace(line)})
+	}
+
+	return l
+}
+
+// Parses LRC lyrics, including lines with several timestamps, enhanced
+// word-level <mm:ss.xx> tags and the [offset:] tag
+func ParseLRC(r io.Reader) (*Lyrics, error) {
+	l := &Lyrics{Tags: make(map[string]string)}
+	var offset float64
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" {
+			continue
+		}
+
+		// Collect every leading timestamp, e.g. [00:12.00][01:30.00]Chorus
+		var times []float64
+		for {
+			match := timeTagPattern.FindStringSubmatch(line)
+			if match == nil {
+				break
+			}
+			times = append(times, parseTimestamp(match[1], match[2], match[3]))
+			line = line[len(match[0]):]
+		}
+
+		if len(times) == 0 {
+			if match := idTagPattern.FindStringSubmatch(line); match != nil {
+				key := strings.ToLower(match[1])
+				value := strings.TrimSpace(match[2])
+				l.Tags[key] = value
+
+				// Offset is in milliseconds, positive values show lyrics sooner
+				if key == "offset" {
+					if ms, err := strconv.ParseFloat(value, 64); err == nil {
+						offset = ms / 1000
+					}
+				}
+			}
+			continue
+		}
+
+		text, words := parseWords(line)
+		for _, t := range times {
+			l.Lines = append(l.Lines, Line{Time: t, Text: text, Words: words})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(l.Lines) == 0 {
+		return l, nil
+	}
+
+	l.Synced = true
+	for i := range l.Lines {
+		l.Lines[i].Time = max(l.Lines[i].Time-offset, 0)
+
+		if l.Lines[i].Words != nil {
+			words := make([]Word, len(l.Lines[i].Words))
+			for j, w := range l.Lines[i].Words {
+				words[j] = Word{Time: max(w.Time-offset, 0), Text: w.Text}
+			}
+			l.Lines[i].Words = words
+		}
+	}
+
+	sort.SliceStable(l.Lines, func(i, j int) bool {
+		return l.Lines[i].Time < l.Lines[j].Time
+	})
+
+	return l, nil
+}
+
+// Splits an enhanced LRC line into its plain text and timed words
+func parseWords(line string) (string, []Word) {
+	matches := wordTagPattern.FindAllStringSubmatchIndex(line, -1)
+	if matches == nil {
+		return strings.TrimSpace(line), nil
+	}
+
+	var words []Word
+	for i, m := range matches {
+		end := len(line)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+
+		text := line[m[1]:end]
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		var fraction string
+		if m[6] >= 0 {
+			fraction = line[m[6]:m[7]]
+		}
+		words = append(words, Word{
+			Time: parseTimestamp(line[m[2]:m[3]], line[m[4]:m[5]], fraction),
+			Text: text,
+		})
+	}
+
+	return strings.TrimSpace(wordTagPattern.ReplaceAllString(line, "")), words
+}
+
+// Converts LRC timestamp parts to seconds. The fraction can be tenths,
+// hundredths or milliseconds depending on how many digits it has
+func parseTimestamp(minutes string, seconds string, fraction string) float64 {
+	m, _ := strconv.Atoi(minutes)
+	s, _ := strconv.Atoi(seconds)
+	t := float64(m*60 + s)
+
+	if fraction != "" {
+		f, _ := strconv.Atoi(fraction)
+		switch len(fraction) {
+		case 1:
+			t += float64(f) / 10
+		case 2:
+			t += float64(f) / 100
+		default:
+			t += float64(f) / 1000
+		}
+	}
+
+	return t
+}
+
+// Returns the index of the line being sung at a position (in seconds), or -1
+// if the lyrics are unsynced or the first line hasn't been reached yet
+func (l *Lyrics) LineAt(position float64) int {
+	if l == nil || !l.Synced {
+		return -1
+	}
+
+	// First line starting after the position, the one before it is current
+	return sort.Search(len(l.Lines), func(i int) bool {
+		return l.Lines[i].Time > position
+	}) - 1
+}
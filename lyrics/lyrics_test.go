@@ -0,0 +1,266 @@
+package lyrics
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Line times and texts, for comparing parsed lyrics
+type timedText struct {
+	time float64
+	text string
+}
+
+func timedTexts(l *Lyrics) []timedText {
+	var got []timedText
+	for _, line := range l.Lines {
+		got = append(got, timedText{math.Round(line.Time*1000) / 1000, line.Text})
+	}
+	return got
+}
+
+func TestParseLRC(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []timedText
+	}{
+		{"one timestamp per line", "[00:01.00]First\n[00:02.50]Second\n", []timedText{
+			{1, "First"}, {2.5, "Second"},
+		}},
+		{"several timestamps on a line", "[00:05.00]Verse\n[00:01.00][00:10.00]Chorus\n", []timedText{
+			{1, "Chorus"}, {5, "Verse"}, {10, "Chorus"},
+		}},
+		{"fraction lengths", "[00:01]None\n[00:01.5]Tenths\n[00:01.25]Hundredths\n[00:01.125]Milliseconds\n[01:02:03]Colon\n", []timedText{
+			{1, "None"}, {1.125, "Milliseconds"}, {1.25, "Hundredths"}, {1.5, "Tenths"}, {62.03, "Colon"},
+		}},
+		{"minutes past an hour", "[75:00.00]Late\n", []timedText{
+			{4500, "Late"},
+		}},
+		{"offset shows lyrics sooner", "[offset:+500]\n[00:02.00]Two\n[00:00.20]Clamped\n", []timedText{
+			{0, "Clamped"}, {1.5, "Two"},
+		}},
+		{"negative offset shows them later", "[00:02.00]Two\n[offset:-250]\n", []timedText{
+			{2.25, "Two"},
+		}},
+		{"invalid offset is ignored", "[offset:soon]\n[00:02.00]Two\n", []timedText{
+			{2, "Two"},
+		}},
+		{"empty lines keep their time", "[00:01.00]Words\n[00:03.00]\n", []timedText{
+			{1, "Words"}, {3, ""},
+		}},
+		{"BOM, CRLF and stray text", "\ufeff[00:01.00] Spaced \r\nnot a lyric\r\n[bad]\r\n", []timedText{
+			{1, "Spaced"},
+		}},
+	}
+
+	for _, test := range tests {
+		l, err := ParseLRC(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !l.Synced {
+			t.Errorf("%s: lyrics aren't synced", test.name)
+		}
+		if got := timedTexts(l); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: parsed %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseLRCTags(t *testing.T) {
+	input := "[ar: Some Artist ]\n[ti:Title: With Colon]\n[AL:Album]\n[by:]\n[offset:100]\n[#:comment]\n[00:01.00]Line\n"
+
+	l, err := ParseLRC(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		"ar":     "Some Artist",
+		"ti":     "Title: With Colon",
+		"al":     "Album",
+		"by":     "",
+		"offset": "100",
+		"#":      "comment",
+	}
+	if !reflect.DeepEqual(l.Tags, want) {
+		t.Errorf("tags are %v, want %v", l.Tags, want)
+	}
+	if len(l.Lines) != 1 {
+		t.Errorf("tags were read as lines: %v", timedTexts(l))
+	}
+}
+
+func TestParseLRCWords(t *testing.T) {
+	input := "[offset:500]\n[00:10.00]<00:10.00>Hello <00:10.50>there <00:11.25>world<00:12.00>\n"
+
+	l, err := ParseLRC(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line := l.Lines[0]
+	if line.Text != "Hello there world" {
+		t.Errorf("text is %q", line.Text)
+	}
+
+	// The offset moves words with their line, and the closing tag has no word
+	want := []Word{{9.5, "Hello "}, {10, "there "}, {10.75, "world"}}
+	if !reflect.DeepEqual(line.Words, want) {
+		t.Errorf("words are %+v, want %+v", line.Words, want)
+	}
+}
+
+func TestParseLRCWithoutTimestamps(t *testing.T) {
+	l, err := ParseLRC(strings.NewReader("[ar:Artist]\nJust words\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Synced || len(l.Lines) != 0 {
+		t.Errorf("parsed %+v from lyrics without timestamps", l)
+	}
+}
+
+func TestParsePlain(t *testing.T) {
+	l := ParsePlain("\r\n First line \r\n\r\nSecond line\n")
+
+	want := []Line{{Time: -1, Text: "First line"}, {Time: -1, Text: ""}, {Time: -1, Text: "Second line"}}
+	if l.Synced || !reflect.DeepEqual(l.Lines, want) {
+		t.Errorf("parsed %+v, want %+v", l, want)
+	}
+}
+
+func TestLineAt(t *testing.T) {
+	l, err := ParseLRC(strings.NewReader("[00:05.00]One\n[00:10.00]Two\n[00:10.00]Also two\n[00:20.00]Three\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		position float64
+		want     int
+	}{
+		{0, -1},
+		{4.99, -1},
+		{5, 0},
+		{9.99, 0},
+		// Lines sharing a time show the last of them
+		{10, 2},
+		{19.9, 2},
+		{20, 3},
+		{1000, 3},
+	}
+
+	for _, test := range tests {
+		if got := l.LineAt(test.position); got != test.want {
+			t.Errorf("LineAt(%g) = %d, want %d", test.position, got, test.want)
+		}
+	}
+
+	var none *Lyrics
+	for _, unsynced := range []*Lyrics{none, ParsePlain("Some words"), {Synced: true}} {
+		if got := unsynced.LineAt(10); got != -1 {
+			t.Errorf("LineAt on %+v = %d, want -1", unsynced, got)
+		}
+	}
+}
+
+// Builds an MP3 file holding only an ID3v2.3 tag with unsynced lyrics
+func id3WithLyrics(text string) []byte {
+	var frame bytes.Buffer
+	frame.WriteByte(0) // ISO-8859-1
+	frame.WriteString("eng")
+	frame.WriteByte(0) // empty description
+	frame.WriteString(text)
+
+	var frames bytes.Buffer
+	frames.WriteString("USLT")
+	binary.Write(&frames, binary.BigEndian, uint32(frame.Len()))
+	frames.Write([]byte{0, 0})
+	frames.Write(frame.Bytes())
+
+	// The tag size is synchsafe, 7 bits per byte
+	size := frames.Len()
+	var file bytes.Buffer
+	file.WriteString("ID3")
+	file.Write([]byte{3, 0, 0, byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)})
+	file.Write(frames.Bytes())
+	return file.Bytes()
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name     string
+		embedded string // lyrics in the file's tag, if any
+		sidecar  string // .lrc file next to it, if any
+		synced   bool
+		source   string
+		want     []timedText
+	}{
+		{"sidecar beats the tag", "Embedded", "[00:01.00]Sidecar\n", true, "song.lrc", []timedText{
+			{1, "Sidecar"},
+		}},
+		{"synced lyrics in the tag", "[00:02.00]Tagged", "", true, "tag", []timedText{
+			{2, "Tagged"},
+		}},
+		{"plain lyrics in the tag", "First\nSecond", "", false, "tag", []timedText{
+			{-1, "First"}, {-1, "Second"},
+		}},
+		{"sidecar without timestamps", "Embedded", "[ar:Artist]\n", false, "tag", []timedText{
+			{-1, "Embedded"},
+		}},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		audioPath := filepath.Join(dir, "song.mp3")
+		if err := os.WriteFile(audioPath, id3WithLyrics(test.embedded), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if test.sidecar != "" {
+			if err := os.WriteFile(filepath.Join(dir, "song.lrc"), []byte(test.sidecar), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		l, err := Load(audioPath)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+
+		source := l.Source
+		if source != "tag" {
+			source = filepath.Base(source)
+		}
+		if l.Synced != test.synced || source != test.source {
+			t.Errorf("%s: loaded synced %v from %q, want %v from %q", test.name, l.Synced, source, test.synced, test.source)
+		}
+		if got := timedTexts(l); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: loaded %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLoadWithoutLyrics(t *testing.T) {
+	dir := t.TempDir()
+	audioPath := filepath.Join(dir, "song.mp3")
+	if err := os.WriteFile(audioPath, id3WithLyrics("  \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if l, err := Load(audioPath); err == nil {
+		t.Errorf("loaded %+v from a file without lyrics", l)
+	}
+	if _, err := Load(filepath.Join(dir, "missing.mp3")); err == nil {
+		t.Error("loaded lyrics for a file that doesn't exist")
+	}
+}
@@ -35,6 +35,8 @@ func main() {
 		BackgroundColour:  &options.RGBA{R: 0, G: 0, B: 0, A: 255},
 		AssetServer: &assetserver.Options{
 			Assets: bundle.Bundle,
+			// Serves cached artwork under /art/ (anything not in the bundle)
+			Handler: app.artwork,
 		},
 		Menu:             nil,
 		Logger:           nil,
@@ -0,0 +1,140 @@
+package playback
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gopxl/beep"
+	"github.com/gopxl/beep/flac"
+	"github.com/gopxl/beep/mp3"
+	"github.com/gopxl/beep/vorbis"
+	"github.com/gopxl/beep/wav"
+)
+
+// Technical details of an audio file
+type AudioInfo struct {
+	Duration   float64 // seconds
+	SampleRate int64
+	BitDepth   int64 // 0 for lossy formats
+	Channels   int64
+	Bitrate    int64 // average, in kbps
+	Codec      string
+	FileSize   int64
+	ModTime    int64 // unix seconds
+}
+
+// Reads the technical details of an audio file by opening it with its
+// decoder, without decoding any audio
+func ReadAudioInfo(filePath string) (AudioInfo, error) {
+	var info AudioInfo
+
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return info, err
+	}
+	info.FileSize = stat.Size()
+	info.ModTime = stat.ModTime().Unix()
+
+	streamer, format, codec, err := openDecoder(filePath)
+	if err != nil {
+		return info, err
+	}
+	defer streamer.Close()
+
+	info.Codec = codec
+	info.SampleRate = int64(format.SampleRate)
+	info.Channels = int64(format.NumChannels)
+	// Lossy formats don't have a real bit depth
+	if codec != "mp3" && codec != "vorbis" {
+		info.BitDepth = int64(format.Precision * 8)
+	}
+
+	if format.SampleRate > 0 && streamer.Len() > 0 {
+		info.Duration = float64(streamer.Len()) / float64(format.SampleRate)
+	}
+
+	// Average bitrate over the whole file (tags included, which is close enough)
+	if info.Duration > 0 {
+		info.Bitrate = int64(float64(info.FileSize*8) / info.Duration / 1000)
+	}
+
+	return info, nil
+}
+
+// Opens a file with the decoder for its extension. Closing the streamer
+// closes the file
+func openDecoder(filePath string) (beep.StreamSeekCloser, beep.Format, string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, beep.Format{}, "", err
+	}
+
+	var streamer beep.StreamSeekCloser
+	var format beep.Format
+	var codec string
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".mp3":
+		streamer, format, err = mp3.Decode(f)
+		codec = "mp3"
+	case ".flac":
+		streamer, format, err = flac.Decode(f)
+		codec = "flac"
+	case ".wav":
+		streamer, format, err = wav.Decode(f)
+		codec = "wav"
+	case ".ogg":
+		streamer, format, err = vorbis.Decode(f)
+		codec = "vorbis"
+	default:
+		err = errors.New("unsupported_file_type")
+	}
+
+	if err != nil {
+		f.Close()
+		return nil, beep.Format{}, "", err
+	}
+
+	return streamer, format, codec, nil
+}
+
+// Decodes up to maxSeconds of a file (0 for all of it) into mono samples
+// at the given sample rate, e.g. for fingerprinting
+func ReadSamples(filePath string, sampleRate int, maxSeconds float64) ([]float64, error) {
+	streamer, format, _, err := openDecoder(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer streamer.Close()
+
+	var source beep.Streamer = streamer
+	if maxSeconds > 0 {
+		source = beep.Take(format.SampleRate.N(time.Duration(maxSeconds*float64(time.Second))), source)
+	}
+	if int(format.SampleRate) > sampleRate {
+		// Resample only interpolates, so anything above the new Nyquist
+		// frequency has to be removed first. The cutoff leaves room for the
+		// filter's roll-off
+		source = newLowPass(source, 0.4*float64(sampleRate), format.SampleRate)
+	}
+	if int(format.SampleRate) != sampleRate {
+		source = beep.Resample(4, format.SampleRate, beep.SampleRate(sampleRate), source)
+	}
+
+	var samples []float64
+	buf := make([][2]float64, 4096)
+	for {
+		n, ok := source.Stream(buf)
+		for _, frame := range buf[:n] {
+			samples = append(samples, (frame[0]+frame[1])/2)
+		}
+		if !ok {
+			break
+		}
+	}
+
+	return samples, streamer.Err()
+}
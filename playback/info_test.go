@@ -0,0 +1,100 @@
+package playback
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gopxl/beep"
+	"github.com/gopxl/beep/wav"
+)
+
+// Writes seconds of a sine tone to a 16 bit WAV file
+func writeToneWAV(t *testing.T, freq float64, sampleRate beep.SampleRate, seconds float64) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "tone.wav")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	n := sampleRate.N(time.Duration(seconds * float64(time.Second)))
+	i := 0
+	tone := beep.StreamerFunc(func(samples [][2]float64) (int, bool) {
+		if i >= n {
+			return 0, false
+		}
+		count := min(len(samples), n-i)
+		for j := range samples[:count] {
+			v := 0.5 * math.Sin(2*math.Pi*freq*float64(i+j)/float64(sampleRate))
+			samples[j] = [2]float64{v, v}
+		}
+		i += count
+		return count, true
+	})
+
+	format := beep.Format{SampleRate: sampleRate, NumChannels: 2, Precision: 2}
+	if err := wav.Encode(f, tone, format); err != nil {
+		t.Fatalf("failed to write wav: %v", err)
+	}
+	return path
+}
+
+func rms(samples []float64) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += s * s
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func TestReadSamplesFiltersAliases(t *testing.T) {
+	// Levels are relative to a tone that needs no resampling
+	reference, err := ReadSamples(writeToneWAV(t, 440, 11025, 2), 11025, 0)
+	if err != nil {
+		t.Fatalf("failed to read samples: %v", err)
+	}
+	level := rms(reference)
+
+	tests := []struct {
+		freq             float64
+		minGain, maxGain float64
+		comment          string
+	}{
+		{440, 0.95, 1.05, "a tone well below the cutoff passes"},
+		{2000, 0.95, 1.05, "a tone in the fingerprinted range passes"},
+		// Without filtering 8 kHz would alias to 3025 Hz at full strength
+		{8000, 0, 0.03, "a tone above the new Nyquist frequency is removed"},
+	}
+
+	for _, test := range tests {
+		samples, err := ReadSamples(writeToneWAV(t, test.freq, 44100, 2), 11025, 0)
+		if err != nil {
+			t.Fatalf("failed to read samples: %v", err)
+		}
+		if len(samples) < 11025*19/10 || len(samples) > 11025*21/10 {
+			t.Errorf("read %d samples of 2s at 11025 Hz", len(samples))
+		}
+
+		// Skip the filter's start-up
+		if gain := rms(samples[1000:]) / level; gain < test.minGain || gain > test.maxGain {
+			t.Errorf("%s: %g Hz has gain %g, want %g-%g", test.comment, test.freq, gain, test.minGain, test.maxGain)
+		}
+	}
+}
+
+func TestReadSamplesLimitsLength(t *testing.T) {
+	path := writeToneWAV(t, 440, 11025, 3)
+
+	samples, err := ReadSamples(path, 11025, 1)
+	if err != nil {
+		t.Fatalf("failed to read samples: %v", err)
+	}
+	if len(samples) != 11025 {
+		t.Errorf("read %d samples, want 11025", len(samples))
+	}
+}
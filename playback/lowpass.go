@@ -0,0 +1,72 @@
+package playback
+
+import (
+	"math"
+
+	"github.com/gopxl/beep"
+)
+
+// Q factors of the biquads making up an 8th order Butterworth filter
+var butterworthQ = []float64{0.50980, 0.60134, 0.89998, 2.56292}
+
+// One second order section, in transposed direct form II with separate
+// state per channel
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             [2]float64
+}
+
+func newLowPassBiquad(cutoff float64, sampleRate float64, q float64) *biquad {
+	w0 := 2 * math.Pi * cutoff / sampleRate
+	alpha := math.Sin(w0) / (2 * q)
+	cos := math.Cos(w0)
+	a0 := 1 + alpha
+
+	return &biquad{
+		b0: (1 - cos) / 2 / a0,
+		b1: (1 - cos) / a0,
+		b2: (1 - cos) / 2 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+func (f *biquad) process(x float64, c int) float64 {
+	y := f.b0*x + f.z1[c]
+	f.z1[c] = f.b1*x - f.a1*y + f.z2[c]
+	f.z2[c] = f.b2*x - f.a2*y
+	return y
+}
+
+// Filters out frequencies above a cutoff, so downsampling doesn't fold them
+// back into the audible range as aliases
+type lowPass struct {
+	source beep.Streamer
+	stages []*biquad
+}
+
+func newLowPass(source beep.Streamer, cutoff float64, sampleRate beep.SampleRate) *lowPass {
+	f := &lowPass{source: source}
+	for _, q := range butterworthQ {
+		f.stages = append(f.stages, newLowPassBiquad(cutoff, float64(sampleRate), q))
+	}
+	return f
+}
+
+func (f *lowPass) Stream(samples [][2]float64) (int, bool) {
+	n, ok := f.source.Stream(samples)
+	for i := range samples[:n] {
+		for c := range 2 {
+			x := samples[i][c]
+			for _, stage := range f.stages {
+				x = stage.process(x, c)
+			}
+			samples[i][c] = x
+		}
+	}
+	return n, ok
+}
+
+func (f *lowPass) Err() error {
+	return f.source.Err()
+}
@@ -2,18 +2,49 @@ package playback
 
 import (
 	"encoding/base64"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/dhowden/tag"
 )
 
+// Reads a file's tags, with the front cover as a data: URI under "albumArt"
 func ReadMetadata(file *os.File) map[string]string {
+	metadata, pics := ReadTags(file)
+
+	if pic := FrontCover(pics); pic != nil {
+		metadata["albumArt"] = fmt.Sprintf(
+			"data:%s;base64,%s",
+			pic.MIMEType,
+			base64.StdEncoding.EncodeToString(pic.Data),
+		)
+	}
+
+	return metadata
+}
+
+// Reads a file's tags and all of its embedded pictures
+func ReadTags(file *os.File) (map[string]string, []Picture) {
 	metadata := make(map[string]string)
 
-	tags, err := tag.ReadFrom(file)
+	// WAV files keep their ID3 tag in a chunk
+	var r io.ReadSeeker = file
+	if chunk := wavID3Chunk(file); chunk != nil {
+		r = chunk
+	}
+
+	tags, err := tag.ReadFrom(r)
 	if err != nil {
+		// WAV files without an ID3 chunk may still have a LIST INFO chunk
+		if info := wavInfo(file); info != nil {
+			return info, nil
+		}
+
 		metadata["title"] = filepath.Base(file.Name())
 		metadata["artist"] = ""
 		metadata["album"] = ""
@@ -22,7 +53,11 @@ func ReadMetadata(file *os.File) map[string]string {
 		metadata["comment"] = ""
 		metadata["genre"] = ""
 		metadata["year"] = ""
-		return metadata
+		metadata["track"] = ""
+		metadata["tracktotal"] = ""
+		metadata["disc"] = ""
+		metadata["disctotal"] = ""
+		return metadata, nil
 	}
 
 	title := tags.Title()
@@ -38,13 +73,114 @@ func ReadMetadata(file *os.File) map[string]string {
 	metadata["genre"] = tags.Genre()
 	metadata["year"] = fmt.Sprintf("%d", tags.Year())
 
-	if pic := tags.Picture(); pic != nil {
-		metadata["albumArt"] = fmt.Sprintf(
-			"data:%s;base64,%s",
-			pic.MIMEType,
-			base64.StdEncoding.EncodeToString(pic.Data),
-		)
+	track, trackTotal := tags.Track()
+	metadata["track"] = fmt.Sprintf("%d", track)
+	metadata["tracktotal"] = fmt.Sprintf("%d", trackTotal)
+
+	disc, discTotal := tags.Disc()
+	metadata["disc"] = fmt.Sprintf("%d", disc)
+	metadata["disctotal"] = fmt.Sprintf("%d", discTotal)
+
+	return metadata, readPictures(r, tags)
+}
+
+// Finds the ID3 chunk of a WAV file, nil if it isn't a WAV file or has none
+func wavID3Chunk(file *os.File) *io.SectionReader {
+	return wavChunk(file, func(id string, chunk *io.SectionReader) bool {
+		return id == "id3 " || id == "ID3 "
+	})
+}
+
+// RIFF INFO items, by the metadata key they're read into
+var riffInfoKeys = map[string]string{
+	"INAM": "title",
+	"IART": "artist",
+	"IPRD": "album",
+	"IGNR": "genre",
+	"ICRD": "year",
+	"ICMT": "comment",
+	"ITRK": "track",
+}
+
+// Reads the tags in a WAV file's LIST INFO chunk, nil if it isn't a WAV
+// file or has none
+func wavInfo(file *os.File) map[string]string {
+	chunk := wavChunk(file, func(id string, chunk *io.SectionReader) bool {
+		var kind [4]byte
+		_, err := chunk.ReadAt(kind[:], 0)
+		return id == "LIST" && err == nil && string(kind[:]) == "INFO"
+	})
+	if chunk == nil {
+		return nil
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(chunk, 4, chunk.Size()-4))
+	if err != nil {
+		return nil
+	}
+
+	metadata := map[string]string{"title": filepath.Base(file.Name())}
+	for _, key := range []string{"artist", "album", "albumartist", "composer", "comment", "genre"} {
+		metadata[key] = ""
+	}
+	for _, key := range []string{"year", "track", "tracktotal", "disc", "disctotal"} {
+		metadata[key] = "0"
+	}
+
+	for len(data) >= 8 {
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		if size > len(data)-8 {
+			break
+		}
+
+		value := strings.TrimSpace(strings.TrimRight(string(data[8:8+size]), "\x00"))
+		if key, ok := riffInfoKeys[string(data[:4])]; ok && value != "" {
+			metadata[key] = value
+		}
+		data = data[min(8+size+size%2, len(data)):]
+	}
+
+	// Dates may be full dates, and track numbers may carry a total
+	if year, _, _ := strings.Cut(metadata["year"], "-"); year != "" {
+		metadata["year"] = strconv.Itoa(atoi(year))
+	}
+	track, total, _ := strings.Cut(metadata["track"], "/")
+	metadata["track"] = strconv.Itoa(atoi(track))
+	if total != "" {
+		metadata["tracktotal"] = strconv.Itoa(atoi(total))
 	}
 
 	return metadata
 }
+
+// Parses a number, 0 if it isn't one
+func atoi(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
+
+// Finds the first chunk of a WAV file that want accepts, nil if it isn't a
+// WAV file or has none
+func wavChunk(file *os.File, want func(id string, chunk *io.SectionReader) bool) *io.SectionReader {
+	var header [12]byte
+	if _, err := file.ReadAt(header[:], 0); err != nil {
+		return nil
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil
+	}
+
+	for offset := int64(12); ; {
+		var chunk [8]byte
+		if _, err := file.ReadAt(chunk[:], offset); err != nil {
+			return nil
+		}
+
+		size := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		section := io.NewSectionReader(file, offset+8, size)
+		if want(string(chunk[:4]), section) {
+			return section
+		}
+		offset += 8 + size + size%2
+	}
+}
@@ -0,0 +1,196 @@
+package playback
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/dhowden/tag"
+)
+
+// Kinds of picture a file (or folder) can hold
+const (
+	PictureFront  = "front"
+	PictureBack   = "back"
+	PictureArtist = "artist"
+	PictureMedia  = "media"
+	PictureOther  = "other"
+)
+
+// A picture embedded in an audio file
+type Picture struct {
+	Kind     string
+	MIMEType string
+	Data     []byte
+}
+
+// Picture kinds by the ID3v2/FLAC picture type code
+var pictureKindCodes = map[uint32]string{
+	3:  PictureFront,
+	4:  PictureBack,
+	6:  PictureMedia,
+	7:  PictureArtist, // lead artist
+	8:  PictureArtist, // artist/performer
+	10: PictureArtist, // band/orchestra
+}
+
+// Picture kinds by the type description github.com/dhowden/tag gives
+var pictureKindNames = map[string]string{
+	"Cover (front)":                      PictureFront,
+	"Cover (back)":                       PictureBack,
+	"Media (e.g. lable side of CD)":      PictureMedia,
+	"Lead artist/lead performer/soloist": PictureArtist,
+	"Artist/performer":                   PictureArtist,
+	"Band/Orchestra":                     PictureArtist,
+}
+
+// Gets every picture from a file's tags, in the order they're stored. The
+// tag library only keeps the last picture in FLAC files, so those are read
+// separately
+func readPictures(r io.ReadSeeker, tags tag.Metadata) []Picture {
+	if tags.FileType() == tag.FLAC {
+		if _, err := r.Seek(0, io.SeekStart); err == nil {
+			if pics, err := readFLACPictures(r); err == nil {
+				return pics
+			}
+		}
+	}
+
+	// ID3 keeps each picture frame under its own key (APIC, APIC_1, ...)
+	raw := tags.Raw()
+	keys := make([]string, 0, len(raw))
+	for key, value := range raw {
+		if _, ok := value.(*tag.Picture); ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var pics []Picture
+	for _, key := range keys {
+		pics = append(pics, fromTagPicture(raw[key].(*tag.Picture)))
+	}
+
+	if len(pics) == 0 {
+		if pic := tags.Picture(); pic != nil {
+			pics = append(pics, fromTagPicture(pic))
+		}
+	}
+
+	return pics
+}
+
+// Converts a picture read by github.com/dhowden/tag
+func fromTagPicture(pic *tag.Picture) Picture {
+	kind, ok := pictureKindNames[pic.Type]
+	if !ok {
+		kind = PictureOther
+	}
+
+	return Picture{Kind: kind, MIMEType: pic.MIMEType, Data: pic.Data}
+}
+
+// Reads every PICTURE metadata block from a FLAC file
+func readFLACPictures(r io.Reader) ([]Picture, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return nil, err
+	}
+	if string(magic[:]) != "fLaC" {
+		return nil, errors.New("not a FLAC file")
+	}
+
+	var pics []Picture
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		length := int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3])
+
+		block := &io.LimitedReader{R: r, N: length}
+		if blockType == 6 {
+			pic, err := readFLACPicture(block)
+			if err != nil {
+				return nil, err
+			}
+			pics = append(pics, pic)
+		}
+
+		// Skip whatever's left of the block
+		if _, err := io.Copy(io.Discard, block); err != nil {
+			return nil, err
+		}
+
+		if last {
+			return pics, nil
+		}
+	}
+}
+
+// Reads a FLAC PICTURE block
+func readFLACPicture(r *io.LimitedReader) (Picture, error) {
+	var pic Picture
+
+	readUint := func() (uint32, error) {
+		var n uint32
+		err := binary.Read(r, binary.BigEndian, &n)
+		return n, err
+	}
+	readBytes := func() ([]byte, error) {
+		n, err := readUint()
+		if err != nil {
+			return nil, err
+		}
+		// Don't trust a length that runs past the end of the block
+		if int64(n) > r.N {
+			return nil, errors.New("invalid FLAC picture block")
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return b, err
+	}
+
+	code, err := readUint()
+	if err != nil {
+		return pic, err
+	}
+	pic.Kind = pictureKindCodes[code]
+	if pic.Kind == "" {
+		pic.Kind = PictureOther
+	}
+
+	mime, err := readBytes()
+	if err != nil {
+		return pic, err
+	}
+	pic.MIMEType = string(mime)
+
+	// Description, then width, height, color depth and color count
+	if _, err := readBytes(); err != nil {
+		return pic, err
+	}
+	if _, err := io.CopyN(io.Discard, r, 16); err != nil {
+		return pic, err
+	}
+
+	pic.Data, err = readBytes()
+	return pic, err
+}
+
+// Picks the picture to use as the front cover: one marked as the front, or
+// else the first one that isn't marked as anything else
+func FrontCover(pics []Picture) *Picture {
+	for _, kind := range []string{PictureFront, PictureOther} {
+		for i := range pics {
+			if pics[i].Kind == kind {
+				return &pics[i]
+			}
+		}
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gopxl/beep"
@@ -25,7 +26,9 @@ type Player struct {
 	filePath  string
 	format    beep.Format
 	metadata  map[string]string
+	metaMu    sync.RWMutex
 	streamer  beep.StreamSeekCloser
+	isStream  bool
 }
 
 func NewPlayer() *Player {
@@ -33,6 +36,10 @@ func NewPlayer() *Player {
 }
 
 func (p *Player) Play(filePath string, speed float64) error {
+	if IsStreamURL(filePath) {
+		return p.PlayStream([]string{filePath}, speed)
+	}
+
 	f, err := os.Open(filePath)
 	if err != nil {
 		return err
@@ -52,11 +59,13 @@ func (p *Player) Play(filePath string, speed float64) error {
 	p.volume = nil
 	p.resampler = nil
 	p.filePath = ""
-	p.metadata = nil
+	p.isStream = false
 
 	// Read metadata
 	metadata := ReadMetadata(f)
+	p.metaMu.Lock()
 	p.metadata = metadata
+	p.metaMu.Unlock()
 
 	// Reset file pointer
 	_, err = f.Seek(0, io.SeekStart)
@@ -86,6 +95,122 @@ func (p *Player) Play(filePath string, speed float64) error {
 	if err != nil {
 		return err
 	}
+
+	p.start(streamer, format, filePath, speed)
+
+	return nil
+}
+
+// Plays an HTTP(S) stream, such as an Icecast/Shoutcast station or a remote file.
+// Each URL is tried in order, with the later ones used as fallbacks if the stream drops
+func (p *Player) PlayStream(urls []string, speed float64) error {
+	if len(urls) == 0 {
+		return errors.New("no stream urls")
+	}
+
+	// Close previous streamer if exists
+	if p.streamer != nil {
+		p.streamer.Close()
+		p.streamer = nil
+	}
+
+	// Stop any current playback
+	speaker.Clear()
+
+	// Reset structures
+	p.ctrl = nil
+	p.volume = nil
+	p.resampler = nil
+	p.filePath = ""
+	p.isStream = true
+
+	p.metaMu.Lock()
+	p.metadata = map[string]string{"title": urls[0]}
+	p.metaMu.Unlock()
+
+	source, err := openStreamSource(urls, p.updateMetadata)
+	if err != nil {
+		return err
+	}
+
+	url := source.currentURL()
+	if source.isSeekableFile() {
+		source.Close()
+		return p.playRemoteFile(url, source.length, source.codec, speed)
+	}
+
+	buffered := newBufferedStream(source)
+
+	var streamer beep.StreamSeekCloser
+	var format beep.Format
+
+	switch source.codec {
+	case ".mp3":
+		streamer, format, err = mp3.Decode(buffered)
+	case ".flac":
+		streamer, format, err = flac.Decode(buffered)
+	case ".wav":
+		streamer, format, err = wav.Decode(buffered)
+	case ".ogg":
+		streamer, format, err = vorbis.Decode(buffered)
+	}
+
+	if err != nil {
+		buffered.Close()
+		return err
+	}
+
+	p.start(streamer, format, url, speed)
+
+	return nil
+}
+
+// Plays a finite remote file through range requests, so unlike a stream it
+// has a duration, can be seeked and completes on its own
+func (p *Player) playRemoteFile(url string, size int64, ext string, speed float64) error {
+	file := newRemoteFile(url, size)
+
+	var streamer beep.StreamSeekCloser
+	var format beep.Format
+	var err error
+
+	switch ext {
+	case ".mp3":
+		streamer, format, err = mp3.Decode(file)
+	case ".flac":
+		streamer, format, err = flac.Decode(file)
+	case ".wav":
+		streamer, format, err = wav.Decode(file)
+	case ".ogg":
+		streamer, format, err = vorbis.Decode(file)
+	}
+
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	p.isStream = false
+	p.start(streamer, format, url, speed)
+
+	return nil
+}
+
+// Merges new values (e.g. ICY stream titles) into the current metadata
+func (p *Player) updateMetadata(info map[string]string) {
+	p.metaMu.Lock()
+	defer p.metaMu.Unlock()
+
+	if p.metadata == nil {
+		p.metadata = make(map[string]string)
+	}
+	for k, v := range info {
+		p.metadata[k] = v
+	}
+}
+
+// Sets up the control/resampler/volume chain for a decoded streamer and starts playing it
+func (p *Player) start(streamer beep.StreamSeekCloser, format beep.Format, filePath string, speed float64) {
 	p.streamer = streamer
 
 	p.ctrl = &beep.Ctrl{Streamer: streamer, Paused: false}
@@ -107,8 +232,6 @@ func (p *Player) Play(filePath string, speed float64) error {
 
 	speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/10))
 	speaker.Play(p.volume)
-
-	return nil
 }
 
 func (p *Player) Pause() {
@@ -142,7 +265,7 @@ func (p *Player) SetVolume(vol float64) {
 }
 
 func (p *Player) Seek(seconds float64) error {
-	if p.streamer == nil {
+	if p.streamer == nil || p.isStream {
 		return errors.New("seeking not supported")
 	}
 
@@ -174,6 +297,11 @@ func (p *Player) GetDuration() (float64, error) {
 		return 0, errors.New("no active stream")
 	}
 
+	// Streams have no known length
+	if p.isStream {
+		return 0, nil
+	}
+
 	speaker.Lock()
 	defer speaker.Unlock()
 	return float64(p.streamer.Len()) / float64(p.format.SampleRate), nil
@@ -184,7 +312,23 @@ func (p *Player) GetFilePath() string {
 }
 
 func (p *Player) GetMetadata() map[string]string {
-	return p.metadata
+	p.metaMu.RLock()
+	defer p.metaMu.RUnlock()
+
+	if p.metadata == nil {
+		return nil
+	}
+
+	metadata := make(map[string]string, len(p.metadata))
+	for k, v := range p.metadata {
+		metadata[k] = v
+	}
+	return metadata
+}
+
+// Returns true if the player is currently playing a remote stream
+func (p *Player) IsStream() bool {
+	return p.isStream
 }
 
 func (p *Player) StopPlayback() {
@@ -201,5 +345,9 @@ func (p *Player) StopPlayback() {
 	p.ctrl = nil
 	p.volume = nil
 	p.filePath = ""
+	p.isStream = false
+
+	p.metaMu.Lock()
 	p.metadata = nil
+	p.metaMu.Unlock()
 }
@@ -0,0 +1,127 @@
+package playback
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Forward seeks up to this many bytes read through the open response rather
+// than making a new request. Decoders that index a file on open (like MP3)
+// skip ahead a frame at a time, which would otherwise be a request per frame
+const remoteSkipLimit = 256 << 10
+
+// A finite remote file read through HTTP Range requests, so it can be decoded
+// and seeked like a local file
+type remoteFile struct {
+	url    string
+	size   int64
+	offset int64
+
+	// The open response and the offset its next byte is at
+	body   io.ReadCloser
+	bodyAt int64
+}
+
+func newRemoteFile(url string, size int64) *remoteFile {
+	return &remoteFile{url: url, size: size}
+}
+
+// Requests the rest of the file from the current offset
+func (f *remoteFile) request() error {
+	req, err := http.NewRequest(http.MethodGet, f.url, nil)
+	if err != nil {
+		return fmt.Errorf("invalid remote file url: %w", err)
+	}
+	req.Header.Set("User-Agent", "OpenTurntable")
+	if f.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", f.offset))
+	}
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to remote file: %w", err)
+	}
+
+	want := http.StatusOK
+	if f.offset > 0 {
+		want = http.StatusPartialContent
+	}
+	if resp.StatusCode != want {
+		resp.Body.Close()
+		return fmt.Errorf("remote file returned status %s", resp.Status)
+	}
+
+	f.body = resp.Body
+	f.bodyAt = f.offset
+	return nil
+}
+
+func (f *remoteFile) closeBody() {
+	if f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+}
+
+func (f *remoteFile) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+
+	// Catch the open response up to a short seek ahead, or drop it
+	if f.body != nil && f.bodyAt != f.offset {
+		gap := f.offset - f.bodyAt
+		if gap < 0 || gap > remoteSkipLimit {
+			f.closeBody()
+		} else if _, err := io.CopyN(io.Discard, f.body, gap); err != nil {
+			f.closeBody()
+		} else {
+			f.bodyAt = f.offset
+		}
+	}
+
+	if f.body == nil {
+		if err := f.request(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	f.bodyAt = f.offset
+
+	// A response that ends early is picked up again on the next read
+	if err == io.EOF && f.offset < f.size {
+		f.closeBody()
+		if n == 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	return n, err
+}
+
+func (f *remoteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *remoteFile) Close() error {
+	f.closeBody()
+	return nil
+}
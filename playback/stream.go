@@ -0,0 +1,527 @@
+package playback
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"openturntable/playlists"
+)
+
+const (
+	// Size of each chunk read ahead from a remote stream
+	streamChunkSize = 16 * 1024
+
+	// Number of chunks buffered ahead of the decoder (~1MB)
+	streamBufferChunks = 64
+
+	// Largest playlist document read when resolving a station link
+	maxPlaylistSize = 1024 * 1024
+
+	// How many times a dropped stream is reconnected before giving up
+	streamMaxRetries = 5
+)
+
+// Base wait between reconnection attempts, growing with each retry
+var streamRetryDelay = time.Second
+
+// HTTP client used for remote streams. No overall timeout is set since
+// radio streams never end, only the wait for response headers is bounded
+var streamClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: 15 * time.Second,
+	},
+}
+
+// Returns true if the path points to an HTTP(S) stream instead of a local file
+func IsStreamURL(filePath string) bool {
+	lower := strings.ToLower(filePath)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// Reader over an HTTP audio stream. Strips ICY metadata blocks from the audio
+// data and transparently reconnects when the connection drops, failing over
+// to the next URL if the current one stops working
+type httpStream struct {
+	urls        []string
+	current     int
+	onMetadata  func(map[string]string)
+	contentType string
+
+	// Decoder extension picked from the first response. Fallback URLs
+	// serving anything else can't be played by the same decoder
+	codec string
+
+	mu     sync.Mutex
+	body   io.ReadCloser
+	closed bool
+
+	// ICY metadata interval (0 if the server doesn't send metadata)
+	metaInt   int
+	untilMeta int
+
+	// Bytes of audio read so far and whether the server accepts ranges,
+	// used to resume plain remote files where they left off
+	offset       int64
+	acceptRanges bool
+	length       int64
+}
+
+// Opens a connection to the first working URL of an HTTP stream. onMetadata
+// is called with station info once connected and again whenever the stream
+// title changes
+func openHTTPStream(urls []string, onMetadata func(map[string]string)) (*httpStream, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no stream urls")
+	}
+
+	s := &httpStream{
+		urls:       urls,
+		onMetadata: onMetadata,
+		length:     -1,
+	}
+
+	var err error
+	for s.current = range urls {
+		if err = s.connect(); err == nil {
+			return s, nil
+		}
+	}
+
+	return nil, err
+}
+
+// Opens a stream, resolving it first if the URL points at an M3U/PLS
+// playlist rather than at audio
+func openStreamSource(urls []string, onMetadata func(map[string]string)) (*httpStream, error) {
+	s, err := openHTTPStream(urls, onMetadata)
+	if err != nil {
+		return nil, err
+	}
+
+	format := playlists.DetectFormat(s.contentType, s.currentURL())
+	if format == "" {
+		return s, nil
+	}
+
+	// Playlists are fetched again as plain documents. Read through the
+	// stream, one sent without a length would look like a dropped radio
+	// connection when it ends
+	url := s.currentURL()
+	remaining := urls[s.current+1:]
+	s.Close()
+
+	entries, err := ResolveStreamURLs(url)
+	if err != nil {
+		return nil, err
+	}
+
+	// The playlist's streams come first, then the other fallbacks
+	return openHTTPStream(append(entries, remaining...), onMetadata)
+}
+
+// Reads the stream URLs out of a playlist document
+func readStreamPlaylist(format string, r io.Reader) ([]string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxPlaylistSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stream playlist: %w", err)
+	}
+
+	entries, err := playlists.Parse(format, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stream playlist: %w", err)
+	}
+
+	var urls []string
+	for _, entry := range entries {
+		if IsStreamURL(entry.Location) {
+			urls = append(urls, entry.Location)
+		}
+	}
+
+	if len(urls) == 0 {
+		return nil, errors.New("stream playlist has no playable entries")
+	}
+
+	return urls, nil
+}
+
+// Returns every stream URL a station link points to. Playlist links (.pls,
+// .m3u) expand to all of their entries, direct stream links are returned as-is
+func ResolveStreamURLs(url string) ([]string, error) {
+	if !IsStreamURL(url) {
+		return nil, fmt.Errorf("not a stream url: %s", url)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream url: %w", err)
+	}
+	req.Header.Set("User-Agent", "OpenTurntable")
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to stream: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("stream returned status %s", resp.Status)
+	}
+
+	format := playlists.DetectFormat(resp.Header.Get("Content-Type"), url)
+	if format == "" {
+		return []string{url}, nil
+	}
+
+	return readStreamPlaylist(format, resp.Body)
+}
+
+// The URL currently being streamed from
+func (s *httpStream) currentURL() string {
+	return s.urls[s.current]
+}
+
+// Performs the HTTP request, resuming from the current offset if possible
+func (s *httpStream) connect() error {
+	req, err := http.NewRequest(http.MethodGet, s.currentURL(), nil)
+	if err != nil {
+		return fmt.Errorf("invalid stream url: %w", err)
+	}
+	req.Header.Set("User-Agent", "OpenTurntable")
+	req.Header.Set("Icy-MetaData", "1")
+	if s.offset > 0 && s.acceptRanges {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", s.offset))
+	}
+
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to connect to stream: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return fmt.Errorf("stream returned status %s", resp.Status)
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		resp.Body.Close()
+		return errors.New("stream closed")
+	}
+	s.body = resp.Body
+	s.mu.Unlock()
+
+	// Only take the content type/length from the first response. Later
+	// ones have to carry the same codec, the decoder is already running
+	contentType := resp.Header.Get("Content-Type")
+	if s.codec == "" {
+		s.contentType = contentType
+		s.codec = streamFormat(contentType, s.currentURL())
+		s.acceptRanges = resp.Header.Get("Accept-Ranges") == "bytes"
+		s.length = resp.ContentLength
+	} else if codec := streamFormat(contentType, s.currentURL()); codec != s.codec {
+		s.closeBody()
+		return fmt.Errorf("stream %s is %s, not %s", s.currentURL(), codec, s.codec)
+	}
+
+	// Skip whatever we already have if the server ignored the range request
+	if s.offset > 0 && resp.StatusCode == http.StatusOK {
+		if _, err := io.CopyN(io.Discard, resp.Body, s.offset); err != nil {
+			s.closeBody()
+			return fmt.Errorf("failed to resume stream: %w", err)
+		}
+	}
+
+	s.metaInt = 0
+	if metaInt, err := strconv.Atoi(resp.Header.Get("Icy-Metaint")); err == nil && metaInt > 0 {
+		s.metaInt = metaInt
+		s.untilMeta = metaInt
+	}
+
+	if s.onMetadata != nil {
+		info := make(map[string]string)
+		if name := resp.Header.Get("Icy-Name"); name != "" {
+			info["album"] = name
+		}
+		if genre := resp.Header.Get("Icy-Genre"); genre != "" {
+			info["genre"] = genre
+		}
+		if desc := resp.Header.Get("Icy-Description"); desc != "" {
+			info["comment"] = desc
+		}
+		if len(info) > 0 {
+			s.onMetadata(info)
+		}
+	}
+
+	return nil
+}
+
+// Whether the stream is a live radio stream rather than a plain remote file
+func (s *httpStream) isLive() bool {
+	return s.metaInt > 0 || s.length < 0
+}
+
+// Whether the stream is a plain remote file of known length that the server
+// serves in ranges, so it can be played and seeked like a local file
+func (s *httpStream) isSeekableFile() bool {
+	return !s.isLive() && s.length > 0 && s.acceptRanges
+}
+
+func (s *httpStream) Read(p []byte) (int, error) {
+	for retries := 0; ; {
+		n, err := s.readAudio(p)
+		if err == nil || (err == io.EOF && !s.isLive()) {
+			return n, err
+		}
+
+		s.mu.Lock()
+		closed := s.closed
+		s.body.Close()
+		s.mu.Unlock()
+		if closed {
+			return n, io.EOF
+		}
+
+		// Hand back what we have before reconnecting
+		if n > 0 {
+			return n, nil
+		}
+
+		// Connection dropped, try to reconnect with a small backoff. The
+		// first attempt reuses the same URL, after that move through the
+		// fallbacks
+		for {
+			retries++
+			if retries > streamMaxRetries*len(s.urls) {
+				return 0, fmt.Errorf("stream dropped: %w", err)
+			}
+			time.Sleep(time.Duration((retries-1)%streamMaxRetries+1) * streamRetryDelay)
+			if cerr := s.connect(); cerr == nil {
+				break
+			}
+			if len(s.urls) > 1 {
+				s.failover()
+			}
+		}
+	}
+}
+
+// Reads audio data from the current connection, consuming metadata blocks
+func (s *httpStream) readAudio(p []byte) (int, error) {
+	if s.metaInt > 0 {
+		if s.untilMeta == 0 {
+			if err := s.readMetadataBlock(); err != nil {
+				return 0, err
+			}
+			s.untilMeta = s.metaInt
+		}
+		if len(p) > s.untilMeta {
+			p = p[:s.untilMeta]
+		}
+	}
+
+	n, err := s.body.Read(p)
+	s.offset += int64(n)
+	if s.metaInt > 0 {
+		s.untilMeta -= n
+	}
+
+	return n, err
+}
+
+// Reads one ICY metadata block (length byte * 16 bytes of text)
+func (s *httpStream) readMetadataBlock() error {
+	var lengthByte [1]byte
+	if _, err := io.ReadFull(s.body, lengthByte[:]); err != nil {
+		return err
+	}
+
+	length := int(lengthByte[0]) * 16
+	if length == 0 {
+		return nil
+	}
+
+	block := make([]byte, length)
+	if _, err := io.ReadFull(s.body, block); err != nil {
+		return err
+	}
+
+	if s.onMetadata != nil {
+		if info := parseICYMetadata(string(block)); len(info) > 0 {
+			s.onMetadata(info)
+		}
+	}
+
+	return nil
+}
+
+// Moves on to the next fallback URL. Progress is only kept for plain
+// remote files, a different live URL starts from scratch. connect refuses
+// a fallback whose codec doesn't match, so the decoder keeps working
+func (s *httpStream) failover() {
+	s.current = (s.current + 1) % len(s.urls)
+	if s.isLive() {
+		s.offset = 0
+	}
+}
+
+// Closes the current response, e.g. one that turned out to be unusable
+func (s *httpStream) closeBody() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.body != nil {
+		s.body.Close()
+	}
+}
+
+func (s *httpStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.body != nil {
+		return s.body.Close()
+	}
+	return nil
+}
+
+// Parses an ICY metadata block such as "StreamTitle='Artist - Title';"
+// into the same keys ReadMetadata uses
+func parseICYMetadata(block string) map[string]string {
+	info := make(map[string]string)
+	block = strings.TrimRight(block, "\x00")
+
+	for block != "" {
+		eq := strings.Index(block, "='")
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(block[:eq])
+		rest := block[eq+2:]
+
+		end := strings.Index(rest, "';")
+		if end < 0 {
+			end = strings.LastIndex(rest, "'")
+			if end < 0 {
+				end = len(rest)
+			}
+		}
+		value := rest[:end]
+
+		if key == "StreamTitle" && value != "" {
+			if artist, title, ok := strings.Cut(value, " - "); ok {
+				info["artist"] = strings.TrimSpace(artist)
+				info["title"] = strings.TrimSpace(title)
+			} else {
+				info["title"] = strings.TrimSpace(value)
+			}
+		}
+
+		if end+2 > len(rest) {
+			break
+		}
+		block = rest[end+2:]
+	}
+
+	return info
+}
+
+// Reads ahead from a source in a background goroutine so short network
+// hiccups don't starve the decoder
+type bufferedStream struct {
+	src    io.ReadCloser
+	chunks chan []byte
+	done   chan struct{}
+	cur    []byte
+	err    error
+	once   sync.Once
+}
+
+func newBufferedStream(src io.ReadCloser) *bufferedStream {
+	b := &bufferedStream{
+		src:    src,
+		chunks: make(chan []byte, streamBufferChunks),
+		done:   make(chan struct{}),
+	}
+	go b.fill()
+	return b
+}
+
+func (b *bufferedStream) fill() {
+	defer close(b.chunks)
+
+	for {
+		buf := make([]byte, streamChunkSize)
+		n, err := b.src.Read(buf)
+		if n > 0 {
+			select {
+			case b.chunks <- buf[:n]:
+			case <-b.done:
+				return
+			}
+		}
+		if err != nil {
+			b.err = err
+			return
+		}
+	}
+}
+
+func (b *bufferedStream) Read(p []byte) (int, error) {
+	if len(b.cur) == 0 {
+		chunk, ok := <-b.chunks
+		if !ok {
+			return 0, b.err
+		}
+		b.cur = chunk
+	}
+
+	n := copy(p, b.cur)
+	b.cur = b.cur[n:]
+	return n, nil
+}
+
+func (b *bufferedStream) Close() error {
+	var err error
+	b.once.Do(func() {
+		close(b.done)
+		err = b.src.Close()
+	})
+	return err
+}
+
+// Works out which decoder to use for a stream from its content type,
+// falling back to the URL's extension and finally MP3
+func streamFormat(contentType string, url string) string {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	switch strings.TrimSpace(mediaType) {
+	case "audio/mpeg", "audio/mp3", "audio/x-mpeg":
+		return ".mp3"
+	case "audio/ogg", "application/ogg", "audio/vorbis", "audio/x-ogg":
+		return ".ogg"
+	case "audio/flac", "audio/x-flac":
+		return ".flac"
+	case "audio/wav", "audio/x-wav", "audio/wave":
+		return ".wav"
+	}
+
+	urlPath, _, _ := strings.Cut(url, "?")
+	switch ext := strings.ToLower(path.Ext(urlPath)); ext {
+	case ".mp3", ".ogg", ".flac", ".wav":
+		return ext
+	}
+
+	return ".mp3"
+}
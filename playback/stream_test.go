@@ -0,0 +1,463 @@
+package playback
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Makes stand-in audio data
+func testStreamData(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(data)
+	return data
+}
+
+// Builds an ICY metadata block: a length byte, then text padded to a
+// multiple of 16
+func icyBlock(text string) []byte {
+	n := (len(text) + 15) / 16
+	block := append([]byte{byte(n)}, text...)
+	return append(block, make([]byte, n*16-len(text))...)
+}
+
+// Collects metadata updates from a stream
+type metadataRecorder struct {
+	mu      sync.Mutex
+	updates []map[string]string
+}
+
+func (m *metadataRecorder) record(info map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.updates = append(m.updates, info)
+}
+
+// Lists the updates with a title, as "artist - title"
+func (m *metadataRecorder) titles() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var titles []string
+	for _, info := range m.updates {
+		if title, ok := info["title"]; ok {
+			titles = append(titles, info["artist"]+" - "+title)
+		}
+	}
+	return titles
+}
+
+func TestParseICYMetadata(t *testing.T) {
+	tests := []struct {
+		block string
+		want  map[string]string
+	}{
+		{"StreamTitle='Artist - Title';StreamUrl='';\x00\x00", map[string]string{"artist": "Artist", "title": "Title"}},
+		{"StreamTitle='Just a title';", map[string]string{"title": "Just a title"}},
+		{"StreamTitle='It's - Apostrophes';", map[string]string{"artist": "It's", "title": "Apostrophes"}},
+		{"StreamTitle='Unterminated", map[string]string{"title": "Unterminated"}},
+		{"StreamTitle='';", map[string]string{}},
+		{"garbage", map[string]string{}},
+	}
+
+	for _, test := range tests {
+		got := parseICYMetadata(test.block)
+		if len(got) != len(test.want) {
+			t.Errorf("parseICYMetadata(%q) = %v, want %v", test.block, got, test.want)
+			continue
+		}
+		for key, value := range test.want {
+			if got[key] != value {
+				t.Errorf("parseICYMetadata(%q)[%q] = %q, want %q", test.block, key, got[key], value)
+			}
+		}
+	}
+}
+
+func TestStreamICYInterleaving(t *testing.T) {
+	const metaInt = 100
+	audio := testStreamData(metaInt*4 + 37)
+	titles := []string{"", "Band - First Song", "", "Band - Second Song"}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Icy-MetaData") != "1" {
+			t.Error("request didn't ask for ICY metadata")
+		}
+
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("Icy-Metaint", strconv.Itoa(metaInt))
+		w.Header().Set("Icy-Name", "Test Radio")
+		w.Header().Set("Icy-Genre", "Jazz")
+
+		// A block follows every metaInt bytes of audio, empty ones included
+		rest := audio
+		for i := 0; len(rest) > 0; i++ {
+			n := min(metaInt, len(rest))
+			w.Write(rest[:n])
+			rest = rest[n:]
+			if n == metaInt && i < len(titles) {
+				if titles[i] == "" {
+					w.Write([]byte{0})
+				} else {
+					w.Write(icyBlock("StreamTitle='" + titles[i] + "';"))
+				}
+			}
+		}
+	}))
+	defer srv.Close()
+
+	var recorder metadataRecorder
+	s, err := openStreamSource([]string{srv.URL + "/live"}, recorder.record)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	defer s.Close()
+
+	if !s.isLive() || s.isSeekableFile() {
+		t.Error("ICY stream wasn't treated as live")
+	}
+
+	// Odd read sizes so reads straddle the metadata blocks
+	var got []byte
+	buf := make([]byte, 33)
+	for len(got) < len(audio) {
+		n, err := s.Read(buf[:min(len(buf), len(audio)-len(got))])
+		if err != nil {
+			t.Fatalf("failed to read stream: %v", err)
+		}
+		got = append(got, buf[:n]...)
+	}
+
+	if !bytes.Equal(got, audio) {
+		t.Error("audio didn't come through with the metadata stripped")
+	}
+
+	recorder.mu.Lock()
+	station := recorder.updates[0]
+	recorder.mu.Unlock()
+	if station["album"] != "Test Radio" || station["genre"] != "Jazz" {
+		t.Errorf("station info is %v", station)
+	}
+
+	want := []string{"Band - First Song", "Band - Second Song"}
+	if got := recorder.titles(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("titles are %q, want %q", got, want)
+	}
+}
+
+// Serves a file that drops the connection partway the first time it's
+// requested, recording the ranges asked for
+type flakyFile struct {
+	data     []byte
+	dropAt   int
+	mu       sync.Mutex
+	requests []string
+}
+
+func (f *flakyFile) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests = append(f.requests, r.Header.Get("Range"))
+	first := len(f.requests) == 1
+	f.mu.Unlock()
+
+	if !first {
+		http.ServeContent(w, r, "file.mp3", time.Time{}, bytes.NewReader(f.data))
+		return
+	}
+
+	// Promise the whole file but only send part of it
+	w.Header().Set("Content-Type", "audio/mpeg")
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Length", strconv.Itoa(len(f.data)))
+	w.Write(f.data[:f.dropAt])
+}
+
+func TestStreamReconnectsAtOffset(t *testing.T) {
+	shortenRetryDelay(t)
+
+	file := &flakyFile{data: testStreamData(50000), dropAt: 12345}
+	srv := httptest.NewServer(file)
+	defer srv.Close()
+
+	s, err := openStreamSource([]string{srv.URL + "/file.mp3"}, nil)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	defer s.Close()
+
+	if s.isLive() || !s.isSeekableFile() {
+		t.Error("remote file with ranges wasn't treated as seekable")
+	}
+
+	got, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatalf("failed to read stream: %v", err)
+	}
+	if !bytes.Equal(got, file.data) {
+		t.Errorf("read %d bytes that don't match the file", len(got))
+	}
+
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	want := []string{"", fmt.Sprintf("bytes=%d-", file.dropAt)}
+	if strings.Join(file.requests, "|") != strings.Join(want, "|") {
+		t.Errorf("requested ranges %q, want %q", file.requests, want)
+	}
+}
+
+func TestRemoteFileSeeking(t *testing.T) {
+	data := testStreamData(1 << 20)
+
+	var mu sync.Mutex
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "file.flac", time.Time{}, bytes.NewReader(data))
+	}))
+	defer srv.Close()
+
+	f := newRemoteFile(srv.URL, int64(len(data)))
+	defer f.Close()
+
+	readAt := func(offset int64, whence int, n int) []byte {
+		t.Helper()
+		pos, err := f.Seek(offset, whence)
+		if err != nil {
+			t.Fatalf("failed to seek: %v", err)
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(f, buf); err != nil {
+			t.Fatalf("failed to read at %d: %v", pos, err)
+		}
+		if !bytes.Equal(buf, data[pos:pos+int64(n)]) {
+			t.Fatalf("wrong data at %d", pos)
+		}
+		return buf
+	}
+
+	// Short hops forward, like an MP3 decoder indexing frames, share the
+	// first response
+	for pos := int64(0); pos < 300000; pos += 4000 {
+		readAt(pos, io.SeekStart, 400)
+	}
+
+	// Far and backward seeks make new range requests
+	readAt(-1000, io.SeekEnd, 1000)
+	readAt(10, io.SeekStart, 100)
+	readAt(5, io.SeekCurrent, 100)
+
+	if n, err := f.Read(make([]byte, 1)); err != nil || n != 1 {
+		t.Errorf("read after seeking returned %d, %v", n, err)
+	}
+
+	f.Seek(0, io.SeekEnd)
+	if _, err := f.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read at the end returned %v, want EOF", err)
+	}
+	if _, err := f.Seek(-1, io.SeekStart); err == nil {
+		t.Error("seeking before the start succeeded")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"", fmt.Sprintf("bytes=%d-", len(data)-1000), "bytes=10-"}
+	if strings.Join(ranges, "|") != strings.Join(want, "|") {
+		t.Errorf("requested ranges %q, want %q", ranges, want)
+	}
+}
+
+func TestRemoteFileRejectsIgnoredRange(t *testing.T) {
+	data := testStreamData(1000)
+
+	// A server that always sends the whole file
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	f := newRemoteFile(srv.URL, int64(len(data)))
+	defer f.Close()
+
+	f.Seek(500, io.SeekStart)
+	if _, err := f.Read(make([]byte, 10)); err == nil {
+		t.Error("read from a server that ignored the range succeeded")
+	}
+}
+
+func TestReadStreamPlaylist(t *testing.T) {
+	tests := []struct {
+		format, document string
+		want             []string
+	}{
+		{
+			"pls",
+			"[playlist]\nNumberOfEntries=3\nFile1=http://one.example.com/live\nTitle1=One\nFile2=relative.mp3\nFile3=https://two.example.com/live.aac\nVersion=2\n",
+			[]string{"http://one.example.com/live", "https://two.example.com/live.aac"},
+		},
+		{
+			"m3u",
+			"#EXTM3U\n#EXTINF:-1,Station\nhttp://one.example.com:8000/stream\n\n/local/file.mp3\nHTTPS://TWO.example.com/stream\n",
+			[]string{"http://one.example.com:8000/stream", "HTTPS://TWO.example.com/stream"},
+		},
+		{"m3u", "#EXTM3U\n/local/only.mp3\n", nil},
+		{"pls", "", nil},
+	}
+
+	for _, test := range tests {
+		got, err := readStreamPlaylist(test.format, strings.NewReader(test.document))
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("%s playlist %q gave %q, want an error", test.format, test.document, got)
+			}
+			continue
+		}
+		if err != nil || strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("%s playlist %q gave %q, %v; want %q", test.format, test.document, got, err, test.want)
+		}
+	}
+}
+
+// Makes reconnecting quick for the length of a test
+func shortenRetryDelay(t *testing.T) {
+	delay := streamRetryDelay
+	streamRetryDelay = time.Millisecond
+	t.Cleanup(func() { streamRetryDelay = delay })
+}
+
+// Serves a live stream of the given data and content type, counting requests
+type liveServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests int
+}
+
+func newLiveServer(t *testing.T, contentType string, serve func(request int) []byte) *liveServer {
+	s := &liveServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+		request := s.requests
+		s.mu.Unlock()
+
+		data := serve(request)
+		if data == nil {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		// Flushing first leaves the length unknown, like a radio stream
+		w.Header().Set("Content-Type", contentType)
+		w.(http.Flusher).Flush()
+		w.Write(data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *liveServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func TestStreamFailsOverToMatchingCodec(t *testing.T) {
+	shortenRetryDelay(t)
+
+	first, second := testStreamData(3000), testStreamData(5000)
+
+	// The primary goes down after its first connection
+	primary := newLiveServer(t, "audio/mpeg", func(request int) []byte {
+		if request == 1 {
+			return first
+		}
+		return nil
+	})
+	// This fallback works, but the MP3 decoder can't play it
+	ogg := newLiveServer(t, "audio/ogg", func(int) []byte {
+		return testStreamData(100)
+	})
+	mp3 := newLiveServer(t, "audio/mpeg; charset=binary", func(int) []byte {
+		return second
+	})
+
+	s, err := openStreamSource([]string{primary.URL + "/live", ogg.URL + "/live", mp3.URL + "/live"}, nil)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	defer s.Close()
+
+	got := make([]byte, len(first)+len(second))
+	if _, err := io.ReadFull(s, got); err != nil {
+		t.Fatalf("failed to read stream: %v", err)
+	}
+	if !bytes.Equal(got, append(slices.Clone(first), second...)) {
+		t.Error("stream data didn't continue from the matching fallback")
+	}
+
+	if s.currentURL() != mp3.URL+"/live" || s.codec != ".mp3" {
+		t.Errorf("streaming %s as %s", s.currentURL(), s.codec)
+	}
+	if ogg.requestCount() == 0 {
+		t.Error("the ogg fallback wasn't tried")
+	}
+}
+
+func TestStreamGivesUpWithoutMatchingFallback(t *testing.T) {
+	shortenRetryDelay(t)
+
+	primary := newLiveServer(t, "audio/mpeg", func(request int) []byte {
+		if request == 1 {
+			return testStreamData(1000)
+		}
+		return nil
+	})
+	ogg := newLiveServer(t, "audio/ogg", func(int) []byte {
+		return testStreamData(1000)
+	})
+
+	s, err := openStreamSource([]string{primary.URL + "/live", ogg.URL + "/live"}, nil)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	defer s.Close()
+
+	data, err := io.ReadAll(s)
+	if err == nil || len(data) != 1000 {
+		t.Errorf("read %d bytes and %v, want the primary's 1000 then an error", len(data), err)
+	}
+}
+
+func TestStreamSourceKeepsFallbacksAfterPlaylist(t *testing.T) {
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	live := newLiveServer(t, "audio/mpeg", func(int) []byte {
+		return testStreamData(100)
+	})
+	playlist := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "[playlist]\nFile1=%s/live\nNumberOfEntries=1\n", dead.URL)
+	}))
+	defer playlist.Close()
+
+	s, err := openStreamSource([]string{playlist.URL + "/station.pls", live.URL + "/live"}, nil)
+	if err != nil {
+		t.Fatalf("failed to open stream: %v", err)
+	}
+	defer s.Close()
+
+	want := []string{dead.URL + "/live", live.URL + "/live"}
+	if strings.Join(s.urls, "|") != strings.Join(want, "|") || s.currentURL() != live.URL+"/live" {
+		t.Errorf("streaming %s from %q, want the fallback after %q", s.currentURL(), s.urls, want)
+	}
+}
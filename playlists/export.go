@@ -0,0 +1,127 @@
+package playlists
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Writes entries as an extended M3U playlist
+func WriteM3U(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "#EXTM3U")
+	for _, entry := range entries {
+		if title := entry.displayTitle(); title != "" || entry.Duration >= 0 {
+			fmt.Fprintf(bw, "#EXTINF:%d,%s\n", entry.Duration, title)
+		}
+		fmt.Fprintln(bw, entry.Location)
+	}
+
+	return bw.Flush()
+}
+
+// Writes entries as a PLS playlist
+func WritePLS(w io.Writer, entries []Entry) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "[playlist]")
+	for i, entry := range entries {
+		n := i + 1
+		fmt.Fprintf(bw, "File%d=%s\n", n, entry.Location)
+		if title := entry.displayTitle(); title != "" {
+			fmt.Fprintf(bw, "Title%d=%s\n", n, title)
+		}
+		fmt.Fprintf(bw, "Length%d=%d\n", n, entry.Duration)
+	}
+	fmt.Fprintf(bw, "NumberOfEntries=%d\n", len(entries))
+	fmt.Fprintln(bw, "Version=2")
+
+	return bw.Flush()
+}
+
+// Writes a playlist in the given format ("m3u", "pls" or "xspf")
+func Write(format string, w io.Writer, title string, entries []Entry) error {
+	switch format {
+	case "m3u":
+		return WriteM3U(w, entries)
+	case "pls":
+		return WritePLS(w, entries)
+	case "xspf":
+		return WriteXSPF(w, title, entries)
+	}
+
+	return fmt.Errorf("unsupported playlist format: %s", format)
+}
+
+// "Artist - Title" as written to M3U/PLS, which have no separate artist field
+func (e Entry) displayTitle() string {
+	if e.Artist != "" && e.Title != "" {
+		return e.Artist + " - " + e.Title
+	}
+	return e.Title
+}
+
+// Turns an entry location into an absolute local path. Relative paths are
+// resolved against the playlist's folder and file:// URIs are decoded.
+// Returns false for remote URLs
+func ResolvePath(playlistPath string, location string) (string, bool) {
+	location = strings.TrimSpace(location)
+	if location == "" {
+		return "", false
+	}
+
+	if strings.HasPrefix(strings.ToLower(location), "file:") {
+		u, err := url.Parse(location)
+		if err != nil {
+			return "", false
+		}
+		location = u.Path
+		// file:///C:/Music/a.mp3 parses to /C:/Music/a.mp3
+		if runtime.GOOS == "windows" && len(location) > 2 && location[0] == '/' && location[2] == ':' {
+			location = location[1:]
+		}
+	} else if strings.Contains(location, "://") {
+		return "", false
+	}
+
+	// Playlists made on Windows use backslashes
+	if runtime.GOOS != "windows" {
+		location = strings.ReplaceAll(location, `\`, "/")
+	}
+	location = filepath.FromSlash(location)
+
+	if !filepath.IsAbs(location) {
+		location = filepath.Join(filepath.Dir(playlistPath), location)
+	}
+
+	return filepath.Clean(location), true
+}
+
+// Formats a song path for writing to a playlist, relative to the playlist's
+// folder if asked (falling back to absolute when that isn't possible)
+func FormatPath(playlistPath string, songPath string, relative bool) string {
+	if relative {
+		if rel, err := filepath.Rel(filepath.Dir(playlistPath), songPath); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return songPath
+}
+
+// Makes a file:// URI for XSPF, which requires URIs rather than plain paths
+func FileURI(path string) string {
+	if !filepath.IsAbs(path) {
+		return (&url.URL{Path: filepath.ToSlash(path)}).String()
+	}
+
+	slashed := filepath.ToSlash(path)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
@@ -0,0 +1,213 @@
+package playlists
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+var roundTripEntries = []Entry{
+	{Location: "/music/Artist/01 Song.mp3", Title: "Song", Artist: "Artist", Duration: 215},
+	{Location: "relative/Ünïcödé & Co.flac", Title: "Only A Title", Duration: 3},
+	{Location: "http://example.com/stream", Duration: -1},
+	{Location: "no info.ogg", Duration: -1},
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	// M3U and PLS have no artist field, so it's folded into the title
+	folded := make([]Entry, len(roundTripEntries))
+	for i, entry := range roundTripEntries {
+		folded[i] = Entry{Location: entry.Location, Title: entry.displayTitle(), Duration: entry.Duration}
+	}
+
+	tests := []struct {
+		format string
+		want   []Entry
+	}{
+		{"m3u", folded},
+		{"pls", folded},
+		{"xspf", roundTripEntries},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := Write(test.format, &buf, "Mix", roundTripEntries); err != nil {
+			t.Errorf("%s: failed to write: %v", test.format, err)
+			continue
+		}
+
+		got, err := Parse(test.format, &buf)
+		if err != nil {
+			t.Errorf("%s: failed to parse: %v", test.format, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: round trip gave %+v, want %+v", test.format, got, test.want)
+		}
+	}
+
+	if err := Write("wpl", &bytes.Buffer{}, "Mix", roundTripEntries); err == nil {
+		t.Error("wrote an unsupported format")
+	}
+}
+
+func TestWriteM3U(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteM3U(&buf, roundTripEntries[:3]); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "#EXTM3U\n" +
+		"#EXTINF:215,Artist - Song\n/music/Artist/01 Song.mp3\n" +
+		"#EXTINF:3,Only A Title\nrelative/Ünïcödé & Co.flac\n" +
+		"http://example.com/stream\n"
+	if buf.String() != want {
+		t.Errorf("wrote %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWritePLS(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WritePLS(&buf, roundTripEntries[:3]); err != nil {
+		t.Fatal(err)
+	}
+
+	// Numbered from 1, with the count at the end
+	want := "[playlist]\n" +
+		"File1=/music/Artist/01 Song.mp3\nTitle1=Artist - Song\nLength1=215\n" +
+		"File2=relative/Ünïcödé & Co.flac\nTitle2=Only A Title\nLength2=3\n" +
+		"File3=http://example.com/stream\nLength3=-1\n" +
+		"NumberOfEntries=3\nVersion=2\n"
+	if buf.String() != want {
+		t.Errorf("wrote %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteXSPF(t *testing.T) {
+	var buf bytes.Buffer
+	entries := []Entry{{Location: FileURI("/music/a & b.mp3"), Title: "<Title>", Duration: 2}}
+	if err := WriteXSPF(&buf, "Mix", entries); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<playlist xmlns="http://xspf.org/ns/0/" version="1">`,
+		`<title>Mix</title>`,
+		`<location>file:///music/a%20&amp;%20b.mp3</location>`,
+		`<title>&lt;Title&gt;</title>`,
+		`<duration>2000</duration>`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("written playlist is missing %s:\n%s", want, buf.String())
+		}
+	}
+}
+
+// Song paths written to a playlist and read back point at the same files,
+// in every format and whether they're written relative or absolute
+func TestPathRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	playlistPath := filepath.Join(dir, "lists", "mix.m3u")
+	songs := []string{
+		filepath.Join(dir, "lists", "here.mp3"),
+		filepath.Join(dir, "Music", "Some Artist", "01 - a#b %20 ünï.flac"),
+		filepath.Join(dir, "other drive", "song.ogg"),
+	}
+
+	for _, format := range []string{"m3u", "pls", "xspf"} {
+		for _, relative := range []bool{true, false} {
+			var entries []Entry
+			for _, song := range songs {
+				location := FormatPath(playlistPath, song, relative)
+				if format == "xspf" {
+					location = FileURI(location)
+				}
+				entries = append(entries, Entry{Location: location, Duration: -1})
+			}
+
+			var buf bytes.Buffer
+			if err := Write(format, &buf, "Mix", entries); err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := Parse(format, &buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, entry := range parsed {
+				path, ok := ResolvePath(playlistPath, entry.Location)
+				if !ok {
+					t.Errorf("%s (relative %v): %q isn't a local path", format, relative, entry.Location)
+				}
+				got = append(got, path)
+			}
+			if !reflect.DeepEqual(got, songs) {
+				t.Errorf("%s (relative %v): paths came back as %q, want %q", format, relative, got, songs)
+			}
+		}
+	}
+}
+
+func TestFormatPath(t *testing.T) {
+	dir := t.TempDir()
+	playlistPath := filepath.Join(dir, "lists", "mix.m3u")
+
+	tests := []struct {
+		song     string
+		relative bool
+		want     string
+	}{
+		{filepath.Join(dir, "lists", "a.mp3"), true, "a.mp3"},
+		{filepath.Join(dir, "music", "b.mp3"), true, "../music/b.mp3"},
+		{filepath.Join(dir, "music", "b.mp3"), false, filepath.Join(dir, "music", "b.mp3")},
+	}
+
+	for _, test := range tests {
+		if got := FormatPath(playlistPath, test.song, test.relative); got != test.want {
+			t.Errorf("FormatPath(%q, %v) = %q, want %q", test.song, test.relative, got, test.want)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	dir := t.TempDir()
+	playlistPath := filepath.Join(dir, "mix.m3u")
+	abs := filepath.Join(dir, "music", "a b.mp3")
+
+	tests := []struct {
+		location string
+		want     string
+		ok       bool
+	}{
+		{"a.mp3", filepath.Join(dir, "a.mp3"), true},
+		{"sub/../b.mp3", filepath.Join(dir, "b.mp3"), true},
+		{"../up.mp3", filepath.Join(filepath.Dir(dir), "up.mp3"), true},
+		{abs, abs, true},
+		{FileURI(abs), abs, true},
+		{"  a.mp3  ", filepath.Join(dir, "a.mp3"), true},
+		// Made on Windows
+		{`sub\c.mp3`, filepath.Join(dir, "sub", "c.mp3"), true},
+		{"http://example.com/a.mp3", "", false},
+		{"rtsp://example.com/live", "", false},
+		{"", "", false},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests, struct {
+			location string
+			want     string
+			ok       bool
+		}{"file:///music/a%20b.mp3", "/music/a b.mp3", true})
+	}
+
+	for _, test := range tests {
+		got, ok := ResolvePath(playlistPath, test.location)
+		if got != test.want || ok != test.ok {
+			t.Errorf("ResolvePath(%q) = %q, %v, want %q, %v", test.location, got, ok, test.want, test.ok)
+		}
+	}
+}
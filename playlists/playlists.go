@@ -0,0 +1,168 @@
+package playlists
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Represents one entry read from a playlist file
+type Entry struct {
+	Location string
+	Title    string
+	Artist   string
+	Duration int64 // seconds, -1 if unknown
+}
+
+// Parses an M3U/M3U8 playlist, including #EXTINF duration/title lines
+func ParseM3U(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	var pending *Entry
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			// #EXTINF:<duration>[ attributes],<title>
+			if info, ok := strings.CutPrefix(line, "#EXTINF:"); ok {
+				entry := Entry{Duration: -1}
+				durationPart, title, _ := strings.Cut(info, ",")
+				durationPart, _, _ = strings.Cut(strings.TrimSpace(durationPart), " ")
+				if duration, err := strconv.ParseFloat(durationPart, 64); err == nil && duration >= 0 {
+					entry.Duration = int64(duration)
+				}
+				entry.Title = strings.TrimSpace(title)
+				pending = &entry
+			}
+			continue
+		}
+
+		entry := Entry{Duration: -1}
+		if pending != nil {
+			entry = *pending
+			pending = nil
+		}
+		entry.Location = line
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Parses a PLS playlist (INI style File1=/Title1=/Length1= keys)
+func ParsePLS(r io.Reader) ([]Entry, error) {
+	byIndex := make(map[int]*Entry)
+	var order []int
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "[") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		var field string
+		for _, prefix := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, prefix) {
+				field = prefix
+				break
+			}
+		}
+		if field == "" {
+			continue
+		}
+
+		index, err := strconv.Atoi(key[len(field):])
+		if err != nil {
+			continue
+		}
+
+		entry, exists := byIndex[index]
+		if !exists {
+			entry = &Entry{Duration: -1}
+			byIndex[index] = entry
+			order = append(order, index)
+		}
+
+		switch field {
+		case "file":
+			entry.Location = value
+		case "title":
+			entry.Title = value
+		case "length":
+			if length, err := strconv.ParseInt(value, 10, 64); err == nil && length >= 0 {
+				entry.Duration = length
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Entries are numbered, but not necessarily written in order
+	sort.Ints(order)
+
+	var entries []Entry
+	for _, index := range order {
+		if entry := byIndex[index]; entry.Location != "" {
+			entries = append(entries, *entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// Returns the playlist format ("m3u", "pls" or "xspf") for a content type or file name, or "" if it isn't a playlist
+func DetectFormat(contentType string, name string) string {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	switch strings.TrimSpace(mediaType) {
+	case "audio/x-mpegurl", "audio/mpegurl", "application/x-mpegurl", "application/vnd.apple.mpegurl":
+		return "m3u"
+	case "audio/x-scpls", "application/pls+xml":
+		return "pls"
+	case "application/xspf+xml":
+		return "xspf"
+	}
+
+	name, _, _ = strings.Cut(strings.ToLower(name), "?")
+	switch {
+	case strings.HasSuffix(name, ".m3u"), strings.HasSuffix(name, ".m3u8"):
+		return "m3u"
+	case strings.HasSuffix(name, ".pls"):
+		return "pls"
+	case strings.HasSuffix(name, ".xspf"):
+		return "xspf"
+	}
+
+	return ""
+}
+
+// Parses a playlist in the given format
+func Parse(format string, r io.Reader) ([]Entry, error) {
+	switch format {
+	case "pls":
+		return ParsePLS(r)
+	case "xspf":
+		return ParseXSPF(r)
+	default:
+		return ParseM3U(r)
+	}
+}
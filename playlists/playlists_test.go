@@ -0,0 +1,151 @@
+package playlists
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseM3U(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Entry
+	}{
+		{"plain paths", "a.mp3\n/music/b.mp3\n", []Entry{
+			{Location: "a.mp3", Duration: -1},
+			{Location: "/music/b.mp3", Duration: -1},
+		}},
+		{"extended", "#EXTM3U\n#EXTINF:123,Artist - Title\na.mp3\nb.mp3\n", []Entry{
+			{Location: "a.mp3", Title: "Artist - Title", Duration: 123},
+			{Location: "b.mp3", Duration: -1},
+		}},
+		{"attributes and fractions", "#EXTINF:12.7 tvg-id=\"x\" group-title=\"y\",  Spaced  \nhttp://example.com/live\n", []Entry{
+			{Location: "http://example.com/live", Title: "Spaced", Duration: 12},
+		}},
+		{"unknown duration", "#EXTINF:-1,Stream\nhttp://example.com/live\n", []Entry{
+			{Location: "http://example.com/live", Title: "Stream", Duration: -1},
+		}},
+		{"title with commas", "#EXTINF:5,One, Two, Three\na.mp3\n", []Entry{
+			{Location: "a.mp3", Title: "One, Two, Three", Duration: 5},
+		}},
+		{"BOM, CRLF, comments and blank lines", "\ufeff#EXTM3U\r\n\r\n# a comment\r\n#EXTINF:7,Seven\r\n\r\nsub/a.mp3\r\n", []Entry{
+			{Location: "sub/a.mp3", Title: "Seven", Duration: 7},
+		}},
+		{"info without a path", "a.mp3\n#EXTINF:9,Dangling\n", []Entry{
+			{Location: "a.mp3", Duration: -1},
+		}},
+		{"empty", "", nil},
+	}
+
+	for _, test := range tests {
+		got, err := ParseM3U(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: parsed %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParsePLS(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []Entry
+	}{
+		{"standard", "[playlist]\nFile1=a.mp3\nTitle1=A\nLength1=60\nFile2=http://example.com/live\nTitle2=Live\nLength2=-1\nNumberOfEntries=2\nVersion=2\n", []Entry{
+			{Location: "a.mp3", Title: "A", Duration: 60},
+			{Location: "http://example.com/live", Title: "Live", Duration: -1},
+		}},
+		{"out of order and numbered with gaps", "[playlist]\nFile10=c.mp3\nTitle2=B\nFile2=b.mp3\nFile1=a.mp3\n", []Entry{
+			{Location: "a.mp3", Duration: -1},
+			{Location: "b.mp3", Title: "B", Duration: -1},
+			{Location: "c.mp3", Duration: -1},
+		}},
+		{"keys in any case, spaces around values", "\ufeff[Playlist]\r\nfile1 = a b.mp3 \r\nTITLE1= Title=With Equals\r\nlength1=abc\r\n", []Entry{
+			{Location: "a b.mp3", Title: "Title=With Equals", Duration: -1},
+		}},
+		{"titles without files and comments", "[playlist]\n; comment\nTitle1=Orphan\nFile2=b.mp3\nFileX=skip.mp3\nnot a key\n", []Entry{
+			{Location: "b.mp3", Duration: -1},
+		}},
+		{"empty", "[playlist]\nNumberOfEntries=0\n", nil},
+	}
+
+	for _, test := range tests {
+		got, err := ParsePLS(strings.NewReader(test.input))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: parsed %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseXSPF(t *testing.T) {
+	tracks := `
+		<trackList>
+			<track>
+				<location>file:///music/a%20b.mp3</location>
+				<title>A</title>
+				<creator>Artist</creator>
+				<duration>61500</duration>
+			</track>
+			<track><location>sub/c%20d.mp3</location></track>
+			<track><title>No location</title></track>
+			<track><location> http://example.com/live </location><duration>0</duration></track>
+		</trackList>`
+	want := []Entry{
+		{Location: "file:///music/a%20b.mp3", Title: "A", Artist: "Artist", Duration: 61},
+		{Location: "sub/c d.mp3", Duration: -1},
+		{Location: "http://example.com/live", Duration: -1},
+	}
+
+	inputs := map[string]string{
+		"namespaced":   `<?xml version="1.0" encoding="UTF-8"?><playlist version="1" xmlns="http://xspf.org/ns/0/">` + tracks + `</playlist>`,
+		"prefixed":     `<x:playlist version="1" xmlns:x="http://xspf.org/ns/0/">` + strings.NewReplacer("</", "</x:", "<", "<x:").Replace(tracks) + `</x:playlist>`,
+		"no namespace": `<playlist version="1">` + tracks + `</playlist>`,
+	}
+
+	for name, input := range inputs {
+		got, err := ParseXSPF(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: parsed %+v, want %+v", name, got, want)
+		}
+	}
+
+	if _, err := ParseXSPF(strings.NewReader("not xml")); err == nil {
+		t.Error("parsed something that isn't XML")
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		contentType string
+		name        string
+		want        string
+	}{
+		{"audio/x-mpegurl", "", "m3u"},
+		{"application/vnd.apple.mpegurl; charset=utf-8", "stream", "m3u"},
+		{"audio/x-scpls", "", "pls"},
+		{"application/xspf+xml", "", "xspf"},
+		{"", "Mix.M3U8", "m3u"},
+		{"", "http://example.com/radio.pls?sid=1", "pls"},
+		{"text/plain", "list.xspf", "xspf"},
+		{"audio/mpeg", "song.mp3", ""},
+	}
+
+	for _, test := range tests {
+		if got := DetectFormat(test.contentType, test.name); got != test.want {
+			t.Errorf("DetectFormat(%q, %q) = %q, want %q", test.contentType, test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package playlists
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Duration int64  `xml:"duration,omitempty"`
+}
+
+// Namespace written on the root element. Reading only goes by the local
+// name, since plenty of players write XSPF without it
+const xspfNamespace = "http://xspf.org/ns/0/"
+
+type xspfDocument struct {
+	XMLName xml.Name    `xml:"playlist"`
+	Version string      `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+// Parses an XSPF playlist. Durations are stored in milliseconds in XSPF
+func ParseXSPF(r io.Reader) ([]Entry, error) {
+	var doc xspfDocument
+
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse xspf: %w", err)
+	}
+
+	var entries []Entry
+	for _, track := range doc.Tracks {
+		location := strings.TrimSpace(track.Location)
+		if location == "" {
+			continue
+		}
+
+		// Locations are URIs, so relative ones still need unescaping
+		if !strings.Contains(location, ":") {
+			if unescaped, err := url.PathUnescape(location); err == nil {
+				location = unescaped
+			}
+		}
+
+		entry := Entry{
+			Location: location,
+			Title:    strings.TrimSpace(track.Title),
+			Artist:   strings.TrimSpace(track.Creator),
+			Duration: -1,
+		}
+		if track.Duration > 0 {
+			entry.Duration = track.Duration / 1000
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Writes entries as an XSPF playlist
+func WriteXSPF(w io.Writer, title string, entries []Entry) error {
+	doc := xspfDocument{Version: "1", Title: title}
+	for _, entry := range entries {
+		track := xspfTrack{
+			Location: entry.Location,
+			Title:    entry.Title,
+			Creator:  entry.Artist,
+		}
+		if entry.Duration > 0 {
+			track.Duration = entry.Duration * 1000
+		}
+		doc.Tracks = append(doc.Tracks, track)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	start := xml.StartElement{Name: xml.Name{Space: xspfNamespace, Local: "playlist"}}
+	if err := encoder.EncodeElement(doc, start); err != nil {
+		return fmt.Errorf("failed to write xspf: %w", err)
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,276 @@
+package podcasts
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Podcast details read from a feed
+type Feed struct {
+	Title       string
+	Author      string
+	Description string
+	Link        string
+	Image       string
+	Episodes    []FeedEpisode
+}
+
+// Episode details read from a feed
+type FeedEpisode struct {
+	GUID        string
+	Title       string
+	Description string
+	AudioURL    string
+	PubDate     time.Time
+	Duration    int64 // seconds, 0 if unknown
+}
+
+// An RSS element that other namespaces reuse the name of (atom:link,
+// itunes:image), kept with its name so only the plain RSS one is used
+type rssElement struct {
+	XMLName xml.Name
+	Text    string `xml:",chardata"`
+	URL     string `xml:"url"`
+}
+
+type rssDocument struct {
+	Channel struct {
+		Title          string       `xml:"title"`
+		Links          []rssElement `xml:"link"`
+		Description    string       `xml:"description"`
+		ManagingEditor string       `xml:"managingEditor"`
+		ItunesAuthor   string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+		ItunesSummary  string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+		ItunesImage    struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+		Images []rssElement `xml:"image"`
+		Items  []struct {
+			GUID        string       `xml:"guid"`
+			Title       string       `xml:"title"`
+			Links       []rssElement `xml:"link"`
+			Description string       `xml:"description"`
+			PubDate     string       `xml:"pubDate"`
+			Duration    string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+			Enclosure   struct {
+				URL  string `xml:"url,attr"`
+				Type string `xml:"type,attr"`
+			} `xml:"enclosure"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type atomDocument struct {
+	Title    string     `xml:"title"`
+	Subtitle string     `xml:"subtitle"`
+	Logo     string     `xml:"logo"`
+	Icon     string     `xml:"icon"`
+	Links    []atomLink `xml:"link"`
+	Author   struct {
+		Name string `xml:"name"`
+	} `xml:"author"`
+	Entries []struct {
+		ID        string     `xml:"id"`
+		Title     string     `xml:"title"`
+		Summary   string     `xml:"summary"`
+		Content   string     `xml:"content"`
+		Published string     `xml:"published"`
+		Updated   string     `xml:"updated"`
+		Links     []atomLink `xml:"link"`
+		Duration  string     `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	} `xml:"entry"`
+}
+
+// Parses an RSS 2.0 or Atom podcast feed. Items without an audio enclosure are skipped
+func ParseFeed(r io.Reader) (*Feed, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feed: %w", err)
+	}
+
+	// Check the root element to tell RSS and Atom apart
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse feed: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			switch start.Name.Local {
+			case "rss":
+				return parseRSS(data)
+			case "feed":
+				return parseAtom(data)
+			default:
+				return nil, fmt.Errorf("unsupported feed type: %s", start.Name.Local)
+			}
+		}
+	}
+}
+
+// HTML elements that are closed automatically, except link, which has text
+// in RSS
+var feedAutoClose = slices.DeleteFunc(slices.Clone(xml.HTMLAutoClose), func(name string) bool {
+	return name == "link"
+})
+
+func newFeedDecoder(data []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	decoder.AutoClose = feedAutoClose
+	decoder.Entity = xml.HTMLEntity
+	return decoder
+}
+
+func parseRSS(data []byte) (*Feed, error) {
+	var doc rssDocument
+	if err := newFeedDecoder(data).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse rss feed: %w", err)
+	}
+
+	channel := doc.Channel
+	feed := &Feed{
+		Title:       strings.TrimSpace(channel.Title),
+		Author:      firstNonEmpty(channel.ItunesAuthor, channel.ManagingEditor),
+		Description: firstNonEmpty(channel.Description, channel.ItunesSummary),
+		Link:        strings.TrimSpace(rssElementWithoutNamespace(channel.Links).Text),
+		Image:       firstNonEmpty(channel.ItunesImage.Href, rssElementWithoutNamespace(channel.Images).URL),
+	}
+
+	for _, item := range channel.Items {
+		if item.Enclosure.URL == "" {
+			continue
+		}
+
+		feed.Episodes = append(feed.Episodes, FeedEpisode{
+			GUID:        firstNonEmpty(item.GUID, item.Enclosure.URL, rssElementWithoutNamespace(item.Links).Text),
+			Title:       strings.TrimSpace(item.Title),
+			Description: strings.TrimSpace(item.Description),
+			AudioURL:    strings.TrimSpace(item.Enclosure.URL),
+			PubDate:     parseFeedDate(item.PubDate),
+			Duration:    parseDuration(item.Duration),
+		})
+	}
+
+	return feed, nil
+}
+
+// Finds the first element that isn't from another namespace
+func rssElementWithoutNamespace(elements []rssElement) rssElement {
+	for _, element := range elements {
+		if element.XMLName.Space == "" {
+			return element
+		}
+	}
+	return rssElement{}
+}
+
+func parseAtom(data []byte) (*Feed, error) {
+	var doc atomDocument
+	if err := newFeedDecoder(data).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse atom feed: %w", err)
+	}
+
+	feed := &Feed{
+		Title:       strings.TrimSpace(doc.Title),
+		Author:      strings.TrimSpace(doc.Author.Name),
+		Description: strings.TrimSpace(doc.Subtitle),
+		Link:        findAtomLink(doc.Links, "alternate"),
+		Image:       firstNonEmpty(doc.Logo, doc.Icon),
+	}
+
+	for _, entry := range doc.Entries {
+		audioURL := findAtomLink(entry.Links, "enclosure")
+		if audioURL == "" {
+			continue
+		}
+
+		feed.Episodes = append(feed.Episodes, FeedEpisode{
+			GUID:        firstNonEmpty(entry.ID, audioURL),
+			Title:       strings.TrimSpace(entry.Title),
+			Description: firstNonEmpty(entry.Summary, entry.Content),
+			AudioURL:    audioURL,
+			PubDate:     parseFeedDate(firstNonEmpty(entry.Published, entry.Updated)),
+			Duration:    parseDuration(entry.Duration),
+		})
+	}
+
+	return feed, nil
+}
+
+// Finds the href of the first link with the given rel. Links without a rel count as "alternate"
+func findAtomLink(links []atomLink, rel string) string {
+	for _, link := range links {
+		linkRel := link.Rel
+		if linkRel == "" {
+			linkRel = "alternate"
+		}
+		if linkRel == rel {
+			return strings.TrimSpace(link.Href)
+		}
+	}
+	return ""
+}
+
+// Date layouts seen in the wild, RFC 1123 for RSS and RFC 3339 for Atom
+var feedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+func parseFeedDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Parses itunes:duration, which is either seconds or [HH:]MM:SS
+func parseDuration(value string) int64 {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	var total int64
+	for _, part := range strings.Split(value, ":") {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0
+		}
+		total = total*60 + int64(n)
+	}
+	return total
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,196 @@
+package podcasts
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseFixture(t *testing.T, name string) *Feed {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	feed, err := ParseFeed(f)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", name, err)
+	}
+	return feed
+}
+
+func TestParseRSS(t *testing.T) {
+	feed := parseFixture(t, "rss.xml")
+
+	// atom:link and itunes:image share names with the RSS elements and
+	// mustn't stand in for them
+	want := Feed{
+		Title:       "Test Show",
+		Author:      "Test Author",
+		Description: "A show for testing & nothing else",
+		Link:        "https://example.com/show",
+		Image:       "https://example.com/itunes.jpg",
+	}
+	got := *feed
+	got.Episodes = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("show is %+v, want %+v", got, want)
+	}
+
+	episodes := []FeedEpisode{
+		{
+			GUID:        "episode-3",
+			Title:       "Episode Three",
+			Description: "<p>Third &amp; latest</p>",
+			AudioURL:    "https://example.com/audio/3.mp3",
+			PubDate:     time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC),
+			Duration:    3723,
+		},
+		{
+			GUID:     "https://example.com/audio/2.ogg?source=feed",
+			Title:    "Episode Two",
+			AudioURL: "https://example.com/audio/2.ogg?source=feed",
+			PubDate:  time.Date(2024, 1, 2, 9, 30, 0, 0, time.UTC),
+			Duration: 2730,
+		},
+		{
+			GUID:     "episode-1",
+			Title:    "Episode One",
+			AudioURL: "https://example.com/audio/1.flac",
+			PubDate:  time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC),
+			Duration: 3600,
+		},
+	}
+	assertEpisodes(t, feed.Episodes, episodes)
+}
+
+func TestParseRSSImageFallback(t *testing.T) {
+	// Without itunes:image the RSS image is used, not an episode's or another
+	// namespace's
+	feed, err := ParseFeed(strings.NewReader(`<rss xmlns:media="http://search.yahoo.com/mrss/"><channel>
+		<media:image><url>https://example.com/media.jpg</url></media:image>
+		<image><url>https://example.com/rss.jpg</url></image>
+	</channel></rss>`))
+	if err != nil {
+		t.Fatalf("failed to parse feed: %v", err)
+	}
+	if feed.Image != "https://example.com/rss.jpg" {
+		t.Errorf("image is %q", feed.Image)
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	feed := parseFixture(t, "atom.xml")
+
+	want := Feed{
+		Title:       "Atom Show",
+		Author:      "Atom Author",
+		Description: "An Atom feed",
+		Link:        "https://example.com/atom-show",
+		Image:       "https://example.com/logo.png",
+	}
+	got := *feed
+	got.Episodes = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("show is %+v, want %+v", got, want)
+	}
+
+	episodes := []FeedEpisode{
+		{
+			GUID:        "urn:uuid:episode-2",
+			Title:       "Second",
+			Description: "Second summary",
+			AudioURL:    "https://example.com/audio/a2.mp3",
+			PubDate:     time.Date(2024, 2, 2, 12, 0, 0, 0, time.UTC),
+			Duration:    90,
+		},
+		{
+			GUID:        "https://example.com/audio/a1.mp3",
+			Title:       "First",
+			Description: "First content",
+			AudioURL:    "https://example.com/audio/a1.mp3",
+			PubDate:     time.Date(2024, 2, 1, 7, 0, 0, 0, time.UTC),
+		},
+	}
+	assertEpisodes(t, feed.Episodes, episodes)
+}
+
+func TestParseFeedRejectsOtherDocuments(t *testing.T) {
+	for _, doc := range []string{"<html><body></body></html>", "", "not xml"} {
+		if _, err := ParseFeed(strings.NewReader(doc)); err == nil {
+			t.Errorf("ParseFeed(%q) succeeded", doc)
+		}
+	}
+}
+
+func assertEpisodes(t *testing.T, got, want []FeedEpisode) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d episodes, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].PubDate.Equal(want[i].PubDate) {
+			t.Errorf("episode %d published %v, want %v", i, got[i].PubDate, want[i].PubDate)
+		}
+		got[i].PubDate, want[i].PubDate = time.Time{}, time.Time{}
+		if got[i] != want[i] {
+			t.Errorf("episode %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]int64{
+		"3600":     3600,
+		"90.5":     90,
+		"45:30":    2730,
+		"1:02:03":  3723,
+		"01:00:00": 3600,
+		" 5:00 ":   300,
+		"":         0,
+		"1h30m":    0,
+		"1::00":    0,
+	}
+
+	for value, want := range tests {
+		if got := parseDuration(value); got != want {
+			t.Errorf("parseDuration(%q) = %d, want %d", value, got, want)
+		}
+	}
+}
+
+func TestParseFeedDate(t *testing.T) {
+	want := time.Date(2024, 3, 5, 14, 7, 0, 0, time.UTC)
+	tests := []string{
+		"Tue, 05 Mar 2024 14:07:00 +0000",
+		"Tue, 05 Mar 2024 14:07:00 UTC",
+		"Tue, 5 Mar 2024 15:07:00 +0100",
+		"Tue, 5 Mar 2024 14:07:00 GMT",
+		"5 Mar 2024 09:07:00 -0500",
+		"Tue, 5 Mar 2024 14:07 +0000",
+		"2024-03-05T14:07:00Z",
+		"2024-03-05T16:07:00+02:00",
+		"2024-03-05T14:07:00",
+		" Tue, 05 Mar 2024 14:07:00 +0000 ",
+	}
+
+	for _, value := range tests {
+		if got := parseFeedDate(value); !got.Equal(want) {
+			t.Errorf("parseFeedDate(%q) = %v, want %v", value, got, want)
+		}
+	}
+
+	if got := parseFeedDate("2024-03-05"); !got.Equal(time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseFeedDate of a plain date = %v", got)
+	}
+	if got := parseFeedDate("last tuesday"); !got.IsZero() {
+		t.Errorf("parseFeedDate of an unknown layout = %v, want zero", got)
+	}
+}
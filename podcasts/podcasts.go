@@ -0,0 +1,308 @@
+package podcasts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"openturntable/database"
+)
+
+// Largest feed document that will be read
+const maxFeedSize = 32 * 1024 * 1024
+
+var feedClient = &http.Client{Timeout: 30 * time.Second}
+
+// Downloads have no overall timeout since episodes can be large
+var downloadClient = &http.Client{}
+
+// Handles podcast subscriptions, feed refreshes and episode downloads
+type Manager struct {
+	db          *database.DB
+	downloadDir string
+	refreshMu   sync.Mutex
+}
+
+// Creates a manager that stores downloads in the app's Podcasts folder
+func NewManager(db *database.DB) (*Manager, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, fmt.Errorf("could not get config directory: %w", err)
+	}
+
+	downloadDir := filepath.Join(configDir, "OpenTurntable", "Podcasts")
+	if err := os.MkdirAll(downloadDir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create podcasts directory: %w", err)
+	}
+
+	return &Manager{db: db, downloadDir: downloadDir}, nil
+}
+
+// Subscribes to a feed, or refreshes it if already subscribed, and returns the show ID
+func (m *Manager) Subscribe(feedURL string) (int64, error) {
+	feedURL = strings.TrimSpace(feedURL)
+
+	// Don't write episodes while the scheduler is refreshing the same show
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+
+	if show, err := m.db.GetPodcastShowByFeedURL(feedURL); err == nil {
+		return show.ID, m.refresh(show.ID)
+	}
+
+	feed, err := fetchFeed(feedURL)
+	if err != nil {
+		return -1, err
+	}
+
+	showID, err := m.db.CreatePodcastShow(database.PodcastShow{FeedURL: feedURL})
+	if err != nil {
+		return -1, err
+	}
+
+	return showID, m.save(showID, feedURL, feed)
+}
+
+// Re-fetches a show's feed, adding new episodes and updating existing ones
+func (m *Manager) Refresh(showID int64) error {
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+
+	return m.refresh(showID)
+}
+
+// Refreshes a show. The caller must hold refreshMu
+func (m *Manager) refresh(showID int64) error {
+	show, err := m.db.GetPodcastShowById(showID)
+	if err != nil {
+		return err
+	}
+
+	feed, err := fetchFeed(show.FeedURL)
+	if err != nil {
+		return err
+	}
+
+	return m.save(show.ID, show.FeedURL, feed)
+}
+
+// Refreshes every subscribed show, logging (rather than stopping on) failures
+func (m *Manager) RefreshAll() error {
+	// Avoid overlapping scheduled and manual refreshes
+	m.refreshMu.Lock()
+	defer m.refreshMu.Unlock()
+
+	shows, err := m.db.GetPodcastShows()
+	if err != nil {
+		return err
+	}
+
+	for _, show := range shows {
+		if err := m.refresh(show.ID); err != nil {
+			log.Printf("failed to refresh podcast %s: %v\n", show.FeedURL, err)
+		}
+	}
+
+	return nil
+}
+
+// Refreshes all shows every interval until the context is cancelled.
+// onRefresh (if set) is called after each round
+func (m *Manager) StartScheduler(ctx context.Context, interval time.Duration, onRefresh func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := m.RefreshAll(); err != nil {
+					log.Println("failed to refresh podcasts: ", err)
+					continue
+				}
+				if onRefresh != nil {
+					onRefresh()
+				}
+			}
+		}
+	}()
+}
+
+// Stores a fetched feed's show details and episodes
+func (m *Manager) save(showID int64, feedURL string, feed *Feed) error {
+	err := m.db.UpdatePodcastShow(database.PodcastShow{
+		ID:            showID,
+		FeedURL:       feedURL,
+		Title:         feed.Title,
+		Author:        feed.Author,
+		Description:   feed.Description,
+		Link:          feed.Link,
+		Image:         feed.Image,
+		LastRefreshed: time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range feed.Episodes {
+		var pubDate int64
+		if !e.PubDate.IsZero() {
+			pubDate = e.PubDate.Unix()
+		}
+
+		_, err := m.db.UpsertPodcastEpisode(database.PodcastEpisode{
+			Show_ID:     showID,
+			GUID:        e.GUID,
+			Title:       e.Title,
+			Description: e.Description,
+			AudioURL:    e.AudioURL,
+			PubDate:     pubDate,
+			Duration:    e.Duration,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Downloads an episode into the managed folder and returns the file path
+func (m *Manager) Download(episodeID int64) (string, error) {
+	episode, err := m.db.GetPodcastEpisodeById(episodeID)
+	if err != nil {
+		return "", err
+	}
+
+	if episode.DownloadPath != "" {
+		if _, err := os.Stat(episode.DownloadPath); err == nil {
+			return episode.DownloadPath, nil
+		}
+	}
+
+	showDir := filepath.Join(m.downloadDir, fmt.Sprintf("%d", episode.Show_ID))
+	if err := os.MkdirAll(showDir, 0755); err != nil {
+		return "", fmt.Errorf("could not create podcast directory: %w", err)
+	}
+
+	resp, err := downloadClient.Get(episode.AudioURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to download episode: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("episode download returned status %s", resp.Status)
+	}
+
+	ext, err := episodeExtension(episode.AudioURL, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(showDir, fmt.Sprintf("%d%s", episode.ID, ext))
+
+	// Download to a temporary file first so a failed download never looks complete
+	tmp, err := os.CreateTemp(showDir, "download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to download episode: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", err
+	}
+
+	if err := m.db.SetPodcastEpisodeDownloadPath(episode.ID, target); err != nil {
+		return "", err
+	}
+
+	return target, nil
+}
+
+// Removes a downloaded episode file, so it will be streamed again
+func (m *Manager) DeleteDownload(episodeID int64) error {
+	episode, err := m.db.GetPodcastEpisodeById(episodeID)
+	if err != nil {
+		return err
+	}
+
+	if episode.DownloadPath != "" {
+		if err := os.Remove(episode.DownloadPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return m.db.SetPodcastEpisodeDownloadPath(episode.ID, "")
+}
+
+// Unsubscribes from a show, removing its episodes and downloads
+func (m *Manager) Unsubscribe(showID int64) error {
+	if err := os.RemoveAll(filepath.Join(m.downloadDir, fmt.Sprintf("%d", showID))); err != nil {
+		return err
+	}
+
+	return m.db.DeletePodcastShow(showID)
+}
+
+func fetchFeed(feedURL string) (*Feed, error) {
+	req, err := http.NewRequest(http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid feed url: %w", err)
+	}
+	req.Header.Set("User-Agent", "OpenTurntable")
+
+	resp, err := feedClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed returned status %s", resp.Status)
+	}
+
+	return ParseFeed(io.LimitReader(resp.Body, maxFeedSize))
+}
+
+// Picks a file extension for a downloaded episode, preferring the URL's own
+// extension. Formats the player can't decode are refused rather than guessed
+func episodeExtension(audioURL string, contentType string) (string, error) {
+	urlPath, _, _ := strings.Cut(audioURL, "?")
+	switch ext := strings.ToLower(path.Ext(urlPath)); ext {
+	case ".mp3", ".ogg", ".flac", ".wav":
+		return ext, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "audio/mpeg", "audio/mp3", "audio/mpeg3", "audio/x-mpeg", "audio/x-mp3":
+		return ".mp3", nil
+	case "audio/ogg", "application/ogg", "audio/vorbis", "audio/x-vorbis+ogg":
+		return ".ogg", nil
+	case "audio/flac", "audio/x-flac":
+		return ".flac", nil
+	case "audio/wav", "audio/x-wav", "audio/wave", "audio/vnd.wave":
+		return ".wav", nil
+	}
+
+	return "", fmt.Errorf("unsupported episode format: %s", firstNonEmpty(contentType, path.Ext(urlPath), "unknown"))
+}
@@ -0,0 +1,273 @@
+package podcasts
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"openturntable/database"
+)
+
+// Creates a manager whose database and downloads live in a temporary
+// config directory
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	t.Setenv("APPDATA", configDir)
+	t.Setenv("HOME", configDir)
+
+	db, err := database.NewDB()
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	m, err := NewManager(db)
+	if err != nil {
+		t.Fatalf("failed to create manager: %v", err)
+	}
+	return m
+}
+
+// Serves a feed that can be swapped out, and the audio it links to
+type testFeedServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	feed  string
+	audio map[string]string // path to content type
+}
+
+func newTestFeedServer(t *testing.T) *testFeedServer {
+	s := &testFeedServer{audio: map[string]string{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if r.URL.Path == "/feed.xml" {
+			w.Header().Set("Content-Type", "application/rss+xml")
+			w.Write([]byte(strings.ReplaceAll(s.feed, "{server}", s.URL)))
+			return
+		}
+
+		contentType, ok := s.audio[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write([]byte("audio from " + r.URL.Path))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testFeedServer) setFeed(items ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.feed = `<rss><channel><title>Served Show</title>` + strings.Join(items, "") + `</channel></rss>`
+}
+
+func testItem(guid, title, audioPath string) string {
+	return `<item><guid>` + guid + `</guid><title>` + title + `</title><enclosure url="{server}` + audioPath + `"/></item>`
+}
+
+func TestSubscribeAndRefresh(t *testing.T) {
+	m := newTestManager(t)
+	srv := newTestFeedServer(t)
+	srv.setFeed(testItem("a", "Episode A", "/a.mp3"))
+
+	showID, err := m.Subscribe(" " + srv.URL + "/feed.xml ")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	show, err := m.db.GetPodcastShowById(showID)
+	if err != nil {
+		t.Fatalf("failed to get show: %v", err)
+	}
+	if show.Title != "Served Show" || show.LastRefreshed == 0 {
+		t.Errorf("show is %+v", show)
+	}
+
+	episodes, err := m.db.GetPodcastEpisodes(showID)
+	if err != nil || len(episodes) != 1 {
+		t.Fatalf("got episodes %+v, %v", episodes, err)
+	}
+
+	// Progress survives a refresh that changes the episode's details
+	if err := m.db.SetPodcastEpisodePosition(episodes[0].ID, 42.5); err != nil {
+		t.Fatalf("failed to set position: %v", err)
+	}
+	srv.setFeed(testItem("a", "Episode A (remastered)", "/a.mp3"), testItem("b", "Episode B", "/b.mp3"))
+
+	// Subscribing again refreshes the existing show
+	again, err := m.Subscribe(srv.URL + "/feed.xml")
+	if err != nil || again != showID {
+		t.Fatalf("subscribing again returned %d, %v; want %d", again, err, showID)
+	}
+
+	episodes, err = m.db.GetPodcastEpisodes(showID)
+	if err != nil || len(episodes) != 2 {
+		t.Fatalf("got episodes %+v, %v", episodes, err)
+	}
+	for _, e := range episodes {
+		if e.GUID == "a" && (e.Title != "Episode A (remastered)" || e.Position != 42.5) {
+			t.Errorf("refreshed episode is %+v", e)
+		}
+	}
+}
+
+func TestRefreshAllKeepsGoingAfterFailures(t *testing.T) {
+	m := newTestManager(t)
+	srv := newTestFeedServer(t)
+	srv.setFeed(testItem("a", "Episode A", "/a.mp3"))
+
+	showID, err := m.Subscribe(srv.URL + "/feed.xml")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if _, err := m.db.CreatePodcastShow(database.PodcastShow{FeedURL: srv.URL + "/missing.xml"}); err != nil {
+		t.Fatalf("failed to create show: %v", err)
+	}
+
+	srv.setFeed(testItem("a", "Episode A", "/a.mp3"), testItem("b", "Episode B", "/b.mp3"))
+	if err := m.RefreshAll(); err != nil {
+		t.Fatalf("failed to refresh: %v", err)
+	}
+
+	episodes, err := m.db.GetPodcastEpisodes(showID)
+	if err != nil || len(episodes) != 2 {
+		t.Errorf("got episodes %+v, %v", episodes, err)
+	}
+}
+
+func TestSubscribeFailures(t *testing.T) {
+	m := newTestManager(t)
+	srv := newTestFeedServer(t)
+	srv.audio["/page.html"] = "text/html"
+
+	for _, url := range []string{srv.URL + "/missing.xml", srv.URL + "/page.html", "not a url"} {
+		if _, err := m.Subscribe(url); err == nil {
+			t.Errorf("subscribing to %q succeeded", url)
+		}
+	}
+
+	shows, err := m.db.GetPodcastShows()
+	if err != nil || len(shows) != 0 {
+		t.Errorf("failed subscriptions left shows %+v, %v", shows, err)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	m := newTestManager(t)
+	srv := newTestFeedServer(t)
+	srv.audio["/episode"] = "audio/ogg; charset=binary"
+	srv.audio["/a.mp3"] = "application/octet-stream"
+	srv.audio["/video.m4a"] = "audio/mp4"
+	srv.setFeed(
+		testItem("ogg", "Ogg", "/episode"),
+		testItem("mp3", "MP3", "/a.mp3"),
+		testItem("m4a", "M4A", "/video.m4a"),
+		testItem("gone", "Gone", "/gone.mp3"),
+	)
+
+	showID, err := m.Subscribe(srv.URL + "/feed.xml")
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	episodes, err := m.db.GetPodcastEpisodes(showID)
+	if err != nil {
+		t.Fatalf("failed to get episodes: %v", err)
+	}
+
+	byGUID := map[string]database.PodcastEpisode{}
+	for _, e := range episodes {
+		byGUID[e.GUID] = e
+	}
+
+	for guid, ext := range map[string]string{"ogg": ".ogg", "mp3": ".mp3"} {
+		episode := byGUID[guid]
+		target, err := m.Download(episode.ID)
+		if err != nil {
+			t.Errorf("failed to download %s: %v", guid, err)
+			continue
+		}
+		if filepath.Ext(target) != ext || !strings.HasPrefix(target, m.downloadDir) {
+			t.Errorf("%s downloaded to %s", guid, target)
+		}
+
+		data, err := os.ReadFile(target)
+		if err != nil || !bytes.HasPrefix(data, []byte("audio from ")) {
+			t.Errorf("downloaded %s is %q, %v", guid, data, err)
+		}
+
+		stored, _ := m.db.GetPodcastEpisodeById(episode.ID)
+		if stored.DownloadPath != target {
+			t.Errorf("%s download path is %q, want %q", guid, stored.DownloadPath, target)
+		}
+
+		// Deleting the download goes back to streaming
+		if err := m.DeleteDownload(episode.ID); err != nil {
+			t.Errorf("failed to delete %s: %v", guid, err)
+		}
+		if _, err := os.Stat(target); !os.IsNotExist(err) {
+			t.Errorf("%s download still exists", guid)
+		}
+	}
+
+	// Formats that can't be played, and failed requests, leave nothing behind
+	for _, guid := range []string{"m4a", "gone"} {
+		if target, err := m.Download(byGUID[guid].ID); err == nil {
+			t.Errorf("downloading %s succeeded with %s", guid, target)
+		}
+		stored, _ := m.db.GetPodcastEpisodeById(byGUID[guid].ID)
+		if stored.DownloadPath != "" {
+			t.Errorf("%s download path is %q", guid, stored.DownloadPath)
+		}
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(m.downloadDir, fmt.Sprint(showID)))
+	if len(entries) != 0 {
+		t.Errorf("downloads folder still has %d files", len(entries))
+	}
+
+	// Unsubscribing removes the show's episodes
+	if err := m.Unsubscribe(showID); err != nil {
+		t.Fatalf("failed to unsubscribe: %v", err)
+	}
+	if _, err := m.db.GetPodcastEpisodeById(byGUID["ogg"].ID); err == nil {
+		t.Error("episode still exists after unsubscribing")
+	}
+}
+
+func TestEpisodeExtension(t *testing.T) {
+	tests := []struct {
+		url, contentType string
+		want             string
+	}{
+		{"https://example.com/a.MP3?token=1", "application/octet-stream", ".mp3"},
+		{"https://example.com/a.flac", "", ".flac"},
+		{"https://example.com/download", "audio/mpeg", ".mp3"},
+		{"https://example.com/download", "Audio/OGG; codecs=vorbis", ".ogg"},
+		{"https://example.com/download", "audio/x-flac", ".flac"},
+		{"https://example.com/download", "audio/wav", ".wav"},
+		{"https://example.com/a.m4a", "audio/mp4", ""},
+		{"https://example.com/a.aac", "audio/aac", ""},
+		{"https://example.com/download", "", ""},
+	}
+
+	for _, test := range tests {
+		got, err := episodeExtension(test.url, test.contentType)
+		if got != test.want || (err == nil) != (test.want != "") {
+			t.Errorf("episodeExtension(%q, %q) = %q, %v; want %q", test.url, test.contentType, got, err, test.want)
+		}
+	}
+}
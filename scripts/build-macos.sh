@@ -4,6 +4,6 @@ echo -e "Start running the script..."
 cd ../
 
 echo -e "Start building the app for macos platform..."
-wails build --clean --platform darwin/universal -tags "production"
+wails build --clean --platform darwin/universal -tags "production sqlite_fts5"
 
 echo -e "End running the script!"
@@ -4,6 +4,6 @@ echo -e "Start running the script..."
 cd ../
 
 echo -e "Start building the app for windows platform..."
-wails build --clean --platform windows/amd64 -tags "production"
+wails build --clean --platform windows/amd64 -tags "production sqlite_fts5"
 
 echo -e "End running the script!"
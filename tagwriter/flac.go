@@ -0,0 +1,167 @@
+package tagwriter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"os"
+	"slices"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// FLAC metadata block types
+const (
+	flacStreamInfo    = 0
+	flacPadding       = 1
+	flacVorbisComment = 4
+	flacPicture       = 6
+)
+
+// Largest FLAC metadata block (the length is 24 bits)
+const maxFLACBlock = 1<<24 - 1
+
+// A FLAC metadata block, without its header
+type flacBlock struct {
+	kind byte
+	data []byte
+}
+
+// Rewrites a FLAC file's metadata blocks, leaving the audio frames untouched
+func rewriteFLAC(src *os.File, dst io.Writer, changes Changes) error {
+	var magic [4]byte
+	if _, err := io.ReadFull(src, magic[:]); err != nil {
+		return err
+	}
+	if string(magic[:]) != "fLaC" {
+		return errors.New("not a FLAC file")
+	}
+
+	var blocks []flacBlock
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(src, header[:]); err != nil {
+			return err
+		}
+
+		length := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		data := make([]byte, length)
+		if _, err := io.ReadFull(src, data); err != nil {
+			return err
+		}
+
+		// Padding is replaced with fresh padding at the end
+		if kind := header[0] & 0x7f; kind != flacPadding {
+			blocks = append(blocks, flacBlock{kind, data})
+		}
+
+		if header[0]&0x80 != 0 {
+			break
+		}
+	}
+
+	if len(blocks) == 0 || blocks[0].kind != flacStreamInfo {
+		return errors.New("FLAC file doesn't start with STREAMINFO")
+	}
+
+	if changes.Tags != nil {
+		if err := applyFLACComments(&blocks, changes); err != nil {
+			return err
+		}
+	}
+
+	if changes.coverChanged() {
+		kept := blocks[:0]
+		for _, block := range blocks {
+			if block.kind == flacPicture && len(block.data) >= 4 {
+				kind := binary.BigEndian.Uint32(block.data)
+				if kind == id3PictureFront || kind == id3PictureOther {
+					continue
+				}
+			}
+			kept = append(kept, block)
+		}
+		blocks = kept
+	}
+
+	if changes.Cover != nil {
+		blocks = append(blocks, flacBlock{flacPicture, flacPictureBlock(*changes.Cover)})
+	}
+
+	blocks = append(blocks, flacBlock{flacPadding, make([]byte, tagPadding)})
+
+	var out bytes.Buffer
+	out.WriteString("fLaC")
+	for i, block := range blocks {
+		if len(block.data) > maxFLACBlock {
+			return errors.New("FLAC metadata block too large")
+		}
+
+		kind := block.kind
+		if i == len(blocks)-1 {
+			kind |= 0x80
+		}
+		n := len(block.data)
+		out.Write([]byte{kind, byte(n >> 16), byte(n >> 8), byte(n)})
+		out.Write(block.data)
+	}
+
+	if _, err := dst.Write(out.Bytes()); err != nil {
+		return err
+	}
+
+	_, err := io.Copy(dst, src)
+	return err
+}
+
+// Applies text tag changes to the VORBIS_COMMENT block, adding one after
+// STREAMINFO if there isn't one
+func applyFLACComments(blocks *[]flacBlock, changes Changes) error {
+	for i, block := range *blocks {
+		if block.kind != flacVorbisComment {
+			continue
+		}
+
+		vc, err := parseVorbisComments(block.data)
+		if err != nil {
+			return err
+		}
+		vc.apply(changes, false)
+		(*blocks)[i].data = vc.bytes()
+		return nil
+	}
+
+	vc := &vorbisComments{vendor: vendor}
+	vc.apply(changes, false)
+	*blocks = slices.Insert(*blocks, 1, flacBlock{flacVorbisComment, vc.bytes()})
+	return nil
+}
+
+// Encodes a front cover as a FLAC PICTURE block (also used, base64
+// encoded, for pictures in Ogg Vorbis comments)
+func flacPictureBlock(pic Picture) []byte {
+	var width, height uint32
+	if config, _, err := image.DecodeConfig(bytes.NewReader(pic.Data)); err == nil {
+		width, height = uint32(config.Width), uint32(config.Height)
+	}
+
+	var b bytes.Buffer
+	w := func(v uint32) { binary.Write(&b, binary.BigEndian, v) }
+
+	w(id3PictureFront)
+	w(uint32(len(pic.MIMEType)))
+	b.WriteString(pic.MIMEType)
+	w(0) // description
+	w(width)
+	w(height)
+	w(24) // color depth
+	w(0)  // colors used, 0 for non-indexed images
+	w(uint32(len(pic.Data)))
+	b.Write(pic.Data)
+
+	return b.Bytes()
+}
@@ -0,0 +1,191 @@
+package tagwriter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"openturntable/playback"
+)
+
+// A STREAMINFO block for 44.1 kHz stereo 16 bit audio
+var testStreamInfo = []byte{
+	0x10, 0x00, 0x10, 0x00, // block sizes
+	0x00, 0x00, 0x0e, 0x00, 0x00, 0x10, // frame sizes
+	0x0a, 0xc4, 0x42, 0xf0, 0x00, 0x00, 0x56, 0x22, // rate, channels, depth, samples
+	1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, // MD5
+}
+
+// Builds a FLAC metadata block with its header
+func flacBlockBytes(kind byte, last bool, data []byte) []byte {
+	if last {
+		kind |= 0x80
+	}
+	n := len(data)
+	return append([]byte{kind, byte(n >> 16), byte(n >> 8), byte(n)}, data...)
+}
+
+// Builds a PICTURE block body
+func flacPictureData(kind uint32, mimeType string, data []byte) []byte {
+	var b []byte
+	b = binary.BigEndian.AppendUint32(b, kind)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(mimeType)))
+	b = append(b, mimeType...)
+	b = binary.BigEndian.AppendUint32(b, 0) // description
+	b = append(b, make([]byte, 16)...)      // size, depth and colors
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+// Splits a FLAC file into its metadata blocks and the audio after them
+func readWrittenFLAC(t *testing.T, path string) ([]flacBlock, []byte) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte("fLaC")) {
+		t.Fatal("file doesn't start with fLaC")
+	}
+
+	var blocks []flacBlock
+	rest := data[4:]
+	for {
+		if len(rest) < 4 {
+			t.Fatal("metadata ended without a last block")
+		}
+		n := int(rest[1])<<16 | int(rest[2])<<8 | int(rest[3])
+		blocks = append(blocks, flacBlock{rest[0] & 0x7f, rest[4 : 4+n]})
+		last := rest[0]&0x80 != 0
+		rest = rest[4+n:]
+		if last {
+			return blocks, rest
+		}
+	}
+}
+
+func TestFLACRewrite(t *testing.T) {
+	comments := &vorbisComments{vendor: "reference libFLAC 1.4.3", comments: []string{
+		"TITLE=Old Title",
+		"YEAR=1990",
+		"ALBUM ARTIST=Old Album Artist",
+		"REPLAYGAIN_TRACK_GAIN=-1.00 dB",
+	}}
+
+	audio := testAudio(5000)
+	var fixture []byte
+	fixture = append(fixture, "fLaC"...)
+	fixture = append(fixture, flacBlockBytes(flacStreamInfo, false, testStreamInfo)...)
+	fixture = append(fixture, flacBlockBytes(flacPadding, false, make([]byte, 50))...)
+	fixture = append(fixture, flacBlockBytes(flacVorbisComment, false, comments.bytes())...)
+	fixture = append(fixture, flacBlockBytes(flacPicture, false, flacPictureData(id3PictureFront, "image/jpeg", []byte{0xff, 0xd8}))...)
+	fixture = append(fixture, flacBlockBytes(flacPicture, false, flacPictureData(4, "image/png", backCoverData))...)
+	fixture = append(fixture, flacBlockBytes(flacPadding, true, make([]byte, 100))...)
+	fixture = append(fixture, audio...)
+
+	path := writeFixture(t, ".flac", fixture)
+	cover := testCover(t)
+
+	if err := Write(path, Changes{Tags: &testTags, Cover: cover}); err != nil {
+		t.Fatalf("failed to write tags: %v", err)
+	}
+
+	blocks, rest := readWrittenFLAC(t, path)
+	if !bytes.Equal(rest, audio) {
+		t.Error("audio changed")
+	}
+
+	var kinds []byte
+	for _, block := range blocks {
+		kinds = append(kinds, block.kind)
+	}
+	want := []byte{flacStreamInfo, flacVorbisComment, flacPicture, flacPicture, flacPadding}
+	if !slices.Equal(kinds, want) {
+		t.Fatalf("blocks are %v, want %v", kinds, want)
+	}
+
+	if !bytes.Equal(blocks[0].data, testStreamInfo) {
+		t.Error("STREAMINFO changed")
+	}
+	if len(blocks[4].data) != tagPadding {
+		t.Errorf("padding is %d bytes, want %d", len(blocks[4].data), tagPadding)
+	}
+
+	vc, err := parseVorbisComments(blocks[1].data)
+	if err != nil {
+		t.Fatalf("failed to parse comments: %v", err)
+	}
+	if vc.vendor != comments.vendor {
+		t.Errorf("vendor is %q", vc.vendor)
+	}
+	if !slices.Contains(vc.comments, "REPLAYGAIN_TRACK_GAIN=-1.00 dB") {
+		t.Error("unrelated comment wasn't kept")
+	}
+	for _, comment := range vc.comments {
+		if strings.HasPrefix(comment, "YEAR=") || strings.HasPrefix(comment, "ALBUM ARTIST=") {
+			t.Errorf("%q should have been replaced", comment)
+		}
+	}
+
+	metadata, pics := readTags(t, path)
+	assertMetadata(t, metadata, testMetadata)
+
+	if front := findPicture(pics, playback.PictureFront); front == nil || !bytes.Equal(front.Data, cover.Data) {
+		t.Error("new front cover wasn't read back")
+	}
+	if back := findPicture(pics, playback.PictureBack); back == nil || !bytes.Equal(back.Data, backCoverData) {
+		t.Error("back cover didn't survive")
+	}
+}
+
+func TestFLACWithoutComments(t *testing.T) {
+	audio := testAudio(2000)
+	var fixture []byte
+	fixture = append(fixture, "fLaC"...)
+	fixture = append(fixture, flacBlockBytes(flacStreamInfo, true, testStreamInfo)...)
+	fixture = append(fixture, audio...)
+
+	path := writeFixture(t, ".flac", fixture)
+	if err := Write(path, Changes{Tags: &testTags}); err != nil {
+		t.Fatalf("failed to write tags: %v", err)
+	}
+
+	blocks, rest := readWrittenFLAC(t, path)
+	if !bytes.Equal(rest, audio) {
+		t.Error("audio changed")
+	}
+	if len(blocks) != 3 || blocks[1].kind != flacVorbisComment || blocks[2].kind != flacPadding {
+		t.Fatalf("blocks are %v", blocks)
+	}
+
+	metadata, _ := readTags(t, path)
+	assertMetadata(t, metadata, testMetadata)
+}
+
+func TestFLACRemoveCover(t *testing.T) {
+	audio := testAudio(1000)
+	var fixture []byte
+	fixture = append(fixture, "fLaC"...)
+	fixture = append(fixture, flacBlockBytes(flacStreamInfo, false, testStreamInfo)...)
+	fixture = append(fixture, flacBlockBytes(flacPicture, true, flacPictureData(id3PictureFront, "image/jpeg", []byte{0xff, 0xd8}))...)
+	fixture = append(fixture, audio...)
+
+	path := writeFixture(t, ".flac", fixture)
+	if err := Write(path, Changes{RemoveCover: true}); err != nil {
+		t.Fatalf("failed to write tags: %v", err)
+	}
+
+	blocks, rest := readWrittenFLAC(t, path)
+	if !bytes.Equal(rest, audio) {
+		t.Error("audio changed")
+	}
+	for _, block := range blocks {
+		if block.kind == flacPicture {
+			t.Error("front cover wasn't removed")
+		}
+	}
+}
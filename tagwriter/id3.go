@@ -0,0 +1,331 @@
+package tagwriter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ID3v2.4 frame flags this package understands
+const (
+	id3FlagUnsync     = 0x0002
+	id3FlagDataLength = 0x0001
+	id3FlagCompressed = 0x0008
+	id3FlagEncrypted  = 0x0004
+)
+
+// ID3v2.4 picture types treated as the cover
+const (
+	id3PictureOther = 0x00
+	id3PictureFront = 0x03
+)
+
+// A single ID3v2.4 frame
+type id3Frame struct {
+	id    string
+	flags uint16
+	data  []byte
+}
+
+// An ID3v2 tag, held as v2.4 frames whatever version it was read as
+type id3Tag struct {
+	frames []id3Frame
+}
+
+// Frames from ID3v2.3 that were renamed in v2.4
+var id3v23Renamed = map[string]string{
+	"TYER": "TDRC",
+	"TORY": "TDOR",
+}
+
+// Frames from ID3v2.3 that don't exist in v2.4 and are dropped
+var id3v23Dropped = map[string]bool{
+	"TDAT": true,
+	"TIME": true,
+	"TRDA": true,
+	"TSIZ": true,
+}
+
+// Reads an ID3v2 tag from the start of r. Returns an empty tag if there
+// isn't one, along with how many bytes the tag took up
+func readID3(r io.Reader) (*id3Tag, int64, error) {
+	var header [10]byte
+	_, err := io.ReadFull(r, header[:])
+	if err == io.ErrUnexpectedEOF || err == io.EOF || (err == nil && string(header[:3]) != "ID3") {
+		return &id3Tag{}, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	version := header[3]
+	flags := header[5]
+	size := int64(syncsafe(header[6:10]))
+
+	if version < 3 || version > 4 {
+		return nil, 0, fmt.Errorf("%w: ID3v2.%d", errUnsupported, version)
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, 0, err
+	}
+
+	total := 10 + size
+	if version == 4 && flags&0x10 != 0 {
+		// Footer
+		if _, err := io.CopyN(io.Discard, r, 10); err != nil {
+			return nil, 0, err
+		}
+		total += 10
+	}
+
+	// v2.3 unsynchronises the whole tag, v2.4 marks it per frame
+	if version == 3 && flags&0x80 != 0 {
+		body = resync(body)
+	}
+
+	if flags&0x40 != 0 {
+		if len(body) < 4 {
+			return nil, 0, errors.New("invalid ID3 extended header")
+		}
+		skip := int(binary.BigEndian.Uint32(body)) + 4
+		if version == 4 {
+			skip = int(syncsafe(body[:4]))
+		}
+		if skip > len(body) {
+			return nil, 0, errors.New("invalid ID3 extended header")
+		}
+		body = body[skip:]
+	}
+
+	tag := &id3Tag{}
+	for len(body) >= 10 && body[0] != 0 {
+		id := string(body[:4])
+		frameSize := int(binary.BigEndian.Uint32(body[4:8]))
+		if version == 4 {
+			frameSize = int(syncsafe(body[4:8]))
+		}
+		frameFlags := binary.BigEndian.Uint16(body[8:10])
+
+		if frameSize > len(body)-10 {
+			return nil, 0, fmt.Errorf("invalid ID3 frame %q", id)
+		}
+		data := body[10 : 10+frameSize]
+		body = body[10+frameSize:]
+
+		frame, ok := convertFrame(version, id, frameFlags, data)
+		if ok {
+			tag.frames = append(tag.frames, frame)
+		}
+	}
+
+	return tag, total, nil
+}
+
+// Turns a frame as read into a v2.4 frame with plain data. Frames that
+// can't be carried over (compressed or encrypted v2.3 frames, and v2.3
+// frames with no v2.4 equivalent) report false
+func convertFrame(version byte, id string, flags uint16, data []byte) (id3Frame, bool) {
+	if version == 3 {
+		if id3v23Dropped[id] || flags&0x00c0 != 0 {
+			return id3Frame{}, false
+		}
+		if renamed, ok := id3v23Renamed[id]; ok {
+			id = renamed
+		}
+
+		// Status flags move down a bit, grouping moves to 0x40
+		var converted uint16
+		converted |= (flags & 0xe000) >> 1
+		if flags&0x0020 != 0 {
+			converted |= 0x0040
+		}
+		return id3Frame{id: id, flags: converted, data: data}, true
+	}
+
+	if flags&(id3FlagCompressed|id3FlagEncrypted) != 0 {
+		return id3Frame{id: id, flags: flags, data: data}, true
+	}
+
+	if flags&id3FlagDataLength != 0 && len(data) >= 4 {
+		data = data[4:]
+		flags &^= id3FlagDataLength
+	}
+	if flags&id3FlagUnsync != 0 {
+		data = resync(data)
+		flags &^= id3FlagUnsync
+	}
+
+	return id3Frame{id: id, flags: flags, data: data}, true
+}
+
+// Encodes the tag as ID3v2.4, followed by padding zero bytes
+func (t *id3Tag) bytes(padding int) []byte {
+	var body bytes.Buffer
+	for _, frame := range t.frames {
+		body.WriteString(frame.id)
+		body.Write(putSyncsafe(uint32(len(frame.data))))
+		binary.Write(&body, binary.BigEndian, frame.flags)
+		body.Write(frame.data)
+	}
+	body.Write(make([]byte, padding))
+
+	var out bytes.Buffer
+	out.WriteString("ID3")
+	out.Write([]byte{4, 0, 0})
+	out.Write(putSyncsafe(uint32(body.Len())))
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+// The ID3v2.4 text frames tags are written to, with their values
+func id3TextFrames(tags Tags) [][2]string {
+	return [][2]string{
+		{"TIT2", tags.Title},
+		{"TPE1", tags.Artist},
+		{"TALB", tags.Album},
+		{"TPE2", tags.AlbumArtist},
+		{"TCON", tags.Genre},
+		{"TDRC", tags.Year},
+		{"TCOM", tags.Composer},
+		{"TRCK", numberOf(tags.Track, tags.TrackTotal)},
+		{"TPOS", numberOf(tags.Disc, tags.DiscTotal)},
+	}
+}
+
+// Applies changes to the tag's frames
+func (t *id3Tag) apply(changes Changes) {
+	if changes.Tags != nil {
+		var frames []id3Frame
+		for _, text := range id3TextFrames(*changes.Tags) {
+			id, value := text[0], text[1]
+			t.removeFrames(func(f id3Frame) bool { return f.id == id })
+			if value != "" {
+				frames = append(frames, id3Frame{id: id, data: append([]byte{3}, value...)})
+			}
+		}
+
+		// Comments with a description (e.g. iTunNORM) belong to other apps
+		t.removeFrames(func(f id3Frame) bool { return f.id == "COMM" && commentDescriptionEmpty(f.data) })
+		if comment := changes.Tags.Comment; comment != "" {
+			data := []byte{3, 'e', 'n', 'g', 0} // UTF-8, language, empty description
+			frames = append(frames, id3Frame{id: "COMM", data: append(data, comment...)})
+		}
+
+		// Ahead of the other frames, since readers take the first of each
+		t.frames = append(frames, t.frames...)
+	}
+
+	if changes.coverChanged() {
+		t.removeFrames(func(f id3Frame) bool {
+			if f.id != "APIC" {
+				return false
+			}
+			kind, ok := apicType(f.data)
+			return ok && (kind == id3PictureFront || kind == id3PictureOther)
+		})
+	}
+
+	if changes.Cover != nil {
+		var data bytes.Buffer
+		data.WriteByte(3) // UTF-8
+		data.WriteString(changes.Cover.MIMEType)
+		data.WriteByte(0)
+		data.WriteByte(id3PictureFront)
+		data.WriteByte(0) // empty description
+		data.Write(changes.Cover.Data)
+
+		t.frames = append(t.frames, id3Frame{id: "APIC", data: data.Bytes()})
+	}
+}
+
+// Removes every frame matching drop
+func (t *id3Tag) removeFrames(drop func(id3Frame) bool) {
+	kept := t.frames[:0]
+	for _, frame := range t.frames {
+		if !drop(frame) {
+			kept = append(kept, frame)
+		}
+	}
+	t.frames = kept
+}
+
+// Reports whether a COMM frame has an empty description
+func commentDescriptionEmpty(data []byte) bool {
+	if len(data) < 5 {
+		return false
+	}
+
+	// Encoding and language come first
+	description := data[4:]
+	switch data[0] {
+	case 0, 3:
+		return description[0] == 0
+	case 1:
+		if bytes.HasPrefix(description, []byte{0xff, 0xfe}) || bytes.HasPrefix(description, []byte{0xfe, 0xff}) {
+			description = description[2:]
+		}
+		return bytes.HasPrefix(description, []byte{0, 0})
+	default:
+		return bytes.HasPrefix(description, []byte{0, 0})
+	}
+}
+
+// Gets the picture type of an APIC frame
+func apicType(data []byte) (byte, bool) {
+	if len(data) < 2 {
+		return 0, false
+	}
+
+	// Encoding, then a Latin-1 MIME type ending in a zero byte
+	end := bytes.IndexByte(data[1:], 0)
+	if end < 0 || 2+end >= len(data) {
+		return 0, false
+	}
+	return data[2+end], true
+}
+
+// Rewrites an MP3 file with a new ID3v2.4 tag in front of the audio
+func rewriteMP3(src *os.File, dst io.Writer, changes Changes) error {
+	tag, size, err := readID3(src)
+	if err != nil {
+		return err
+	}
+	tag.apply(changes)
+
+	if _, err := dst.Write(tag.bytes(tagPadding)); err != nil {
+		return err
+	}
+
+	if _, err := src.Seek(size, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// Decodes a 28 bit syncsafe integer
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7f)<<21 | uint32(b[1]&0x7f)<<14 | uint32(b[2]&0x7f)<<7 | uint32(b[3]&0x7f)
+}
+
+// Encodes a 28 bit syncsafe integer
+func putSyncsafe(n uint32) []byte {
+	return []byte{byte(n>>21) & 0x7f, byte(n>>14) & 0x7f, byte(n>>7) & 0x7f, byte(n) & 0x7f}
+}
+
+// Undoes ID3 unsynchronisation (0xff 0x00 back to 0xff)
+func resync(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		out = append(out, data[i])
+		if data[i] == 0xff && i+1 < len(data) && data[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
@@ -0,0 +1,255 @@
+package tagwriter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"openturntable/playback"
+)
+
+// Builds an ID3v2.3 frame
+func id3v23Frame(id string, data []byte) []byte {
+	frame := []byte(id)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(data)))
+	frame = append(frame, 0, 0)
+	return append(frame, data...)
+}
+
+// Builds an ID3v2.4 frame with the given flags
+func id3v24Frame(id string, flags uint16, data []byte) []byte {
+	frame := append([]byte(id), putSyncsafe(uint32(len(data)))...)
+	frame = binary.BigEndian.AppendUint16(frame, flags)
+	return append(frame, data...)
+}
+
+// Builds a Latin-1 text frame body
+func latin1(s string) []byte {
+	return append([]byte{0}, s...)
+}
+
+// Builds an APIC frame body
+func apic(mimeType string, kind byte, data []byte) []byte {
+	body := append([]byte{0}, mimeType...)
+	body = append(body, 0, kind, 0)
+	return append(body, data...)
+}
+
+// Applies ID3 unsynchronisation, escaping every 0xff with a zero byte
+func unsync(data []byte) []byte {
+	var out []byte
+	for _, b := range data {
+		out = append(out, b)
+		if b == 0xff {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
+// Picture data that has to survive unsynchronisation
+var backCoverData = append([]byte{0xff, 0xe0, 0xff, 0x00, 0xff}, testAudio(200)...)
+
+// Builds an MP3 with an unsynchronised ID3v2.3 tag that has an extended
+// header, followed by audio
+func id3v23Fixture(audio []byte) []byte {
+	var body []byte
+
+	// Extended header: size (excluding itself), flags, padding size
+	body = append(body, 0, 0, 0, 6, 0, 0, 0, 0, 0, 20)
+
+	body = append(body, id3v23Frame("TIT2", latin1("Old Title"))...)
+	body = append(body, id3v23Frame("TPE1", latin1("Old Artist"))...)
+	body = append(body, id3v23Frame("TYER", latin1("1990"))...)
+	body = append(body, id3v23Frame("TDAT", latin1("0101"))...)
+	body = append(body, id3v23Frame("TXXX", latin1("MyKey\x00MyValue"))...)
+	body = append(body, id3v23Frame("COMM", latin1("eng\x00Old comment"))...)
+	body = append(body, id3v23Frame("COMM", latin1("engiTunNORM\x00 00000001"))...)
+	body = append(body, id3v23Frame("APIC", apic("image/jpeg", id3PictureFront, []byte{0xff, 0xd8, 0xff, 0xe0, 1, 2, 3}))...)
+	body = append(body, id3v23Frame("APIC", apic("image/png", 4, backCoverData))...)
+	body = append(body, make([]byte, 20)...)
+
+	body = unsync(body)
+
+	tag := []byte{'I', 'D', '3', 3, 0, 0x80 | 0x40}
+	tag = append(tag, putSyncsafe(uint32(len(body)))...)
+	tag = append(tag, body...)
+	return append(tag, audio...)
+}
+
+// Builds an MP3 with an ID3v2.4 tag that has an extended header and a
+// front and back cover, the back one unsynchronised with a data length
+// indicator
+func id3v24Fixture(audio []byte) []byte {
+	var body []byte
+
+	// Extended header: size (including itself), one flag byte, no flags
+	body = append(body, 0, 0, 0, 6, 1, 0)
+
+	body = append(body, id3v24Frame("TIT2", 0, append([]byte{3}, "Old Title"...))...)
+	body = append(body, id3v24Frame("APIC", 0, apic("image/jpeg", id3PictureFront, []byte{0xff, 0xd8, 0xff, 0xe0}))...)
+
+	back := apic("image/png", 4, backCoverData)
+	data := append(putSyncsafe(uint32(len(back))), unsync(back)...)
+	body = append(body, id3v24Frame("APIC", id3FlagUnsync|id3FlagDataLength, data)...)
+
+	tag := []byte{'I', 'D', '3', 4, 0, 0x40}
+	tag = append(tag, putSyncsafe(uint32(len(body)))...)
+	tag = append(tag, body...)
+	return append(tag, audio...)
+}
+
+// Reads the ID3 tag and what follows it from a written file
+func readWrittenMP3(t *testing.T, path string) (*id3Tag, []byte) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(data, []byte{'I', 'D', '3', 4, 0}) {
+		t.Fatalf("file doesn't start with an ID3v2.4 tag: % x", data[:5])
+	}
+
+	tag, size, err := readID3(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to read written tag: %v", err)
+	}
+	return tag, data[size:]
+}
+
+// Counts a tag's frames with an ID
+func countFrames(tag *id3Tag, id string) int {
+	n := 0
+	for _, frame := range tag.frames {
+		if frame.id == id {
+			n++
+		}
+	}
+	return n
+}
+
+func TestMP3FromID3v23(t *testing.T) {
+	audio := testAudio(3000)
+	path := writeFixture(t, ".mp3", id3v23Fixture(audio))
+	cover := testCover(t)
+
+	if err := Write(path, Changes{Tags: &testTags, Cover: cover}); err != nil {
+		t.Fatalf("failed to write tags: %v", err)
+	}
+
+	tag, rest := readWrittenMP3(t, path)
+	if !bytes.Equal(rest, audio) {
+		t.Error("audio changed")
+	}
+
+	// Frames without a v2.4 equivalent go, renamed ones are converted, and
+	// the rest carries over
+	for id, want := range map[string]int{"TYER": 0, "TDAT": 0, "TDRC": 1, "TIT2": 1, "TXXX": 1, "COMM": 2, "APIC": 2} {
+		if got := countFrames(tag, id); got != want {
+			t.Errorf("found %d %s frames, want %d", got, id, want)
+		}
+	}
+
+	metadata, pics := readTags(t, path)
+	assertMetadata(t, metadata, testMetadata)
+
+	if front := findPicture(pics, playback.PictureFront); front == nil || !bytes.Equal(front.Data, cover.Data) {
+		t.Error("new front cover wasn't read back")
+	}
+	if back := findPicture(pics, playback.PictureBack); back == nil || !bytes.Equal(back.Data, backCoverData) {
+		t.Error("back cover didn't survive")
+	}
+}
+
+func TestMP3CoverOnlyKeepsTags(t *testing.T) {
+	audio := testAudio(1000)
+	path := writeFixture(t, ".mp3", id3v23Fixture(audio))
+
+	if err := Write(path, Changes{Cover: testCover(t)}); err != nil {
+		t.Fatalf("failed to write tags: %v", err)
+	}
+
+	_, rest := readWrittenMP3(t, path)
+	if !bytes.Equal(rest, audio) {
+		t.Error("audio changed")
+	}
+
+	metadata, _ := readTags(t, path)
+	assertMetadata(t, metadata, map[string]string{
+		"title":   "Old Title",
+		"artist":  "Old Artist",
+		"year":    "1990",
+		"comment": "Old comment",
+	})
+}
+
+func TestMP3FromID3v24RemoveCover(t *testing.T) {
+	audio := testAudio(2000)
+	path := writeFixture(t, ".mp3", id3v24Fixture(audio))
+
+	if err := Write(path, Changes{RemoveCover: true}); err != nil {
+		t.Fatalf("failed to write tags: %v", err)
+	}
+
+	tag, rest := readWrittenMP3(t, path)
+	if !bytes.Equal(rest, audio) {
+		t.Error("audio changed")
+	}
+
+	// The frame flags for unsync and the data length were undone
+	for _, frame := range tag.frames {
+		if frame.flags&(id3FlagUnsync|id3FlagDataLength) != 0 {
+			t.Errorf("%s frame still has flags %#x", frame.id, frame.flags)
+		}
+	}
+
+	metadata, pics := readTags(t, path)
+	assertMetadata(t, metadata, map[string]string{"title": "Old Title"})
+
+	if findPicture(pics, playback.PictureFront) != nil {
+		t.Error("front cover wasn't removed")
+	}
+	if back := findPicture(pics, playback.PictureBack); back == nil || !bytes.Equal(back.Data, backCoverData) {
+		t.Error("back cover didn't survive")
+	}
+}
+
+func TestMP3WithoutTag(t *testing.T) {
+	audio := testAudio(1500)
+	path := writeFixture(t, ".mp3", audio)
+
+	if err := Write(path, Changes{Tags: &testTags}); err != nil {
+		t.Fatalf("failed to write tags: %v", err)
+	}
+
+	_, rest := readWrittenMP3(t, path)
+	if !bytes.Equal(rest, audio) {
+		t.Error("audio changed")
+	}
+
+	metadata, _ := readTags(t, path)
+	assertMetadata(t, metadata, testMetadata)
+}
+
+func TestMP3ClearTags(t *testing.T) {
+	audio := testAudio(1000)
+	path := writeFixture(t, ".mp3", id3v23Fixture(audio))
+
+	if err := Write(path, Changes{Tags: &Tags{Title: "Only Title"}}); err != nil {
+		t.Fatalf("failed to write tags: %v", err)
+	}
+
+	tag, _ := readWrittenMP3(t, path)
+	for _, id := range []string{"TPE1", "TDRC"} {
+		if n := countFrames(tag, id); n != 0 {
+			t.Errorf("found %d %s frames after clearing", n, id)
+		}
+	}
+
+	// Only the comment without a description is ours to clear
+	if n := countFrames(tag, "COMM"); n != 1 {
+		t.Errorf("found %d COMM frames, want only iTunNORM", n)
+	}
+}
@@ -0,0 +1,245 @@
+package tagwriter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// Most segments in one Ogg page
+const maxOggSegments = 255
+
+// An Ogg page
+type oggPage struct {
+	headerType byte
+	granule    uint64
+	serial     uint32
+	sequence   uint32
+	segments   []byte // lacing values
+	body       []byte
+}
+
+// Header type flags
+const (
+	oggContinued = 0x01
+	oggFirst     = 0x02
+)
+
+// Reads the next page, returning io.EOF at the end of the stream
+func readOggPage(r io.Reader) (*oggPage, error) {
+	var header [27]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("truncated Ogg page")
+		}
+		return nil, err
+	}
+	if string(header[:4]) != "OggS" || header[4] != 0 {
+		return nil, errors.New("invalid Ogg page")
+	}
+
+	page := &oggPage{
+		headerType: header[5],
+		granule:    binary.LittleEndian.Uint64(header[6:14]),
+		serial:     binary.LittleEndian.Uint32(header[14:18]),
+		sequence:   binary.LittleEndian.Uint32(header[18:22]),
+		segments:   make([]byte, header[26]),
+	}
+	if _, err := io.ReadFull(r, page.segments); err != nil {
+		return nil, err
+	}
+
+	size := 0
+	for _, lacing := range page.segments {
+		size += int(lacing)
+	}
+	page.body = make([]byte, size)
+	if _, err := io.ReadFull(r, page.body); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// Encodes the page, computing its checksum
+func (p *oggPage) bytes() []byte {
+	var b bytes.Buffer
+	b.WriteString("OggS")
+	b.WriteByte(0)
+	b.WriteByte(p.headerType)
+	binary.Write(&b, binary.LittleEndian, p.granule)
+	binary.Write(&b, binary.LittleEndian, p.serial)
+	binary.Write(&b, binary.LittleEndian, p.sequence)
+	b.Write([]byte{0, 0, 0, 0}) // checksum, filled in below
+	b.WriteByte(byte(len(p.segments)))
+	b.Write(p.segments)
+	b.Write(p.body)
+
+	out := b.Bytes()
+	binary.LittleEndian.PutUint32(out[22:26], oggCRC(out))
+	return out
+}
+
+// Rewrites an Ogg Vorbis file's comment header. The comment and setup
+// headers are repaged, and every later page renumbered to follow them
+func rewriteOgg(src *os.File, dst io.Writer, changes Changes) error {
+	first, err := readOggPage(src)
+	if err != nil {
+		return err
+	}
+	if first.headerType&oggFirst == 0 || len(first.segments) != 1 || !bytes.HasPrefix(first.body, []byte("\x01vorbis")) {
+		return errors.New("not an Ogg Vorbis file")
+	}
+
+	// Collect the comment and setup packets, which may span several pages
+	var packets [][]byte
+	var packet []byte
+	for len(packets) < 2 {
+		page, err := readOggPage(src)
+		if err != nil {
+			return err
+		}
+		if page.serial != first.serial {
+			return errors.New("multiplexed Ogg files aren't supported")
+		}
+
+		offset := 0
+		for _, lacing := range page.segments {
+			packet = append(packet, page.body[offset:offset+int(lacing)]...)
+			offset += int(lacing)
+			if lacing < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+
+		// Audio must start on a fresh page
+		if len(packets) == 2 && packet != nil {
+			return errors.New("invalid Ogg Vorbis headers")
+		}
+	}
+
+	comment := packets[0]
+	if !bytes.HasPrefix(comment, []byte("\x03vorbis")) || !bytes.HasPrefix(packets[1], []byte("\x05vorbis")) {
+		return errors.New("invalid Ogg Vorbis headers")
+	}
+
+	vc, err := parseVorbisComments(comment[7:])
+	if err != nil {
+		return err
+	}
+	vc.apply(changes, true)
+
+	newComment := append([]byte("\x03vorbis"), vc.bytes()...)
+	newComment = append(newComment, 1) // framing bit
+
+	if _, err := dst.Write(first.bytes()); err != nil {
+		return err
+	}
+
+	headers := paginate(first.serial, 1, [][]byte{newComment, packets[1]})
+	for _, page := range headers {
+		if _, err := dst.Write(page.bytes()); err != nil {
+			return err
+		}
+	}
+
+	// Renumber the audio pages
+	sequence := uint32(1 + len(headers))
+	for {
+		page, err := readOggPage(src)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if page.serial != first.serial {
+			return errors.New("multiplexed Ogg files aren't supported")
+		}
+
+		page.sequence = sequence
+		sequence++
+		if _, err := dst.Write(page.bytes()); err != nil {
+			return err
+		}
+	}
+}
+
+// Lays packets out in pages, starting at the given sequence number. Each
+// page holding the end of a packet gets granule position 0, as headers do
+func paginate(serial uint32, sequence uint32, packets [][]byte) []*oggPage {
+	var pages []*oggPage
+	page := &oggPage{serial: serial, sequence: sequence}
+	continued := false
+
+	for _, packet := range packets {
+		for offset := 0; ; {
+			if len(page.segments) == maxOggSegments {
+				// A page no packet ends on has no granule position
+				if page.granule == 0 && !endsPacket(page) {
+					page.granule = ^uint64(0)
+				}
+				pages = append(pages, page)
+				sequence++
+				page = &oggPage{serial: serial, sequence: sequence}
+				if continued {
+					page.headerType = oggContinued
+				}
+			}
+
+			n := min(len(packet)-offset, 255)
+			page.segments = append(page.segments, byte(n))
+			page.body = append(page.body, packet[offset:offset+n]...)
+			offset += n
+
+			// A packet that's a multiple of 255 long ends with a 0 segment
+			continued = n == 255
+			if !continued {
+				break
+			}
+		}
+	}
+
+	if !endsPacket(page) {
+		page.granule = ^uint64(0)
+	}
+	return append(pages, page)
+}
+
+// Reports whether a packet ends on this page
+func endsPacket(page *oggPage) bool {
+	for _, lacing := range page.segments {
+		if lacing < 255 {
+			return true
+		}
+	}
+	return false
+}
+
+// Ogg's CRC-32 (polynomial 0x04c11db7, not reflected)
+var oggCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for range 8 {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+func oggCRC(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
@@ -0,0 +1,278 @@
+package tagwriter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"openturntable/playback"
+)
+
+// Serial number of the test stream
+const testSerial = 0x1234
+
+// Builds a Vorbis identification header for 44.1 kHz stereo
+func vorbisIDHeader() []byte {
+	b := []byte("\x01vorbis")
+	b = binary.LittleEndian.AppendUint32(b, 0) // version
+	b = append(b, 2)                           // channels
+	b = binary.LittleEndian.AppendUint32(b, 44100)
+	b = append(b, make([]byte, 12)...) // bitrates
+	return append(b, 0xb8, 1)          // block sizes, framing
+}
+
+// Builds a Vorbis comment header
+func vorbisCommentHeader(comments ...string) []byte {
+	vc := &vorbisComments{vendor: "Xiph.Org libVorbis I 20200704", comments: comments}
+	return append(append([]byte("\x03vorbis"), vc.bytes()...), 1)
+}
+
+// Lays packets out in pages the simple way: as many segments per page as
+// fit, with granule position 0
+func testPages(sequence uint32, packets [][]byte) []*oggPage {
+	var segments []byte
+	var body []byte
+	for _, packet := range packets {
+		n := len(packet)
+		for ; n >= 255; n -= 255 {
+			segments = append(segments, 255)
+		}
+		segments = append(segments, byte(n))
+		body = append(body, packet...)
+	}
+
+	var pages []*oggPage
+	continued := false
+	for len(segments) > 0 {
+		count := min(len(segments), maxOggSegments)
+		size := 0
+		for _, lacing := range segments[:count] {
+			size += int(lacing)
+		}
+
+		page := &oggPage{serial: testSerial, sequence: sequence, segments: segments[:count], body: body[:size]}
+		if continued {
+			page.headerType = oggContinued
+		}
+		continued = segments[count-1] == 255
+
+		pages = append(pages, page)
+		segments, body = segments[count:], body[size:]
+		sequence++
+	}
+	return pages
+}
+
+// Computes the Ogg CRC bit by bit, independently of the table in ogg.go
+func slowOggCRC(data []byte) uint32 {
+	var crc uint32
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for range 8 {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// Reads every page of a written file, checking each one's CRC
+func readWrittenOgg(t *testing.T, path string) []*oggPage {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pages []*oggPage
+	r := bytes.NewReader(data)
+	for {
+		start := len(data) - r.Len()
+		page, err := readOggPage(r)
+		if err == io.EOF {
+			return pages
+		}
+		if err != nil {
+			t.Fatalf("failed to read page %d: %v", len(pages), err)
+		}
+
+		raw := slices.Clone(data[start : len(data)-r.Len()])
+		stored := binary.LittleEndian.Uint32(raw[22:26])
+		copy(raw[22:26], []byte{0, 0, 0, 0})
+		if crc := slowOggCRC(raw); crc != stored {
+			t.Errorf("page %d has CRC %08x, want %08x", len(pages), stored, crc)
+		}
+
+		pages = append(pages, page)
+	}
+}
+
+// Joins pages' segments back into packets
+func oggPackets(pages []*oggPage) [][]byte {
+	var packets [][]byte
+	var packet []byte
+	for _, page := range pages {
+		offset := 0
+		for _, lacing := range page.segments {
+			packet = append(packet, page.body[offset:offset+int(lacing)]...)
+			offset += int(lacing)
+			if lacing < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+	}
+	return packets
+}
+
+// Builds an Ogg Vorbis file with the given comments. Returns the file and
+// its audio pages
+func oggFixture(comments ...string) ([]byte, []*oggPage) {
+	first := &oggPage{headerType: oggFirst, serial: testSerial, segments: []byte{30}, body: vorbisIDHeader()}
+	setup := append([]byte("\x05vorbis"), testAudio(600)...)
+	headers := testPages(1, [][]byte{vorbisCommentHeader(comments...), setup})
+
+	// The second audio packet spans the first two audio pages
+	sequence := uint32(1 + len(headers))
+	audio := []*oggPage{
+		{serial: testSerial, sequence: sequence, granule: 4096, segments: []byte{200, 255}, body: testAudio(455)},
+		{headerType: oggContinued, serial: testSerial, sequence: sequence + 1, granule: 8192, segments: []byte{100, 255, 30}, body: testAudio(385)},
+		{headerType: 0x04, serial: testSerial, sequence: sequence + 2, granule: 12000, segments: []byte{77}, body: testAudio(77)},
+	}
+
+	var data []byte
+	for _, page := range slices.Concat([]*oggPage{first}, headers, audio) {
+		data = append(data, page.bytes()...)
+	}
+	return data, audio
+}
+
+// Checks the layout of a written file: numbering, header pages, and that
+// the identification header and audio pages are untouched. Returns the
+// header packets
+func checkOggPages(t *testing.T, pages []*oggPage, audio []*oggPage) [][]byte {
+	t.Helper()
+
+	for i, page := range pages {
+		if page.sequence != uint32(i) || page.serial != testSerial {
+			t.Errorf("page %d has sequence %d and serial %x", i, page.sequence, page.serial)
+		}
+	}
+
+	if len(pages) < 1+1+len(audio) {
+		t.Fatalf("only %d pages", len(pages))
+	}
+	if !bytes.Equal(pages[0].body, vorbisIDHeader()) || pages[0].headerType != oggFirst {
+		t.Error("identification page changed")
+	}
+
+	headers := pages[1 : len(pages)-len(audio)]
+	for i, page := range headers {
+		continued := i > 0 && headers[i-1].segments[len(headers[i-1].segments)-1] == 255
+		if (page.headerType&oggContinued != 0) != continued {
+			t.Errorf("header page %d has continued flag %v", i, !continued)
+		}
+
+		// Only pages no packet ends on have no granule position
+		want := uint64(0)
+		if !endsPacket(page) {
+			want = ^uint64(0)
+		}
+		if page.granule != want {
+			t.Errorf("header page %d has granule %x, want %x", i, page.granule, want)
+		}
+	}
+
+	for i, page := range pages[len(pages)-len(audio):] {
+		want := audio[i]
+		if page.headerType != want.headerType || page.granule != want.granule ||
+			!bytes.Equal(page.segments, want.segments) || !bytes.Equal(page.body, want.body) {
+			t.Errorf("audio page %d changed", i)
+		}
+	}
+
+	packets := oggPackets(headers)
+	if len(packets) != 2 {
+		t.Fatalf("found %d header packets, want 2", len(packets))
+	}
+	return packets
+}
+
+func TestOggCommentSpanningPages(t *testing.T) {
+	lyrics := "LYRICS=" + strings.Repeat("la ", 30000)
+	fixture, audio := oggFixture("TITLE=Old Title", lyrics, "DATE=1990")
+	path := writeFixture(t, ".ogg", fixture)
+	cover := testCover(t)
+
+	if err := Write(path, Changes{Tags: &testTags, Cover: cover}); err != nil {
+		t.Fatalf("failed to write tags: %v", err)
+	}
+
+	pages := readWrittenOgg(t, path)
+	packets := checkOggPages(t, pages, audio)
+
+	// Over 64 KiB of comments can't fit one page
+	if headerPages := len(pages) - 1 - len(audio); headerPages < 2 {
+		t.Errorf("comments took %d pages", headerPages)
+	}
+
+	if !bytes.HasPrefix(packets[1], []byte("\x05vorbis")) || !bytes.Equal(packets[1][7:], testAudio(600)) {
+		t.Error("setup header changed")
+	}
+
+	comment := packets[0]
+	if !bytes.HasPrefix(comment, []byte("\x03vorbis")) || comment[len(comment)-1] != 1 {
+		t.Fatal("comment header is malformed")
+	}
+	vc, err := parseVorbisComments(comment[7 : len(comment)-1])
+	if err != nil {
+		t.Fatalf("failed to parse comments: %v", err)
+	}
+	if !slices.Contains(vc.comments, lyrics) {
+		t.Error("lyrics weren't kept")
+	}
+
+	metadata, pics := readTags(t, path)
+	assertMetadata(t, metadata, testMetadata)
+	if front := findPicture(pics, playback.PictureFront); front == nil || !bytes.Equal(front.Data, cover.Data) {
+		t.Error("new front cover wasn't read back")
+	}
+}
+
+func TestOggCommentShrinkingToOnePage(t *testing.T) {
+	fixture, audio := oggFixture("TITLE=Old Title", "COMMENT="+strings.Repeat("x", 100000))
+	path := writeFixture(t, ".ogg", fixture)
+
+	if err := Write(path, Changes{Tags: &testTags}); err != nil {
+		t.Fatalf("failed to write tags: %v", err)
+	}
+
+	// Identification, one header page, then the audio renumbered down
+	pages := readWrittenOgg(t, path)
+	checkOggPages(t, pages, audio)
+	if len(pages) != 2+len(audio) {
+		t.Errorf("file has %d pages, want %d", len(pages), 2+len(audio))
+	}
+
+	metadata, _ := readTags(t, path)
+	assertMetadata(t, metadata, testMetadata)
+}
+
+func TestPaginatePacketOfFullSegments(t *testing.T) {
+	// A packet that's a multiple of 255 long needs a 0 segment to end it
+	packet := testAudio(255 * 3)
+	pages := paginate(testSerial, 1, [][]byte{packet, []byte("next")})
+
+	packets := oggPackets(pages)
+	if len(packets) != 2 || !bytes.Equal(packets[0], packet) || string(packets[1]) != "next" {
+		t.Errorf("packets didn't survive paging: %d packets", len(packets))
+	}
+}
@@ -0,0 +1,140 @@
+package tagwriter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A picture to embed as a file's front cover
+type Picture struct {
+	MIMEType string
+	Data     []byte
+}
+
+// Text tags to write. Every field is written: an empty string (or a zero
+// number) removes the tag
+type Tags struct {
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	Genre       string
+	Year        string
+	Composer    string
+	Comment     string
+	Track       int64
+	TrackTotal  int64
+	Disc        int64
+	DiscTotal   int64
+}
+
+// Changes to make to a file's tags. Anything not mentioned is kept as it is
+type Changes struct {
+	// Replaces the text tags, nil to keep them
+	Tags *Tags
+	// Replaces the front cover, nil to keep it
+	Cover *Picture
+	// Removes the front cover (ignored if Cover is set)
+	RemoveCover bool
+}
+
+// Reports whether the changes touch the cover
+func (c Changes) coverChanged() bool {
+	return c.Cover != nil || c.RemoveCover
+}
+
+// Formats a track or disc number, with the total if there is one. A zero
+// number formats as "" so the tag is removed
+func numberOf(n int64, total int64) string {
+	switch {
+	case n <= 0:
+		return ""
+	case total > 0:
+		return fmt.Sprintf("%d/%d", n, total)
+	default:
+		return strconv.FormatInt(n, 10)
+	}
+}
+
+// Formats a number, "" for zero
+func number(n int64) string {
+	if n <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// Vendor string for Vorbis comment blocks this package creates
+const vendor = "OpenTurntable"
+
+// Extra space left in rewritten tags, so later edits are less likely to
+// have to move the audio data
+const tagPadding = 4096
+
+// Rewrites a file's tags. The new file is written next to the original and
+// renamed over it once complete, so a failure never leaves a damaged file
+func Write(filePath string, changes Changes) error {
+	var rewrite func(src *os.File, dst io.Writer, changes Changes) error
+
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".mp3":
+		rewrite = rewriteMP3
+	case ".flac":
+		rewrite = rewriteFLAC
+	case ".ogg":
+		rewrite = rewriteOgg
+	case ".wav":
+		rewrite = rewriteWAV
+	default:
+		return fmt.Errorf("can't write tags to %s", filepath.Base(filePath))
+	}
+
+	src, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write tags: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := rewrite(src, tmp, changes); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write tags to %s: %w", filepath.Base(filePath), err)
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write tags: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write tags: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write tags: %w", err)
+	}
+
+	// Windows can't replace a file that's open (e.g. being played)
+	src.Close()
+	if err := os.Rename(tmp.Name(), filePath); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", filepath.Base(filePath), err)
+	}
+
+	return nil
+}
+
+// Returned for files whose existing tags can't be safely rewritten
+var errUnsupported = errors.New("unsupported tag format")
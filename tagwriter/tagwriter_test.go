@@ -0,0 +1,166 @@
+package tagwriter
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"openturntable/playback"
+)
+
+// Tags written by the round-trip tests
+var testTags = Tags{
+	Title:       "Tïtle",
+	Artist:      "Artist",
+	Album:       "Album",
+	AlbumArtist: "Various",
+	Genre:       "Jazz",
+	Year:        "2001",
+	Composer:    "Composer",
+	Comment:     "Nice",
+	Track:       3,
+	TrackTotal:  12,
+	Disc:        1,
+	DiscTotal:   2,
+}
+
+// What playback.ReadTags should give back for testTags
+var testMetadata = map[string]string{
+	"title":       "Tïtle",
+	"artist":      "Artist",
+	"album":       "Album",
+	"albumartist": "Various",
+	"genre":       "Jazz",
+	"year":        "2001",
+	"composer":    "Composer",
+	"comment":     "Nice",
+	"track":       "3",
+	"tracktotal":  "12",
+	"disc":        "1",
+	"disctotal":   "2",
+}
+
+// Makes a small PNG to embed as a cover
+func testCover(t *testing.T) *Picture {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	for i := range 40 {
+		img.Set(i, i, color.RGBA{255, 0, 0, 255})
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return &Picture{MIMEType: "image/png", Data: buf.Bytes()}
+}
+
+// Makes stand-in audio data. It includes 0xff bytes so anything that
+// unsynchronises or escapes data by mistake shows up
+func testAudio(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(data)
+	for i := 0; i < n; i += 50 {
+		data[i] = 0xff
+	}
+	return data
+}
+
+// Writes a fixture to a temporary file with the given extension
+func writeFixture(t *testing.T, ext string, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "fixture"+ext)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Reads a file back the way the library does
+func readTags(t *testing.T, path string) (map[string]string, []playback.Picture) {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	return playback.ReadTags(f)
+}
+
+// Checks every field of want was read back
+func assertMetadata(t *testing.T, got map[string]string, want map[string]string) {
+	t.Helper()
+
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s is %q, want %q", key, got[key], value)
+		}
+	}
+}
+
+// Finds the picture of a kind
+func findPicture(pics []playback.Picture, kind string) *playback.Picture {
+	for i := range pics {
+		if pics[i].Kind == kind {
+			return &pics[i]
+		}
+	}
+	return nil
+}
+
+func TestWriteUnsupportedFile(t *testing.T) {
+	path := writeFixture(t, ".aac", []byte("not really"))
+	if err := Write(path, Changes{Tags: &testTags}); err == nil {
+		t.Error("writing tags to an .aac file succeeded")
+	}
+}
+
+func TestWriteKeepsFileOnError(t *testing.T) {
+	original := []byte("fLaC but not really")
+	path := writeFixture(t, ".flac", original)
+
+	if err := Write(path, Changes{Tags: &testTags}); err == nil {
+		t.Fatal("writing tags to a broken FLAC file succeeded")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, original) {
+		t.Error("a failed write changed the file")
+	}
+
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("found %d files next to the fixture, want 1", len(entries))
+	}
+}
+
+func TestNumberOf(t *testing.T) {
+	tests := []struct {
+		n, total int64
+		want     string
+	}{
+		{0, 0, ""},
+		{0, 12, ""},
+		{3, 0, "3"},
+		{3, 12, "3/12"},
+	}
+
+	for _, test := range tests {
+		if got := numberOf(test.n, test.total); got != test.want {
+			t.Errorf("numberOf(%d, %d) = %q, want %q", test.n, test.total, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package tagwriter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// Vorbis comments, as used by FLAC and Ogg Vorbis
+type vorbisComments struct {
+	vendor   string
+	comments []string // "KEY=value"
+}
+
+// Comment holding a base64 encoded FLAC PICTURE block
+const vorbisPictureKey = "METADATA_BLOCK_PICTURE"
+
+// Parses a Vorbis comment block (without the Ogg packet header or framing
+// bit)
+func parseVorbisComments(data []byte) (*vorbisComments, error) {
+	r := bytes.NewReader(data)
+	readString := func() (string, error) {
+		var n uint32
+		if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+			return "", err
+		}
+		if int64(n) > int64(r.Len()) {
+			return "", errors.New("invalid Vorbis comment")
+		}
+		b := make([]byte, n)
+		_, err := r.Read(b)
+		return string(b), err
+	}
+
+	vendor, err := readString()
+	if err != nil {
+		return nil, err
+	}
+
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+
+	vc := &vorbisComments{vendor: vendor}
+	for range count {
+		comment, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		vc.comments = append(vc.comments, comment)
+	}
+
+	return vc, nil
+}
+
+// Encodes the comments (without the Ogg packet header or framing bit)
+func (vc *vorbisComments) bytes() []byte {
+	var b bytes.Buffer
+	writeString := func(s string) {
+		binary.Write(&b, binary.LittleEndian, uint32(len(s)))
+		b.WriteString(s)
+	}
+
+	writeString(vc.vendor)
+	binary.Write(&b, binary.LittleEndian, uint32(len(vc.comments)))
+	for _, comment := range vc.comments {
+		writeString(comment)
+	}
+
+	return b.Bytes()
+}
+
+// Removes every comment matching drop, given its upper-cased key and value
+func (vc *vorbisComments) remove(drop func(key string, value string) bool) {
+	kept := vc.comments[:0]
+	for _, comment := range vc.comments {
+		key, value, _ := strings.Cut(comment, "=")
+		if !drop(strings.ToUpper(key), value) {
+			kept = append(kept, comment)
+		}
+	}
+	vc.comments = kept
+}
+
+// A Vorbis comment field tags are written to. The first key is written,
+// the others are names some apps use for the same field and are removed
+type vorbisField struct {
+	keys  []string
+	value string
+}
+
+// The Vorbis comment fields tags are written to, with their values
+func vorbisFields(tags Tags) []vorbisField {
+	return []vorbisField{
+		{[]string{"TITLE"}, tags.Title},
+		{[]string{"ARTIST"}, tags.Artist},
+		{[]string{"ALBUM"}, tags.Album},
+		{[]string{"ALBUMARTIST", "ALBUM ARTIST"}, tags.AlbumArtist},
+		{[]string{"GENRE"}, tags.Genre},
+		{[]string{"DATE", "YEAR"}, tags.Year},
+		{[]string{"COMPOSER"}, tags.Composer},
+		{[]string{"COMMENT", "DESCRIPTION"}, tags.Comment},
+		{[]string{"TRACKNUMBER"}, number(tags.Track)},
+		{[]string{"TRACKTOTAL", "TOTALTRACKS"}, number(tags.TrackTotal)},
+		{[]string{"DISCNUMBER"}, number(tags.Disc)},
+		{[]string{"DISCTOTAL", "TOTALDISCS"}, number(tags.DiscTotal)},
+	}
+}
+
+// Applies changes to the comments. Pictures are stored as comments, which
+// Ogg Vorbis needs (FLAC uses PICTURE blocks instead)
+func (vc *vorbisComments) apply(changes Changes, pictures bool) {
+	if changes.Tags != nil {
+		fields := vorbisFields(*changes.Tags)
+
+		drop := make(map[string]bool)
+		for _, field := range fields {
+			for _, key := range field.keys {
+				drop[key] = true
+			}
+		}
+		vc.remove(func(key string, value string) bool { return drop[key] })
+
+		var comments []string
+		for _, field := range fields {
+			if field.value != "" {
+				comments = append(comments, field.keys[0]+"="+field.value)
+			}
+		}
+		vc.comments = append(comments, vc.comments...)
+	}
+
+	if pictures && changes.coverChanged() {
+		vc.remove(func(key string, value string) bool {
+			if key != vorbisPictureKey {
+				return false
+			}
+			data, err := base64.StdEncoding.DecodeString(value)
+			if err != nil || len(data) < 4 {
+				return false
+			}
+			kind := binary.BigEndian.Uint32(data)
+			return kind == id3PictureFront || kind == id3PictureOther
+		})
+	}
+
+	if pictures && changes.Cover != nil {
+		block := flacPictureBlock(*changes.Cover)
+		vc.comments = append(vc.comments, vorbisPictureKey+"="+base64.StdEncoding.EncodeToString(block))
+	}
+}
@@ -0,0 +1,268 @@
+package tagwriter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A RIFF chunk. The audio data isn't read into memory, only its position
+type riffChunk struct {
+	id     string
+	data   []byte
+	offset int64 // where the data starts in the source, for the "data" chunk
+	size   uint32
+}
+
+// Rewrites a WAV file's ID3 chunk (which is where tags and pictures go in
+// WAV files), keeping every other chunk as it is
+func rewriteWAV(src *os.File, dst io.Writer, changes Changes) error {
+	var header [12]byte
+	if _, err := io.ReadFull(src, header[:]); err != nil {
+		return err
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return errors.New("not a WAV file")
+	}
+
+	var chunks []riffChunk
+	offset := int64(12)
+	for {
+		var chunkHeader [8]byte
+		if _, err := io.ReadFull(src, chunkHeader[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			// Some writers leave a few stray bytes at the end
+			if err == io.ErrUnexpectedEOF && len(chunks) > 0 {
+				break
+			}
+			return err
+		}
+		offset += 8
+
+		chunk := riffChunk{
+			id:     string(chunkHeader[:4]),
+			size:   binary.LittleEndian.Uint32(chunkHeader[4:8]),
+			offset: offset,
+		}
+		padded := int64(chunk.size) + int64(chunk.size%2)
+
+		if chunk.id == "data" {
+			if _, err := src.Seek(padded, io.SeekCurrent); err != nil {
+				return err
+			}
+		} else {
+			chunk.data = make([]byte, chunk.size)
+			if _, err := io.ReadFull(src, chunk.data); err != nil {
+				return err
+			}
+			if chunk.size%2 == 1 {
+				// The pad byte may be missing at the very end of the file
+				src.Read(make([]byte, 1))
+			}
+		}
+
+		chunks = append(chunks, chunk)
+		offset += padded
+	}
+
+	// Find or add the ID3 chunk
+	id3Index := -1
+	for i, chunk := range chunks {
+		if chunk.id == "id3 " || chunk.id == "ID3 " {
+			id3Index = i
+			break
+		}
+	}
+	created := id3Index < 0
+	if created {
+		chunks = append(chunks, riffChunk{id: "id3 "})
+		id3Index = len(chunks) - 1
+	}
+
+	tag, _, err := readID3(bytes.NewReader(chunks[id3Index].data))
+	if err != nil {
+		return err
+	}
+
+	// Readers stop looking at the INFO chunk once there's an ID3 chunk, so
+	// a new one starts out with the INFO tags
+	if created {
+		if tags, ok := riffInfoTags(chunks); ok {
+			tag.apply(Changes{Tags: &tags})
+		}
+	}
+	tag.apply(changes)
+	chunks[id3Index].data = tag.bytes(0)
+	chunks[id3Index].size = uint32(len(chunks[id3Index].data))
+
+	if changes.Tags != nil {
+		chunks = applyRIFFInfo(chunks, *changes.Tags)
+	}
+
+	riffSize := uint32(4)
+	for _, chunk := range chunks {
+		riffSize += 8 + chunk.size + chunk.size%2
+	}
+
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, riffSize)
+	b.WriteString("WAVE")
+	if _, err := dst.Write(b.Bytes()); err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		var chunkHeader [8]byte
+		copy(chunkHeader[:4], chunk.id)
+		binary.LittleEndian.PutUint32(chunkHeader[4:], chunk.size)
+		if _, err := dst.Write(chunkHeader[:]); err != nil {
+			return err
+		}
+
+		if chunk.id == "data" {
+			_, err = io.Copy(dst, io.NewSectionReader(src, chunk.offset, int64(chunk.size)))
+		} else {
+			_, err = dst.Write(chunk.data)
+		}
+		if err != nil {
+			return err
+		}
+
+		if chunk.size%2 == 1 {
+			if _, err := dst.Write([]byte{0}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// The RIFF INFO items tags are written to, with their values. INFO has no
+// album artist, and no agreed field for composers
+func riffInfoItems(tags Tags) [][2]string {
+	return [][2]string{
+		{"INAM", tags.Title},
+		{"IART", tags.Artist},
+		{"IPRD", tags.Album},
+		{"IGNR", tags.Genre},
+		{"ICRD", tags.Year},
+		{"ICMT", tags.Comment},
+		{"ITRK", number(tags.Track)},
+	}
+}
+
+// Reads the tags in a LIST INFO chunk, if there is one
+func riffInfoTags(chunks []riffChunk) (Tags, bool) {
+	index := slices.IndexFunc(chunks, isRIFFInfo)
+	if index < 0 {
+		return Tags{}, false
+	}
+
+	var tags Tags
+	for _, item := range parseRIFFInfo(chunks[index].data[4:]) {
+		switch item[0] {
+		case "INAM":
+			tags.Title = item[1]
+		case "IART":
+			tags.Artist = item[1]
+		case "IPRD":
+			tags.Album = item[1]
+		case "IGNR":
+			tags.Genre = item[1]
+		case "ICRD":
+			tags.Year = item[1]
+		case "ICMT":
+			tags.Comment = item[1]
+		case "ITRK":
+			track, total, _ := strings.Cut(item[1], "/")
+			tags.Track, _ = strconv.ParseInt(strings.TrimSpace(track), 10, 64)
+			tags.TrackTotal, _ = strconv.ParseInt(strings.TrimSpace(total), 10, 64)
+		}
+	}
+
+	return tags, true
+}
+
+// Reports whether a chunk is a LIST INFO chunk
+func isRIFFInfo(chunk riffChunk) bool {
+	return chunk.id == "LIST" && bytes.HasPrefix(chunk.data, []byte("INFO"))
+}
+
+// Writes tags to the LIST INFO chunk too, for players that don't read ID3
+// chunks. Items the tags don't cover are kept. A new chunk goes before the
+// audio data
+func applyRIFFInfo(chunks []riffChunk, tags Tags) []riffChunk {
+	index := slices.IndexFunc(chunks, isRIFFInfo)
+
+	var items [][2]string
+	if index >= 0 {
+		items = parseRIFFInfo(chunks[index].data[4:])
+	}
+
+	for _, item := range riffInfoItems(tags) {
+		items = slices.DeleteFunc(items, func(i [2]string) bool { return i[0] == item[0] })
+	}
+	var written [][2]string
+	for _, item := range riffInfoItems(tags) {
+		if item[1] != "" {
+			written = append(written, item)
+		}
+	}
+	items = append(written, items...)
+
+	if len(items) == 0 {
+		if index >= 0 {
+			chunks = slices.Delete(chunks, index, index+1)
+		}
+		return chunks
+	}
+
+	var b bytes.Buffer
+	b.WriteString("INFO")
+	for _, item := range items {
+		value := append([]byte(item[1]), 0)
+		b.WriteString(item[0])
+		binary.Write(&b, binary.LittleEndian, uint32(len(value)))
+		b.Write(value)
+		if len(value)%2 == 1 {
+			b.WriteByte(0)
+		}
+	}
+	chunk := riffChunk{id: "LIST", data: b.Bytes(), size: uint32(b.Len())}
+
+	if index >= 0 {
+		chunks[index] = chunk
+		return chunks
+	}
+
+	data := slices.IndexFunc(chunks, func(c riffChunk) bool { return c.id == "data" })
+	if data < 0 {
+		return append(chunks, chunk)
+	}
+	return slices.Insert(chunks, data, chunk)
+}
+
+// Parses the items of a LIST INFO chunk (after "INFO") as ID and text
+func parseRIFFInfo(data []byte) [][2]string {
+	var items [][2]string
+	for len(data) >= 8 {
+		id := string(data[:4])
+		size := int(binary.LittleEndian.Uint32(data[4:8]))
+		if size > len(data)-8 {
+			break
+		}
+
+		value := string(bytes.TrimRight(data[8:8+size], "\x00"))
+		items = append(items, [2]string{id, value})
+		data = data[min(8+size+size%2, len(data)):]
+	}
+	return items
+}
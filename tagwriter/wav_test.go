@@ -0,0 +1,207 @@
+package tagwriter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"slices"
+	"testing"
+
+	"openturntable/playback"
+)
+
+// A PCM "fmt " chunk body for 44.1 kHz stereo 16 bit audio
+var testWAVFormat = []byte{
+	1, 0, 2, 0, // PCM, stereo
+	0x44, 0xac, 0, 0, // 44100 Hz
+	0x10, 0xb1, 2, 0, // bytes per second
+	4, 0, 16, 0, // block align, bits per sample
+}
+
+// Builds a RIFF chunk, padded to an even length unless pad is false
+func riffChunkBytes(id string, data []byte, pad bool) []byte {
+	b := binary.LittleEndian.AppendUint32([]byte(id), uint32(len(data)))
+	b = append(b, data...)
+	if pad && len(data)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// Builds a LIST INFO chunk body from ID and text pairs
+func riffInfoData(items ...string) []byte {
+	b := []byte("INFO")
+	for i := 0; i < len(items); i += 2 {
+		b = append(b, riffChunkBytes(items[i], append([]byte(items[i+1]), 0), true)...)
+	}
+	return b
+}
+
+// Builds a WAV file from chunks
+func wavFixture(chunks ...[]byte) []byte {
+	body := slices.Concat(append([][]byte{[]byte("WAVE")}, chunks...)...)
+	return append(binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body))), body...)
+}
+
+// Splits a written WAV file into its chunks, checking the RIFF size and
+// that every odd chunk is padded
+func readWrittenWAV(t *testing.T, path string) []riffChunk {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		t.Fatal("not a WAV file")
+	}
+	if size := binary.LittleEndian.Uint32(data[4:8]); int(size) != len(data)-8 {
+		t.Errorf("RIFF size is %d, file has %d bytes after it", size, len(data)-8)
+	}
+
+	var chunks []riffChunk
+	rest := data[12:]
+	for len(rest) > 0 {
+		if len(rest) < 8 {
+			t.Fatalf("%d stray bytes at the end", len(rest))
+		}
+		size := binary.LittleEndian.Uint32(rest[4:8])
+		padded := int(size + size%2)
+		if padded > len(rest)-8 {
+			t.Fatalf("chunk %q runs past the end of the file", rest[:4])
+		}
+
+		chunks = append(chunks, riffChunk{id: string(rest[:4]), data: rest[8 : 8+size], size: size})
+		rest = rest[8+padded:]
+	}
+	return chunks
+}
+
+// Finds a chunk by ID
+func findChunk(t *testing.T, chunks []riffChunk, id string) riffChunk {
+	t.Helper()
+
+	for _, chunk := range chunks {
+		if chunk.id == id {
+			return chunk
+		}
+	}
+	t.Fatalf("no %q chunk", id)
+	return riffChunk{}
+}
+
+// Lists chunk IDs in order
+func chunkIDs(chunks []riffChunk) []string {
+	var ids []string
+	for _, chunk := range chunks {
+		ids = append(ids, chunk.id)
+	}
+	return ids
+}
+
+func TestWAVOddChunks(t *testing.T) {
+	audio := testAudio(1001)
+	junk := []byte{1, 2, 3}
+
+	// The odd data chunk ends the file without its pad byte, as some
+	// writers leave it
+	path := writeFixture(t, ".wav", wavFixture(
+		riffChunkBytes("fmt ", testWAVFormat, true),
+		riffChunkBytes("LIST", riffInfoData("INAM", "Old Title", "IART", "Old Artist", "ISFT", "Lavf60"), true),
+		riffChunkBytes("junk", junk, true),
+		riffChunkBytes("data", audio, false),
+	))
+	cover := testCover(t)
+
+	if err := Write(path, Changes{Tags: &testTags, Cover: cover}); err != nil {
+		t.Fatalf("failed to write tags: %v", err)
+	}
+
+	chunks := readWrittenWAV(t, path)
+	if ids := chunkIDs(chunks); !slices.Equal(ids, []string{"fmt ", "LIST", "junk", "data", "id3 "}) {
+		t.Errorf("chunks are %q", ids)
+	}
+
+	if !bytes.Equal(findChunk(t, chunks, "data").data, audio) {
+		t.Error("audio changed")
+	}
+	if !bytes.Equal(findChunk(t, chunks, "fmt ").data, testWAVFormat) {
+		t.Error("format changed")
+	}
+	if !bytes.Equal(findChunk(t, chunks, "junk").data, junk) {
+		t.Error("odd chunk changed")
+	}
+
+	info := parseRIFFInfo(findChunk(t, chunks, "LIST").data[4:])
+	for _, want := range [][2]string{{"INAM", "Tïtle"}, {"IART", "Artist"}, {"ICRD", "2001"}, {"ITRK", "3"}, {"ISFT", "Lavf60"}} {
+		if !slices.Contains(info, want) {
+			t.Errorf("INFO is missing %v: %v", want, info)
+		}
+	}
+
+	metadata, pics := readTags(t, path)
+	assertMetadata(t, metadata, testMetadata)
+	if front := findPicture(pics, playback.PictureFront); front == nil || !bytes.Equal(front.Data, cover.Data) {
+		t.Error("new front cover wasn't read back")
+	}
+}
+
+func TestWAVCoverKeepsInfoTags(t *testing.T) {
+	audio := testAudio(2000)
+	path := writeFixture(t, ".wav", wavFixture(
+		riffChunkBytes("fmt ", testWAVFormat, true),
+		riffChunkBytes("LIST", riffInfoData("INAM", "Old Title", "IART", "Old Artist", "IPRD", "Old Album", "ITRK", "4/9"), true),
+		riffChunkBytes("data", audio, true),
+	))
+
+	if err := Write(path, Changes{Cover: testCover(t)}); err != nil {
+		t.Fatalf("failed to write tags: %v", err)
+	}
+
+	chunks := readWrittenWAV(t, path)
+	if !bytes.Equal(findChunk(t, chunks, "data").data, audio) {
+		t.Error("audio changed")
+	}
+
+	// Readers go by the new ID3 chunk now, which has to carry the INFO tags
+	metadata, pics := readTags(t, path)
+	assertMetadata(t, metadata, map[string]string{
+		"title":      "Old Title",
+		"artist":     "Old Artist",
+		"album":      "Old Album",
+		"track":      "4",
+		"tracktotal": "9",
+	})
+	if findPicture(pics, playback.PictureFront) == nil {
+		t.Error("cover wasn't read back")
+	}
+}
+
+func TestWAVAddsInfoBeforeData(t *testing.T) {
+	audio := testAudio(500)
+	path := writeFixture(t, ".wav", wavFixture(
+		riffChunkBytes("fmt ", testWAVFormat, true),
+		riffChunkBytes("data", audio, true),
+	))
+
+	if err := Write(path, Changes{Tags: &testTags}); err != nil {
+		t.Fatalf("failed to write tags: %v", err)
+	}
+
+	chunks := readWrittenWAV(t, path)
+	if ids := chunkIDs(chunks); !slices.Equal(ids, []string{"fmt ", "LIST", "data", "id3 "}) {
+		t.Errorf("chunks are %q", ids)
+	}
+	if !bytes.Equal(findChunk(t, chunks, "data").data, audio) {
+		t.Error("audio changed")
+	}
+
+	// Clearing every tag drops the INFO chunk again
+	if err := Write(path, Changes{Tags: &Tags{}}); err != nil {
+		t.Fatalf("failed to clear tags: %v", err)
+	}
+	chunks = readWrittenWAV(t, path)
+	if ids := chunkIDs(chunks); !slices.Equal(ids, []string{"fmt ", "data", "id3 "}) {
+		t.Errorf("chunks are %q after clearing", ids)
+	}
+}